@@ -0,0 +1,93 @@
+package callback
+
+import "time"
+
+// BreakerState is the circuit breaker state of a callback
+type BreakerState string
+
+const (
+	// BreakerClosed lets all deliveries through
+	BreakerClosed BreakerState = "CLOSED"
+	// BreakerOpen stops the deliveries until the next probe
+	BreakerOpen BreakerState = "OPEN"
+	// BreakerHalfOpen lets a single probe delivery through
+	BreakerHalfOpen BreakerState = "HALF_OPEN"
+)
+
+// BreakerConfig is the circuit breaker settings
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker
+	FailureThreshold int
+	// ProbeInterval is the delay between the probe deliveries of an open breaker
+	ProbeInterval time.Duration
+	// DisableAfter is the outage length that disables the callback, 0 means never
+	DisableAfter time.Duration
+}
+
+// DefaultBreakerConfig is the default circuit breaker settings
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 10,
+	ProbeInterval:    time.Minute,
+	DisableAfter:     72 * time.Hour,
+}
+
+// Breaker is the circuit breaker of a callback
+type Breaker struct {
+	// State is the breaker state
+	State BreakerState
+	// Failures is the number of consecutive failures
+	Failures int
+	// FailingSince is the time of the first consecutive failure
+	FailingSince *time.Time
+	// NextProbeAt is the time when the next probe is allowed
+	NextProbeAt *time.Time
+}
+
+// Allow reports whether a delivery can be attempted. Once the probe
+// interval elapsed, an open breaker becomes half-open and lets a
+// single probe through until the next probe interval.
+func (b *Breaker) Allow(now time.Time, cfg BreakerConfig) bool {
+	if b.State != BreakerOpen && b.State != BreakerHalfOpen {
+		return true
+	}
+
+	if b.NextProbeAt != nil && now.Before(*b.NextProbeAt) {
+		return false
+	}
+
+	nextProbeAt := now.Add(cfg.ProbeInterval)
+	b.State = BreakerHalfOpen
+	b.NextProbeAt = &nextProbeAt
+
+	return true
+}
+
+// Succeed closes the breaker
+func (b *Breaker) Succeed() {
+	*b = Breaker{State: BreakerClosed}
+}
+
+// Fail records a failed delivery and opens the breaker if the failure
+// threshold is reached or the probe failed. It reports whether the
+// outage lasted long enough to disable the callback.
+func (b *Breaker) Fail(now time.Time, cfg BreakerConfig) bool {
+	b.Failures++
+	if b.FailingSince == nil {
+		b.FailingSince = &now
+	}
+
+	if b.State == BreakerOpen || b.State == BreakerHalfOpen ||
+		b.Failures >= cfg.FailureThreshold {
+		nextProbeAt := now.Add(cfg.ProbeInterval)
+		b.State = BreakerOpen
+		b.NextProbeAt = &nextProbeAt
+	}
+
+	return b.State == BreakerOpen && cfg.DisableAfter > 0 &&
+		now.Sub(*b.FailingSince) >= cfg.DisableAfter
+}
+
+// Clean reports whether the breaker has no recorded failures
+func (b Breaker) Clean() bool {
+	return (b.State == "" || b.State == BreakerClosed) && b.Failures == 0
+}
@@ -0,0 +1,77 @@
+package callback_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+func TestBreaker(t *testing.T) {
+	cfg := callback.BreakerConfig{
+		FailureThreshold: 3,
+		ProbeInterval:    time.Minute,
+		DisableAfter:     time.Hour,
+	}
+
+	start := time.Now()
+	breaker := callback.Breaker{State: callback.BreakerClosed}
+
+	t.Run("opens after consecutive failures", func(t *testing.T) {
+		for i := 0; i < cfg.FailureThreshold-1; i++ {
+			assert.False(t, breaker.Fail(start, cfg))
+			assert.Equal(t, callback.BreakerClosed, breaker.State)
+			assert.True(t, breaker.Allow(start, cfg))
+		}
+
+		assert.False(t, breaker.Fail(start, cfg))
+		assert.Equal(t, callback.BreakerOpen, breaker.State)
+		assert.Equal(t, cfg.FailureThreshold, breaker.Failures)
+		require.NotNil(t, breaker.FailingSince)
+		assert.Equal(t, start, *breaker.FailingSince)
+
+		// deliveries are stopped until the next probe
+		assert.False(t, breaker.Allow(start.Add(30*time.Second), cfg))
+	})
+
+	t.Run("lets a single probe through", func(t *testing.T) {
+		now := start.Add(time.Minute)
+		assert.True(t, breaker.Allow(now, cfg))
+		assert.Equal(t, callback.BreakerHalfOpen, breaker.State)
+
+		// the other deliveries wait for the probe
+		assert.False(t, breaker.Allow(now, cfg))
+
+		// failed probe opens the breaker again
+		assert.False(t, breaker.Fail(now, cfg))
+		assert.Equal(t, callback.BreakerOpen, breaker.State)
+		require.NotNil(t, breaker.NextProbeAt)
+		assert.Equal(t, now.Add(cfg.ProbeInterval), *breaker.NextProbeAt)
+	})
+
+	t.Run("disables after the outage length", func(t *testing.T) {
+		now := start.Add(cfg.DisableAfter)
+		assert.True(t, breaker.Allow(now, cfg))
+		assert.True(t, breaker.Fail(now, cfg))
+	})
+
+	t.Run("closes after success", func(t *testing.T) {
+		breaker.Succeed()
+		assert.Equal(t, callback.BreakerClosed, breaker.State)
+		assert.True(t, breaker.Clean())
+		assert.True(t, breaker.Allow(start, cfg))
+	})
+
+	t.Run("never disables without outage length", func(t *testing.T) {
+		cfg := cfg
+		cfg.DisableAfter = 0
+
+		var breaker callback.Breaker
+		for i := 0; i < 10; i++ {
+			assert.False(t, breaker.Fail(start.Add(time.Duration(i)*time.Hour), cfg))
+		}
+	})
+}
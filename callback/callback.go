@@ -1,7 +1,12 @@
 package callback
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/stevenferrer/notifi/token"
+	"github.com/stevenferrer/notifi/transform"
 )
 
 // ID is the callback ID
@@ -14,6 +19,9 @@ const (
 // CBType is the callback type
 type CBType string
 
+// ChannelKind is the kind of the delivery channel of the callback
+type ChannelKind string
+
 // Callback is a callback subsription
 type Callback struct {
 	// ID is the callback ID
@@ -24,4 +32,73 @@ type Callback struct {
 	CBType CBType
 	// URL is the url to send callback
 	URL string
+	// Channel is the delivery channel, webhook if empty
+	Channel ChannelKind
+	// ChannelConfig is the channel specific settings
+	ChannelConfig json.RawMessage
+	// RetryConfig is the retry policy settings, nil to use the default
+	RetryConfig *RetryConfig
+	// AcceptedStatuses are the response statuses considered
+	// successful, any 2xx status is accepted if empty
+	AcceptedStatuses []int
+	// RateLimit is the outbound rate limit, nil means unlimited
+	RateLimit *RateLimit
+	// Ordered delivers the notifications of the same ordering key in sequence
+	Ordered bool
+	// Filter is the payload filter expression, empty to receive all the notifications
+	Filter string
+	// Template is the payload template, empty to send the payload as is
+	Template string
+	// EventVersion is the pinned event type version of the
+	// payload, 0 to receive the payload in the version it was sent
+	EventVersion int
+	// Breaker is the circuit breaker of the callback
+	Breaker Breaker
+	// DisabledAt is the time when the callback was disabled
+	DisabledAt *time.Time
+}
+
+// ValidateAcceptedStatuses validates the accepted statuses
+func ValidateAcceptedStatuses(statuses []int) error {
+	for _, status := range statuses {
+		if status < 100 || status > 599 {
+			return ErrInvalidAcceptedStatuses
+		}
+	}
+
+	return nil
+}
+
+// ValidateTemplate validates the payload template
+func ValidateTemplate(text string) error {
+	if text == "" {
+		return nil
+	}
+
+	_, err := transform.Parse(text)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTemplate, err)
+	}
+
+	return nil
+}
+
+// RenderPayload renders the payload with the template of the callback,
+// the payload is encoded as is if the callback has no template
+func (cb Callback) RenderPayload(payload map[string]interface{}) ([]byte, error) {
+	if cb.Template == "" {
+		return json.Marshal(payload)
+	}
+
+	tmpl, err := transform.Parse(cb.Template)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTemplate, err)
+	}
+
+	body, err := tmpl.Render(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRenderPayload, err)
+	}
+
+	return body, nil
 }
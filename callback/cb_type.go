@@ -0,0 +1,146 @@
+package callback
+
+import "strings"
+
+const (
+	// wildcardOne matches exactly one segment of the callback type
+	wildcardOne = "*"
+	// wildcardMany matches zero or more segments of the callback type
+	wildcardMany = "#"
+
+	typeSeparator = "."
+)
+
+// IsPattern reports whether the callback type is a subscription pattern.
+// Patterns follow the topic semantics of the exchange: the segments are
+// separated by dots, "*" matches exactly one segment and "#" matches zero
+// or more segments. A bare "*" is the catch-all subscription.
+func (t CBType) IsPattern() bool {
+	for _, segment := range strings.Split(string(t), typeSeparator) {
+		if segment == wildcardOne || segment == wildcardMany {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate validates the callback type, the wildcards
+// must take a whole segment and segments can't be empty
+func (t CBType) Validate() error {
+	if t == "" {
+		return ErrInvalidCBType
+	}
+
+	for _, segment := range strings.Split(string(t), typeSeparator) {
+		if segment == "" {
+			return ErrInvalidCBType
+		}
+
+		if segment != wildcardOne && segment != wildcardMany &&
+			strings.ContainsAny(segment, wildcardOne+wildcardMany) {
+			return ErrInvalidCBType
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether the callback type subscribes to the event type
+func (t CBType) Matches(eventType CBType) bool {
+	if t == wildcardOne {
+		return true
+	}
+
+	return matchSegments(strings.Split(string(t), typeSeparator),
+		strings.Split(string(eventType), typeSeparator))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	switch pattern[0] {
+	case wildcardMany:
+		// try to match the rest of the pattern at every position
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	case wildcardOne:
+		return len(segments) > 0 && matchSegments(pattern[1:], segments[1:])
+	default:
+		return len(segments) > 0 && pattern[0] == segments[0] &&
+			matchSegments(pattern[1:], segments[1:])
+	}
+}
+
+// moreSpecific reports whether the callback type is more specific than the
+// other. Exact types are the most specific, then the patterns with more
+// literal segments, then the patterns with fewer "#" wildcards.
+func (t CBType) moreSpecific(other CBType) bool {
+	literals, manys := t.specificity()
+	otherLiterals, otherManys := other.specificity()
+	if literals != otherLiterals {
+		return literals > otherLiterals
+	}
+
+	return manys < otherManys
+}
+
+func (t CBType) specificity() (literals, manys int) {
+	if t == wildcardOne {
+		// the catch-all is the least specific
+		return 0, 1
+	}
+
+	for _, segment := range strings.Split(string(t), typeSeparator) {
+		switch segment {
+		case wildcardMany:
+			manys++
+		case wildcardOne:
+		default:
+			literals++
+		}
+	}
+
+	return literals, manys
+}
+
+// Resolve returns the subscriptions that receive the event type. All the
+// matching subscriptions receive the event but when several subscriptions
+// of the same channel and URL match, only the most specific one receives
+// it so that the endpoint doesn't get duplicates. Ties go to the earlier
+// subscription.
+func Resolve(cbs []Callback, eventType CBType) []Callback {
+	type endpoint struct {
+		channel ChannelKind
+		url     string
+	}
+
+	resolved := []Callback{}
+	byEndpoint := map[endpoint]int{}
+	for _, cb := range cbs {
+		if !cb.CBType.Matches(eventType) {
+			continue
+		}
+
+		key := endpoint{channel: cb.Channel, url: cb.URL}
+		i, ok := byEndpoint[key]
+		if !ok {
+			byEndpoint[key] = len(resolved)
+			resolved = append(resolved, cb)
+			continue
+		}
+
+		if cb.CBType.moreSpecific(resolved[i].CBType) {
+			resolved[i] = cb
+		}
+	}
+
+	return resolved
+}
@@ -0,0 +1,86 @@
+package callback_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+func TestCBType(t *testing.T) {
+	t.Run("validate", func(t *testing.T) {
+		valid := []callback.CBType{"INVOICE", "invoice.paid",
+			"invoice.*", "*", "#", "invoice.#", "*.paid", "invoice.#.line"}
+		for _, cbType := range valid {
+			assert.NoError(t, cbType.Validate(), cbType)
+		}
+
+		invalid := []callback.CBType{"", ".", "invoice.", ".invoice",
+			"invoice..paid", "invoice*", "inv#.paid", "**"}
+		for _, cbType := range invalid {
+			assert.ErrorIs(t, cbType.Validate(), callback.ErrInvalidCBType, cbType)
+		}
+	})
+
+	t.Run("matches", func(t *testing.T) {
+		tests := []struct {
+			pattern   callback.CBType
+			eventType callback.CBType
+			want      bool
+		}{
+			{"invoice.paid", "invoice.paid", true},
+			{"invoice.paid", "invoice.created", false},
+			{"invoice.*", "invoice.paid", true},
+			{"invoice.*", "invoice", false},
+			{"invoice.*", "invoice.line.added", false},
+			{"*.paid", "invoice.paid", true},
+			{"invoice.#", "invoice", true},
+			{"invoice.#", "invoice.line.added", true},
+			{"invoice.#.added", "invoice.added", true},
+			{"invoice.#.added", "invoice.line.item.added", true},
+			{"invoice.#.added", "invoice.line.removed", false},
+			{"#", "invoice.paid", true},
+			{"*", "invoice.paid", true},
+			{"*", "INVOICE", true},
+		}
+
+		for _, tc := range tests {
+			assert.Equal(t, tc.want, tc.pattern.Matches(tc.eventType),
+				"%s matches %s", tc.pattern, tc.eventType)
+		}
+
+		assert.True(t, callback.CBType("invoice.*").IsPattern())
+		assert.False(t, callback.CBType("invoice.paid").IsPattern())
+	})
+
+	t.Run("resolve", func(t *testing.T) {
+		cbs := []callback.Callback{
+			{ID: "catch-all", CBType: "*", URL: "https://example.com"},
+			{ID: "invoices", CBType: "invoice.*", URL: "https://example.com"},
+			{ID: "exact", CBType: "invoice.paid", URL: "https://example.com"},
+			{ID: "analytics", CBType: "#", URL: "https://analytics.example.com"},
+			{ID: "payments", CBType: "payment.*", URL: "https://example.org"},
+			{ID: "inbox", CBType: "invoice.*", Channel: "inbox"},
+			{ID: "stream", CBType: "invoice.paid", Channel: "stream"},
+		}
+
+		ids := func(cbs []callback.Callback) []callback.ID {
+			ids := []callback.ID{}
+			for _, cb := range cbs {
+				ids = append(ids, cb.ID)
+			}
+			return ids
+		}
+
+		// the most specific subscription of the url wins
+		assert.Equal(t, []callback.ID{"exact", "analytics", "inbox", "stream"},
+			ids(callback.Resolve(cbs, "invoice.paid")))
+		assert.Equal(t, []callback.ID{"invoices", "analytics", "inbox"},
+			ids(callback.Resolve(cbs, "invoice.created")))
+		assert.Equal(t, []callback.ID{"catch-all", "analytics", "payments"},
+			ids(callback.Resolve(cbs, "payment.failed")))
+		assert.Equal(t, []callback.ID{"catch-all", "analytics"},
+			ids(callback.Resolve(cbs, "USER")))
+	})
+}
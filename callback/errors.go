@@ -6,4 +6,16 @@ var (
 	ErrCallbackExists    = errors.New("callback exists")
 	ErrCallbackNotFound  = errors.New("callback not found")
 	ErrCallbackURLNotSet = errors.New("callback url not set")
+	ErrCallbackDisabled  = errors.New("callback disabled")
+
+	ErrInvalidCBType           = errors.New("invalid callback type")
+	ErrInvalidRetryConfig      = errors.New("invalid retry config")
+	ErrInvalidAcceptedStatuses = errors.New("invalid accepted statuses")
+	ErrInvalidRateLimit        = errors.New("invalid rate limit")
+	ErrInvalidFilter           = errors.New("invalid filter")
+	ErrInvalidTemplate         = errors.New("invalid template")
+	ErrRenderPayload           = errors.New("render payload failed")
+	ErrInvalidEventVersion     = errors.New("invalid event version")
+	ErrInvalidChannel          = errors.New("invalid channel")
+	ErrInvalidChannelConfig    = errors.New("invalid channel config")
 )
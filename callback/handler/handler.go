@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pkg/errors"
@@ -39,7 +41,10 @@ func NewCallbackHandler(callbackSvc callback.Service, logger zerolog.Logger) htt
 
 	addRoute(http.MethodPost, "/", createCallback(cbh))
 	addRoute(http.MethodGet, "/{callback_id}", getCallback(cbh))
+	addRoute(http.MethodPut, "/{callback_id}", updateCallback(cbh))
 	addRoute(http.MethodPost, "/{callback_id}/test", testCallback(cbh))
+	addRoute(http.MethodPost, "/{callback_id}/enable", enableCallback(cbh))
+	addRoute(http.MethodPost, "/{callback_id}/render", renderPayload(cbh))
 
 	return cbh
 }
@@ -63,9 +68,108 @@ func (cbh *callbackHandler) handleError(w http.ResponseWriter, r *http.Request,
 	}
 }
 
+// retryPolicy is the retry config of the callback, durations are in seconds
+type retryPolicy struct {
+	MaxAttempts int              `json:"max_attempts"`
+	MaxAge      int64            `json:"max_age"`
+	BaseDelay   int64            `json:"base_delay"`
+	MaxDelay    int64            `json:"max_delay"`
+	Jitter      float64          `json:"jitter"`
+	Backoff     callback.Backoff `json:"backoff"`
+}
+
+func (rp *retryPolicy) toRetryConfig() *callback.RetryConfig {
+	if rp == nil {
+		return nil
+	}
+
+	return &callback.RetryConfig{
+		MaxAttempts: rp.MaxAttempts,
+		MaxAge:      time.Duration(rp.MaxAge) * time.Second,
+		BaseDelay:   time.Duration(rp.BaseDelay) * time.Second,
+		MaxDelay:    time.Duration(rp.MaxDelay) * time.Second,
+		Jitter:      rp.Jitter,
+		Backoff:     rp.Backoff,
+	}
+}
+
+func newRetryPolicy(cfg *callback.RetryConfig) *retryPolicy {
+	if cfg == nil {
+		return nil
+	}
+
+	return &retryPolicy{
+		MaxAttempts: cfg.MaxAttempts,
+		MaxAge:      int64(cfg.MaxAge / time.Second),
+		BaseDelay:   int64(cfg.BaseDelay / time.Second),
+		MaxDelay:    int64(cfg.MaxDelay / time.Second),
+		Jitter:      cfg.Jitter,
+		Backoff:     cfg.Backoff,
+	}
+}
+
+// rateLimit is the outbound rate limit of the callback
+type rateLimit struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
+
+func (rl *rateLimit) toRateLimit() *callback.RateLimit {
+	if rl == nil {
+		return nil
+	}
+
+	return &callback.RateLimit{
+		PerSecond: rl.PerSecond,
+		Burst:     rl.Burst,
+	}
+}
+
+func newRateLimit(limit *callback.RateLimit) *rateLimit {
+	if limit == nil {
+		return nil
+	}
+
+	return &rateLimit{
+		PerSecond: limit.PerSecond,
+		Burst:     limit.Burst,
+	}
+}
+
+// isInvalidSettings reports whether the error is a callback settings validation error
+func isInvalidSettings(err error) bool {
+	return err == callback.ErrInvalidCBType ||
+		err == callback.ErrInvalidRetryConfig ||
+		err == callback.ErrInvalidAcceptedStatuses ||
+		err == callback.ErrInvalidRateLimit ||
+		errors.Is(err, callback.ErrInvalidFilter) ||
+		errors.Is(err, callback.ErrInvalidTemplate) ||
+		err == callback.ErrInvalidEventVersion ||
+		err == callback.ErrInvalidChannel ||
+		errors.Is(err, callback.ErrInvalidChannelConfig)
+}
+
+// channelConfig returns the channel config of the request, null is no config
+func channelConfig(raw json.RawMessage) json.RawMessage {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil
+	}
+
+	return raw
+}
+
 type createCbRequest struct {
-	CallbackType callback.CBType `json:"callback_type"`
-	URL          string          `json:"url"`
+	CallbackType     callback.CBType      `json:"callback_type"`
+	URL              string               `json:"url"`
+	Channel          callback.ChannelKind `json:"channel"`
+	ChannelConfig    json.RawMessage      `json:"channel_config"`
+	RetryPolicy      *retryPolicy         `json:"retry_policy"`
+	AcceptedStatuses []int                `json:"accepted_statuses"`
+	RateLimit        *rateLimit           `json:"rate_limit"`
+	Ordered          bool                 `json:"ordered"`
+	Filter           string               `json:"filter"`
+	Template         string               `json:"template"`
+	EventVersion     int                  `json:"event_version"`
 }
 
 type createCbResponse struct {
@@ -86,13 +190,23 @@ func createCallback(cbh *callbackHandler) notifihttp.Handler {
 		}
 
 		cbID, err := cbh.callbackSvc.CreateCallback(r.Context(), callback.Callback{
-			ID:      callback.NewID(),
-			TokenID: token.ID,
-			CBType:  request.CallbackType,
-			URL:     request.URL,
+			ID:               callback.NewID(),
+			TokenID:          token.ID,
+			CBType:           request.CallbackType,
+			URL:              request.URL,
+			Channel:          request.Channel,
+			ChannelConfig:    channelConfig(request.ChannelConfig),
+			RetryConfig:      request.RetryPolicy.toRetryConfig(),
+			AcceptedStatuses: request.AcceptedStatuses,
+			RateLimit:        request.RateLimit.toRateLimit(),
+			Ordered:          request.Ordered,
+			Filter:           request.Filter,
+			Template:         request.Template,
+			EventVersion:     request.EventVersion,
 		})
 		if err != nil {
-			if err == callback.ErrCallbackExists {
+			if err == callback.ErrCallbackExists ||
+				err == callback.ErrCallbackURLNotSet || isInvalidSettings(err) {
 				return notifihttp.NewBadRequestError(err)
 			}
 
@@ -105,14 +219,54 @@ func createCallback(cbh *callbackHandler) notifihttp.Handler {
 	})
 }
 
+// breakerResponse is the circuit breaker state of the callback
+type breakerResponse struct {
+	State               callback.BreakerState `json:"state"`
+	ConsecutiveFailures int                   `json:"consecutive_failures"`
+	FailingSince        *time.Time            `json:"failing_since,omitempty"`
+	NextProbeAt         *time.Time            `json:"next_probe_at,omitempty"`
+}
+
+func newBreakerResponse(breaker callback.Breaker) breakerResponse {
+	response := breakerResponse{
+		State:               breaker.State,
+		ConsecutiveFailures: breaker.Failures,
+		FailingSince:        breaker.FailingSince,
+	}
+
+	// next probe is only relevant if the breaker is not closed
+	if breaker.State != callback.BreakerClosed {
+		response.NextProbeAt = breaker.NextProbeAt
+	}
+
+	return response
+}
+
 type getCallbackResponse struct {
-	ID     callback.ID     `json:"callback_id"`
-	CBType callback.CBType `json:"callback_type"`
-	URL    string          `json:"url"`
+	ID               callback.ID          `json:"callback_id"`
+	CBType           callback.CBType      `json:"callback_type"`
+	URL              string               `json:"url"`
+	Channel          callback.ChannelKind `json:"channel"`
+	ChannelConfig    json.RawMessage      `json:"channel_config,omitempty"`
+	RetryPolicy      *retryPolicy         `json:"retry_policy"`
+	AcceptedStatuses []int                `json:"accepted_statuses"`
+	RateLimit        *rateLimit           `json:"rate_limit"`
+	Ordered          bool                 `json:"ordered"`
+	Filter           string               `json:"filter,omitempty"`
+	Template         string               `json:"template,omitempty"`
+	EventVersion     int                  `json:"event_version,omitempty"`
+	Breaker          breakerResponse      `json:"breaker"`
+	Disabled         bool                 `json:"disabled"`
+	DisabledAt       *time.Time           `json:"disabled_at,omitempty"`
 }
 
 func getCallback(cbh *callbackHandler) notifihttp.Handler {
 	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
 		cbID := callback.ID(chi.URLParam(r, "callback_id"))
 		cb, err := cbh.callbackSvc.GetCallback(r.Context(), cbID)
 		if err != nil {
@@ -123,18 +277,112 @@ func getCallback(cbh *callbackHandler) notifihttp.Handler {
 			return errors.Wrap(err, "get callback")
 		}
 
+		// only the owner can view the callback
+		if cb.TokenID != token.ID {
+			return notifihttp.NewNotFoundError(callback.ErrCallbackNotFound)
+		}
+
 		response := getCallbackResponse{
-			ID:     cb.ID,
-			CBType: cb.CBType,
-			URL:    cb.URL,
+			ID:               cb.ID,
+			CBType:           cb.CBType,
+			URL:              cb.URL,
+			Channel:          cb.Channel,
+			ChannelConfig:    cb.ChannelConfig,
+			RetryPolicy:      newRetryPolicy(cb.RetryConfig),
+			AcceptedStatuses: cb.AcceptedStatuses,
+			RateLimit:        newRateLimit(cb.RateLimit),
+			Ordered:          cb.Ordered,
+			Filter:           cb.Filter,
+			Template:         cb.Template,
+			EventVersion:     cb.EventVersion,
+			Breaker:          newBreakerResponse(cb.Breaker),
+			Disabled:         cb.DisabledAt != nil,
+			DisabledAt:       cb.DisabledAt,
 		}
 
 		return cbh.render.JSON(w, http.StatusOK, response)
 	})
 }
 
+type updateCbRequest struct {
+	URL              string               `json:"url"`
+	Channel          callback.ChannelKind `json:"channel"`
+	ChannelConfig    json.RawMessage      `json:"channel_config"`
+	RetryPolicy      *retryPolicy         `json:"retry_policy"`
+	AcceptedStatuses []int                `json:"accepted_statuses"`
+	RateLimit        *rateLimit           `json:"rate_limit"`
+	Ordered          bool                 `json:"ordered"`
+	Filter           string               `json:"filter"`
+	Template         string               `json:"template"`
+	EventVersion     int                  `json:"event_version"`
+}
+
+func updateCallback(cbh *callbackHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		var request updateCbRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		cbID := callback.ID(chi.URLParam(r, "callback_id"))
+		cb, err := cbh.callbackSvc.GetCallback(r.Context(), cbID)
+		if err != nil {
+			if err == callback.ErrCallbackNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "get callback")
+		}
+
+		// only the owner can update the callback
+		if cb.TokenID != token.ID {
+			return notifihttp.NewNotFoundError(callback.ErrCallbackNotFound)
+		}
+
+		cb.URL = request.URL
+		cb.Channel = request.Channel
+		cb.ChannelConfig = channelConfig(request.ChannelConfig)
+		cb.RetryConfig = request.RetryPolicy.toRetryConfig()
+		cb.AcceptedStatuses = request.AcceptedStatuses
+		cb.RateLimit = request.RateLimit.toRateLimit()
+		cb.Ordered = request.Ordered
+		cb.Filter = request.Filter
+		cb.Template = request.Template
+		cb.EventVersion = request.EventVersion
+
+		err = cbh.callbackSvc.UpdateCallback(r.Context(), *cb)
+		if err != nil {
+			if err == callback.ErrCallbackExists ||
+				err == callback.ErrCallbackURLNotSet || isInvalidSettings(err) {
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			if err == callback.ErrCallbackNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "update callback")
+		}
+
+		return cbh.render.JSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Callback updated",
+		})
+	})
+}
+
 func testCallback(cbh *callbackHandler) notifihttp.Handler {
 	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
 		cbID := callback.ID(chi.URLParam(r, "callback_id"))
 		cb, err := cbh.callbackSvc.GetCallback(r.Context(), cbID)
 		if err != nil {
@@ -145,6 +393,11 @@ func testCallback(cbh *callbackHandler) notifihttp.Handler {
 			return errors.Wrap(err, "get callback")
 		}
 
+		// only the owner can test the callback
+		if cb.TokenID != token.ID {
+			return notifihttp.NewNotFoundError(callback.ErrCallbackNotFound)
+		}
+
 		err = cbh.callbackSvc.TestCallback(r.Context(), cb.ID)
 		if err != nil {
 			cbh.logger.Error().Err(err).Msg("callback test fail")
@@ -158,3 +411,94 @@ func testCallback(cbh *callbackHandler) notifihttp.Handler {
 		})
 	})
 }
+
+func enableCallback(cbh *callbackHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		cbID := callback.ID(chi.URLParam(r, "callback_id"))
+		cb, err := cbh.callbackSvc.GetCallback(r.Context(), cbID)
+		if err != nil {
+			if err == callback.ErrCallbackNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "get callback")
+		}
+
+		// only the owner can enable the callback
+		if cb.TokenID != token.ID {
+			return notifihttp.NewNotFoundError(callback.ErrCallbackNotFound)
+		}
+
+		err = cbh.callbackSvc.EnableCallback(r.Context(), cb.ID)
+		if err != nil {
+			return errors.Wrap(err, "enable callback")
+		}
+
+		return cbh.render.JSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Callback enabled",
+		})
+	})
+}
+
+type renderPayloadRequest struct {
+	// Template is previewed instead of the callback template if set
+	Template string                 `json:"template"`
+	Payload  map[string]interface{} `json:"payload"`
+}
+
+type renderPayloadResponse struct {
+	Body json.RawMessage `json:"body"`
+}
+
+func renderPayload(cbh *callbackHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		var request renderPayloadRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		cbID := callback.ID(chi.URLParam(r, "callback_id"))
+		cb, err := cbh.callbackSvc.GetCallback(r.Context(), cbID)
+		if err != nil {
+			if err == callback.ErrCallbackNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "get callback")
+		}
+
+		// only the owner can preview the callback template
+		if cb.TokenID != token.ID {
+			return notifihttp.NewNotFoundError(callback.ErrCallbackNotFound)
+		}
+
+		if request.Template != "" {
+			cb.Template = request.Template
+		}
+
+		body, err := cbh.callbackSvc.RenderPayload(r.Context(), *cb, request.Payload)
+		if err != nil {
+			if errors.Is(err, callback.ErrInvalidTemplate) ||
+				errors.Is(err, callback.ErrRenderPayload) {
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return errors.Wrap(err, "render payload")
+		}
+
+		return cbh.render.JSON(w, http.StatusOK, renderPayloadResponse{
+			Body: body,
+		})
+	})
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stevenferrer/notifi/callback"
@@ -34,9 +36,10 @@ func TestCallbackHandler(t *testing.T) {
 	tokenMw := tkhandler.NewTokenMw(tokenSvc)
 
 	callbackRepo := postgres.NewCallbackRepository(db)
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
 	requestSender := notifihttp.NewDefaultRequestSender()
 	callbackSvc := callbacksvc.NewCallbackService(callbackRepo,
-		tokenRepo, requestSender)
+		tokenRepo, eventTypeRepo, requestSender)
 
 	logger := zerolog.New(os.Stderr)
 	cbHandler := cbhandler.NewCallbackHandler(callbackSvc, logger)
@@ -82,6 +85,20 @@ func TestCallbackHandler(t *testing.T) {
 		cbID = callback.ID(response.CBID)
 	})
 
+	t.Run("Create callback with invalid retry policy", func(t *testing.T) {
+		body := `{"callback_type":"PAYMENT","url":"https://example.com",
+			"retry_policy":{"base_delay":0,"backoff":"exponential"}}`
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "/",
+			strings.NewReader(body))
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+		rr := httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
 	t.Run("Get callback", func(t *testing.T) {
 		httpReq, err := http.NewRequestWithContext(ctx,
 			http.MethodGet, "/"+string(cbID), nil)
@@ -96,6 +113,10 @@ func TestCallbackHandler(t *testing.T) {
 			CallbackID   string `json:"callback_id"`
 			CallbackType string `json:"callback_type"`
 			URL          string `json:"url"`
+			Breaker      struct {
+				State string `json:"state"`
+			} `json:"breaker"`
+			Disabled bool `json:"disabled"`
 		}{}
 		err = json.NewDecoder(rr.Body).Decode(&response)
 		require.NoError(t, err)
@@ -103,5 +124,117 @@ func TestCallbackHandler(t *testing.T) {
 		assert.NotEmpty(t, response.CallbackID)
 		assert.NotEmpty(t, response.CallbackType)
 		assert.NotEmpty(t, response.URL)
+		assert.Equal(t, string(callback.BreakerClosed), response.Breaker.State)
+		assert.False(t, response.Disabled)
+	})
+
+	t.Run("Get and test callback of other token", func(t *testing.T) {
+		otherTk, err := tokenSvc.CreateToken(ctx)
+		require.NoError(t, err)
+
+		for _, target := range []struct{ method, path string }{
+			{http.MethodGet, "/" + string(cbID)},
+			{http.MethodPost, "/" + string(cbID) + "/test"},
+		} {
+			httpReq, err := http.NewRequestWithContext(ctx,
+				target.method, target.path, nil)
+			require.NoError(t, err)
+
+			httpReq.Header.Add("X-API-KEY", string(otherTk.ID))
+
+			rr := httptest.NewRecorder()
+			authHandler.ServeHTTP(rr, httpReq)
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("Update callback", func(t *testing.T) {
+		body := `{"url":"https://example.org",
+			"rate_limit":{"per_second":5,"burst":10}}`
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut,
+			"/"+string(cbID), strings.NewReader(body))
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+		rr := httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		gotCb, err := callbackSvc.GetCallback(ctx, cbID)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.org", gotCb.URL)
+		assert.Equal(t, &callback.RateLimit{PerSecond: 5, Burst: 10}, gotCb.RateLimit)
+
+		// invalid rate limit
+		body = `{"url":"https://example.org","rate_limit":{"per_second":0,"burst":10}}`
+		httpReq, err = http.NewRequestWithContext(ctx, http.MethodPut,
+			"/"+string(cbID), strings.NewReader(body))
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+		rr = httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Enable callback", func(t *testing.T) {
+		// disable the callback
+		err := callbackRepo.UpdateBreaker(ctx, cbID, func(cb *callback.Callback) error {
+			now := time.Now()
+			cb.Breaker.Fail(now, callback.BreakerConfig{FailureThreshold: 1})
+			cb.DisabledAt = &now
+			return nil
+		})
+		require.NoError(t, err)
+
+		httpReq, err := http.NewRequestWithContext(ctx,
+			http.MethodPost, "/"+string(cbID)+"/enable", nil)
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+		rr := httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		gotCb, err := callbackSvc.GetCallback(ctx, cbID)
+		require.NoError(t, err)
+		assert.Nil(t, gotCb.DisabledAt)
+		assert.Equal(t, callback.BreakerClosed, gotCb.Breaker.State)
+		assert.Zero(t, gotCb.Breaker.Failures)
+	})
+
+	t.Run("Render payload", func(t *testing.T) {
+		render := func(body string) *httptest.ResponseRecorder {
+			httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+				"/"+string(cbID)+"/render", strings.NewReader(body))
+			require.NoError(t, err)
+
+			httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+			rr := httptest.NewRecorder()
+			authHandler.ServeHTTP(rr, httpReq)
+			return rr
+		}
+
+		// no template sends the payload as is
+		rr := render(`{"payload":{"order_id":"1234"}}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"body":{"order_id":"1234"}}`, rr.Body.String())
+
+		// preview a template
+		rr = render(`{"template":"{\"id\": {{json .order_id}}, \"source\": \"notifi\"}",
+			"payload":{"order_id":"1234"}}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"body":{"id":"1234","source":"notifi"}}`, rr.Body.String())
+
+		// rendered template must be valid json
+		rr = render(`{"template":"{{.order_id}","payload":{"order_id":"1234"}}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = render(`{"template":"{\"id\": {{.name}}}","payload":{"name":"Jane Doe"}}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 }
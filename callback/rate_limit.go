@@ -0,0 +1,18 @@
+package callback
+
+// RateLimit is the outbound rate limit of a callback
+type RateLimit struct {
+	// PerSecond is the number of requests allowed per second
+	PerSecond float64 `json:"per_second"`
+	// Burst is the max number of requests sent at once
+	Burst int `json:"burst"`
+}
+
+// Validate validates the rate limit
+func (rl RateLimit) Validate() error {
+	if rl.PerSecond <= 0 || rl.Burst < 1 {
+		return ErrInvalidRateLimit
+	}
+
+	return nil
+}
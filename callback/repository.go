@@ -10,5 +10,15 @@ import (
 type Repository interface {
 	CreateCallback(context.Context, Callback) error
 	GetCallback(context.Context, ID) (*Callback, error)
-	GetCbByTokenIDnCbType(context.Context, token.ID, CBType) (*Callback, error)
+	// ListCbsByTokenIDnCbType returns the callbacks subscribed to the
+	// callback type, including the patterns matching the callback type
+	ListCbsByTokenIDnCbType(context.Context, token.ID, CBType) ([]Callback, error)
+	// ListSubscribers returns the tokens among the
+	// given tokens that are subscribed to the callback type
+	ListSubscribers(context.Context, []token.ID, CBType) ([]token.ID, error)
+	// UpdateCallback updates the callback settings
+	UpdateCallback(context.Context, Callback) error
+	// UpdateBreaker locks the callback, applies the update
+	// and saves the breaker state and disabled time
+	UpdateBreaker(context.Context, ID, func(*Callback) error) error
 }
@@ -0,0 +1,52 @@
+package callback
+
+import "time"
+
+// Backoff is the shape of the retry delays
+type Backoff string
+
+const (
+	// BackoffConstant retries after the same delay
+	BackoffConstant Backoff = "constant"
+	// BackoffLinear increases the delay linearly
+	BackoffLinear Backoff = "linear"
+	// BackoffQuadratic increases the delay quadratically
+	BackoffQuadratic Backoff = "quadratic"
+	// BackoffExponential doubles the delay on every retry
+	BackoffExponential Backoff = "exponential"
+)
+
+// RetryConfig is the retry policy settings of a callback
+type RetryConfig struct {
+	// MaxAttempts is the max number of delivery attempts, 0 means unlimited
+	MaxAttempts int `json:"max_attempts"`
+	// MaxAge is the max age of the notification to be retried, 0 means unlimited
+	MaxAge time.Duration `json:"max_age"`
+	// BaseDelay is the delay of the first retry
+	BaseDelay time.Duration `json:"base_delay"`
+	// MaxDelay caps the retry delay, 0 means unlimited
+	MaxDelay time.Duration `json:"max_delay"`
+	// Jitter randomizes the delay by the given fraction (0 to 1)
+	Jitter float64 `json:"jitter"`
+	// Backoff is the shape of the retry delays
+	Backoff Backoff `json:"backoff"`
+}
+
+// Validate validates the retry config
+func (cfg RetryConfig) Validate() error {
+	if cfg.MaxAttempts < 0 || cfg.MaxAge < 0 ||
+		cfg.BaseDelay <= 0 || cfg.MaxDelay < 0 ||
+		(cfg.MaxDelay > 0 && cfg.MaxDelay < cfg.BaseDelay) ||
+		cfg.Jitter < 0 || cfg.Jitter > 1 {
+		return ErrInvalidRetryConfig
+	}
+
+	switch cfg.Backoff {
+	case BackoffConstant, BackoffLinear,
+		BackoffQuadratic, BackoffExponential:
+	default:
+		return ErrInvalidRetryConfig
+	}
+
+	return nil
+}
@@ -10,7 +10,12 @@ import (
 type Service interface {
 	CreateCallback(context.Context, Callback) (ID, error)
 	GetCallback(context.Context, ID) (*Callback, error)
-	GetCbByTokenIDnCbType(context.Context, token.ID, CBType) (*Callback, error)
+	ListCbsByTokenIDnCbType(context.Context, token.ID, CBType) ([]Callback, error)
+	// UpdateCallback updates the url and delivery settings of the callback
+	UpdateCallback(context.Context, Callback) error
 	TestCallback(context.Context, ID) error
-	// UpdateCallback - update callback definition
+	// EnableCallback enables the callback and closes its breaker
+	EnableCallback(context.Context, ID) error
+	// RenderPayload renders the sample payload with the template of the callback
+	RenderPayload(context.Context, Callback, map[string]interface{}) ([]byte, error)
 }
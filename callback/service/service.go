@@ -3,10 +3,16 @@ package service
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/channel"
+	"github.com/stevenferrer/notifi/eventtype"
+	"github.com/stevenferrer/notifi/filter"
 	"github.com/stevenferrer/notifi/notifihttp"
+	"github.com/stevenferrer/notifi/signature"
 	"github.com/stevenferrer/notifi/token"
 )
 
@@ -14,29 +20,60 @@ import (
 type CallbackService struct {
 	callbackRepo  callback.Repository
 	tokenRepo     token.Repository
-	requestSender notifihttp.RequestSender
+	eventTypeRepo eventtype.Repository
+	channels      *channel.Registry
 }
 
 var _ callback.Service = (*CallbackService)(nil)
 
 func NewCallbackService(callbackRepo callback.Repository,
-	tokenRepo token.Repository,
+	tokenRepo token.Repository, eventTypeRepo eventtype.Repository,
 	requestSender notifihttp.RequestSender) *CallbackService {
 	return &CallbackService{
 		callbackRepo:  callbackRepo,
 		tokenRepo:     tokenRepo,
-		requestSender: requestSender,
+		eventTypeRepo: eventTypeRepo,
+		channels:      channel.NewDefaultRegistry(requestSender),
 	}
 }
 
+// WithChannels overrides the delivery channels, only webhooks are supported by default
+func (cbs *CallbackService) WithChannels(channels *channel.Registry) *CallbackService {
+	cbs.channels = channels
+	return cbs
+}
+
 func (cbs *CallbackService) CreateCallback(ctx context.Context,
 	cb callback.Callback) (callback.ID, error) {
+	err := cb.CBType.Validate()
+	if err != nil {
+		return callback.NilID, err
+	}
+
+	if cb.Channel == "" {
+		cb.Channel = channel.Webhook
+	}
+
+	err = cbs.validateSettings(ctx, cb)
+	if err != nil {
+		return callback.NilID, err
+	}
+
 	cbID := callback.NewID()
-	err := cbs.callbackRepo.CreateCallback(ctx, callback.Callback{
-		ID:      cbID,
-		TokenID: cb.TokenID,
-		CBType:  cb.CBType,
-		URL:     cb.URL,
+	err = cbs.callbackRepo.CreateCallback(ctx, callback.Callback{
+		ID:               cbID,
+		TokenID:          cb.TokenID,
+		CBType:           cb.CBType,
+		URL:              cb.URL,
+		Channel:          cb.Channel,
+		ChannelConfig:    cb.ChannelConfig,
+		RetryConfig:      cb.RetryConfig,
+		AcceptedStatuses: cb.AcceptedStatuses,
+		RateLimit:        cb.RateLimit,
+		Ordered:          cb.Ordered,
+		Filter:           cb.Filter,
+		Template:         cb.Template,
+		EventVersion:     cb.EventVersion,
 	})
 	if err != nil {
 		if err == callback.ErrCallbackExists {
@@ -49,6 +86,94 @@ func (cbs *CallbackService) CreateCallback(ctx context.Context,
 	return cbID, nil
 }
 
+// validateSettings validates the delivery settings of the callback
+func (cbs *CallbackService) validateSettings(ctx context.Context, cb callback.Callback) error {
+	err := cbs.channels.Validate(cb)
+	if err != nil {
+		return err
+	}
+
+	if cb.RetryConfig != nil {
+		err = cb.RetryConfig.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = callback.ValidateAcceptedStatuses(cb.AcceptedStatuses)
+	if err != nil {
+		return err
+	}
+
+	if cb.RateLimit != nil {
+		err = cb.RateLimit.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if cb.Filter != "" {
+		_, err = filter.Parse(cb.Filter)
+		if err != nil {
+			return fmt.Errorf("%w: %s", callback.ErrInvalidFilter, err)
+		}
+	}
+
+	// Pattern subscriptions span several event types
+	if cb.EventVersion < 0 || (cb.EventVersion > 0 && cb.CBType.IsPattern()) {
+		return callback.ErrInvalidEventVersion
+	}
+
+	err = cbs.validateEventVersion(ctx, cb)
+	if err != nil {
+		return err
+	}
+
+	return callback.ValidateTemplate(cb.Template)
+}
+
+// validateEventVersion checks that the pinned version exists for the event type
+func (cbs *CallbackService) validateEventVersion(ctx context.Context, cb callback.Callback) error {
+	if cb.EventVersion == 0 {
+		return nil
+	}
+
+	versions, err := cbs.eventTypeRepo.ListVersions(ctx, cb.CBType)
+	if err != nil {
+		return errors.Wrap(err, "list versions")
+	}
+
+	for _, v := range versions {
+		if v.Version == cb.EventVersion {
+			return nil
+		}
+	}
+
+	return callback.ErrInvalidEventVersion
+}
+
+func (cbs *CallbackService) UpdateCallback(ctx context.Context, cb callback.Callback) error {
+	if cb.Channel == "" {
+		cb.Channel = channel.Webhook
+	}
+
+	err := cbs.validateSettings(ctx, cb)
+	if err != nil {
+		return err
+	}
+
+	err = cbs.callbackRepo.UpdateCallback(ctx, cb)
+	if err != nil {
+		if err == callback.ErrCallbackNotFound || err == callback.ErrCallbackExists {
+			return err
+		}
+
+		return errors.Wrap(err, "update callback")
+	}
+
+	return nil
+}
+
 func (cbs *CallbackService) GetCallback(ctx context.Context,
 	cbID callback.ID) (*callback.Callback, error) {
 	cb, err := cbs.callbackRepo.GetCallback(ctx, cbID)
@@ -63,18 +188,14 @@ func (cbs *CallbackService) GetCallback(ctx context.Context,
 	return cb, nil
 }
 
-func (cbs *CallbackService) GetCbByTokenIDnCbType(ctx context.Context,
-	tokenID token.ID, cbType callback.CBType) (*callback.Callback, error) {
-	cb, err := cbs.callbackRepo.GetCbByTokenIDnCbType(ctx, tokenID, cbType)
+func (cbs *CallbackService) ListCbsByTokenIDnCbType(ctx context.Context,
+	tokenID token.ID, cbType callback.CBType) ([]callback.Callback, error) {
+	callbacks, err := cbs.callbackRepo.ListCbsByTokenIDnCbType(ctx, tokenID, cbType)
 	if err != nil {
-		if err == callback.ErrCallbackNotFound {
-			return nil, err
-		}
-
-		return nil, errors.Wrap(err, "get callack")
+		return nil, errors.Wrap(err, "list cbs by token id and cb type")
 	}
 
-	return cb, nil
+	return callbacks, nil
 }
 
 func (cbs *CallbackService) TestCallback(ctx context.Context, cbID callback.ID) error {
@@ -84,23 +205,58 @@ func (cbs *CallbackService) TestCallback(ctx context.Context, cbID callback.ID)
 		return errors.Wrap(err, "get callback")
 	}
 
-	tk, err := cbs.tokenRepo.GetToken(ctx, cb.TokenID)
+	cbKeys, err := cbs.tokenRepo.GetActiveCBKeys(ctx, cb.TokenID)
 	if err != nil {
-		return errors.Wrap(err, "get token")
+		return errors.Wrap(err, "get active cb keys")
 	}
 
 	buf := &bytes.Buffer{}
 	buf.WriteString(`{"message":"Hello"}`)
 
-	headers := map[string]string{
-		"X-IDEMPOTENT-KEY": "test-1234",
-		"X-CALLBACK-TOKEN": string(tk.CBKey),
+	headers := signature.Headers(time.Now(), "test-1234", buf.Bytes(),
+		token.CBKeys(cbKeys)...)
+
+	_, err = cbs.channels.Send(ctx, *cb, channel.Message{
+		ID:      "test-" + string(cb.ID),
+		CBType:  cb.CBType,
+		Body:    buf.Bytes(),
+		Headers: headers,
+	})
+	if err != nil {
+		return errors.Wrap(err, "send test message")
 	}
 
-	err = cbs.requestSender.SendRequest(ctx, cb.URL, buf, headers)
+	return nil
+}
+
+func (cbs *CallbackService) EnableCallback(ctx context.Context, cbID callback.ID) error {
+	err := cbs.callbackRepo.UpdateBreaker(ctx, cbID, func(cb *callback.Callback) error {
+		cb.Breaker.Succeed()
+		cb.DisabledAt = nil
+		return nil
+	})
 	if err != nil {
-		return errors.Wrap(err, "send request")
+		if err == callback.ErrCallbackNotFound {
+			return err
+		}
+
+		return errors.Wrap(err, "update breaker")
 	}
 
 	return nil
 }
+
+func (cbs *CallbackService) RenderPayload(ctx context.Context,
+	cb callback.Callback, payload map[string]interface{}) ([]byte, error) {
+	body, err := cb.RenderPayload(payload)
+	if err != nil {
+		if errors.Is(err, callback.ErrInvalidTemplate) ||
+			errors.Is(err, callback.ErrRenderPayload) {
+			return nil, err
+		}
+
+		return nil, errors.Wrap(err, "render payload")
+	}
+
+	return body, nil
+}
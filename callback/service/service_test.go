@@ -9,6 +9,8 @@ import (
 
 	"github.com/stevenferrer/notifi/callback"
 	callbacksvc "github.com/stevenferrer/notifi/callback/service"
+	"github.com/stevenferrer/notifi/channel"
+	"github.com/stevenferrer/notifi/eventtype"
 	"github.com/stevenferrer/notifi/notifihttp"
 	"github.com/stevenferrer/notifi/postgres"
 	"github.com/stevenferrer/notifi/postgres/migration"
@@ -26,8 +28,10 @@ func TestCallbackService(t *testing.T) {
 	tokenSvc := token.NewTokenService(tokenRepo)
 
 	callbackRepo := postgres.NewCallbackRepository(db)
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
 	requestSender := notifihttp.NewDefaultRequestSender()
-	callbackSvc := callbacksvc.NewCallbackService(callbackRepo, tokenRepo, requestSender)
+	callbackSvc := callbacksvc.NewCallbackService(callbackRepo,
+		tokenRepo, eventTypeRepo, requestSender)
 
 	ctx := context.TODO()
 
@@ -48,6 +52,65 @@ func TestCallbackService(t *testing.T) {
 	_, err = callbackSvc.CreateCallback(ctx, cb)
 	require.ErrorIs(t, err, callback.ErrCallbackExists)
 
+	// wildcards must take a whole segment
+	_, err = callbackSvc.CreateCallback(ctx, callback.Callback{
+		TokenID: tk.ID,
+		CBType:  "invoice*",
+		URL:     "https://example.com",
+	})
+	require.ErrorIs(t, err, callback.ErrInvalidCBType)
+
+	// filter must be a valid expression
+	_, err = callbackSvc.CreateCallback(ctx, callback.Callback{
+		TokenID: tk.ID,
+		CBType:  "INVOICE",
+		URL:     "https://example.net",
+		Filter:  "payload.amount >",
+	})
+	require.ErrorIs(t, err, callback.ErrInvalidFilter)
+
+	// template must be a valid go template
+	_, err = callbackSvc.CreateCallback(ctx, callback.Callback{
+		TokenID:  tk.ID,
+		CBType:   "INVOICE",
+		URL:      "https://example.net",
+		Template: `{"id": {{json .id}`,
+	})
+	require.ErrorIs(t, err, callback.ErrInvalidTemplate)
+
+	// pattern subscriptions can't be pinned to a version
+	_, err = callbackSvc.CreateCallback(ctx, callback.Callback{
+		TokenID:      tk.ID,
+		CBType:       "invoice.*",
+		URL:          "https://example.net",
+		EventVersion: 2,
+	})
+	require.ErrorIs(t, err, callback.ErrInvalidEventVersion)
+
+	// the pinned version must exist
+	err = eventTypeRepo.CreateEventType(ctx, eventtype.EventType{
+		Name:    "INVOICE",
+		TokenID: tk.ID,
+	})
+	require.NoError(t, err)
+
+	_, err = callbackSvc.CreateCallback(ctx, callback.Callback{
+		TokenID:      tk.ID,
+		CBType:       "INVOICE",
+		URL:          "https://example.net",
+		EventVersion: 2,
+	})
+	require.ErrorIs(t, err, callback.ErrInvalidEventVersion)
+
+	// only the registered channels are supported
+	_, err = callbackSvc.CreateCallback(ctx, callback.Callback{
+		TokenID: tk.ID,
+		CBType:  "INVOICE",
+		URL:     "https://example.net",
+		Channel: "sms",
+	})
+	require.ErrorIs(t, err, callback.ErrInvalidChannel)
+
 	// get callback by id
 	gotCb, err := callbackSvc.GetCallback(ctx, cbID)
 	require.NoError(t, err)
@@ -56,20 +119,29 @@ func TestCallbackService(t *testing.T) {
 	assert.Equal(t, cb.TokenID, gotCb.TokenID)
 	assert.Equal(t, cb.CBType, gotCb.CBType)
 	assert.Equal(t, cb.URL, gotCb.URL)
+	assert.Equal(t, channel.Webhook, gotCb.Channel)
 
-	// get callback by token id and cb type
-	gotCb, err = callbackSvc.GetCbByTokenIDnCbType(ctx, tk.ID, cb.CBType)
+	// another endpoint for the same callback type
+	cb2 := cb
+	cb2.URL = "https://example.org"
+	cbID2, err := callbackSvc.CreateCallback(ctx, cb2)
 	require.NoError(t, err)
 
-	assert.Equal(t, cbID, gotCb.ID)
-	assert.Equal(t, cb.TokenID, gotCb.TokenID)
-	assert.Equal(t, cb.CBType, gotCb.CBType)
-	assert.Equal(t, cb.URL, gotCb.URL)
+	// list callbacks by token id and cb type
+	gotCbs, err := callbackSvc.ListCbsByTokenIDnCbType(ctx, tk.ID, cb.CBType)
+	require.NoError(t, err)
+	require.Len(t, gotCbs, 2)
+
+	assert.Equal(t, cbID, gotCbs[0].ID)
+	assert.Equal(t, cb.URL, gotCbs[0].URL)
+	assert.Equal(t, cbID2, gotCbs[1].ID)
+	assert.Equal(t, cb2.URL, gotCbs[1].URL)
 
 	// callback not found
 	_, err = callbackSvc.GetCallback(ctx, callback.NewID())
 	assert.ErrorIs(t, err, callback.ErrCallbackNotFound)
 
-	_, err = callbackSvc.GetCbByTokenIDnCbType(ctx, token.NewID(), cb.CBType)
-	assert.ErrorIs(t, err, callback.ErrCallbackNotFound)
+	gotCbs, err = callbackSvc.ListCbsByTokenIDnCbType(ctx, token.NewID(), cb.CBType)
+	require.NoError(t, err)
+	assert.Empty(t, gotCbs)
 }
@@ -0,0 +1,196 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+// AMQPConfig is the channel config of the amqp callbacks
+type AMQPConfig struct {
+	// Exchange is the exchange to publish to, empty for the default exchange
+	Exchange string `json:"exchange"`
+	// RoutingKey is the routing key of the messages, the
+	// queue name if published to the default exchange
+	RoutingKey string `json:"routing_key"`
+}
+
+// AMQPChannel publishes the messages to the broker of the receiver at the
+// callback url. The messages are published as persistent and mandatory,
+// the delivery succeeds once the broker confirms the message was routed.
+// The connections are kept open and shared by the callbacks of the same url.
+type AMQPChannel struct {
+	mu    sync.Mutex
+	conns map[string]*amqp.Connection
+}
+
+var _ Channel = (*AMQPChannel)(nil)
+
+func NewAMQPChannel() *AMQPChannel {
+	return &AMQPChannel{conns: make(map[string]*amqp.Connection)}
+}
+
+// conn returns the open connection to the url, dialing if there's none
+func (ac *AMQPChannel) conn(addr string) (*amqp.Connection, error) {
+	ac.mu.Lock()
+	conn, ok := ac.conns[addr]
+	ac.mu.Unlock()
+	if ok && !conn.IsClosed() {
+		return conn, nil
+	}
+
+	// Dial without holding the lock so that an unreachable
+	// broker doesn't block the deliveries to the other brokers
+	conn, err := amqp.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	// Keep the connection that was dialed concurrently
+	if other, ok := ac.conns[addr]; ok && !other.IsClosed() {
+		_ = conn.Close()
+		return other, nil
+	}
+	ac.conns[addr] = conn
+
+	return conn, nil
+}
+
+// discard closes the connection so that the next message dials again
+func (ac *AMQPChannel) discard(addr string, conn *amqp.Connection) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.conns[addr] == conn {
+		delete(ac.conns, addr)
+	}
+	_ = conn.Close()
+}
+
+// Close closes all the connections
+func (ac *AMQPChannel) Close() error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	var err error
+	for addr, conn := range ac.conns {
+		if cerr := conn.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(ac.conns, addr)
+	}
+
+	return err
+}
+
+func (ac *AMQPChannel) Validate(cb callback.Callback) error {
+	if cb.URL == "" {
+		return callback.ErrCallbackURLNotSet
+	}
+
+	u, err := url.Parse(cb.URL)
+	if err != nil || (u.Scheme != "amqp" && u.Scheme != "amqps") || u.Host == "" {
+		return callback.ErrInvalidChannelConfig
+	}
+
+	cfg, err := parseAMQPConfig(cb.ChannelConfig)
+	if err != nil {
+		return callback.ErrInvalidChannelConfig
+	}
+
+	// The default exchange routes by queue name
+	if cfg.Exchange == "" && cfg.RoutingKey == "" {
+		return callback.ErrInvalidChannelConfig
+	}
+
+	return nil
+}
+
+func parseAMQPConfig(b json.RawMessage) (*AMQPConfig, error) {
+	var cfg AMQPConfig
+	if len(b) == 0 {
+		return &cfg, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (ac *AMQPChannel) Send(ctx context.Context, cb callback.Callback, msg Message) (*Result, error) {
+	cfg, err := parseAMQPConfig(cb.ChannelConfig)
+	if err != nil {
+		return nil, &DeliveryError{Err: errors.Wrap(err, "parse config"), Permanent: true}
+	}
+
+	conn, err := ac.conn(cb.URL)
+	if err != nil {
+		return nil, &DeliveryError{Err: errors.Wrap(err, "dial")}
+	}
+
+	// Channels are cheap, each message gets its own so that
+	// the confirmations and returns are not mixed up
+	ch, err := conn.Channel()
+	if err != nil {
+		ac.discard(cb.URL, conn)
+		return nil, &DeliveryError{Err: errors.Wrap(err, "open channel")}
+	}
+	defer ch.Close()
+
+	err = ch.Confirm(false)
+	if err != nil {
+		return nil, &DeliveryError{Err: errors.Wrap(err, "confirm mode")}
+	}
+
+	// The broker returns the unroutable messages before confirming them
+	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+
+	err = ch.Publish(cfg.Exchange, cfg.RoutingKey, true, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         msg.Body,
+	})
+	if err != nil {
+		return nil, &DeliveryError{Err: errors.Wrap(err, "publish")}
+	}
+
+	select {
+	case confirm := <-confirms:
+		if !confirm.Ack {
+			return nil, &DeliveryError{Err: errors.New("message rejected by the broker")}
+		}
+	case <-ctx.Done():
+		return nil, &DeliveryError{Err: ctx.Err()}
+	}
+
+	select {
+	case ret := <-returns:
+		// Retried in case the receiver binds the queue later
+		return nil, &DeliveryError{Err: errors.Errorf("message not routed: %s", ret.ReplyText)}
+	default:
+	}
+
+	return &Result{}, nil
+}
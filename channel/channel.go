@@ -0,0 +1,64 @@
+// Package channel implements the delivery channels of the callbacks.
+//
+// A channel delivers the notification messages to the receivers of a kind
+// of callback e.g. webhooks are sent as HTTP requests while the amqp
+// callbacks are published to the broker of the receiver. The processor
+// dispatches the messages through the channel registry.
+package channel
+
+import (
+	"context"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+const (
+	Webhook callback.ChannelKind = "webhook"
+	AMQP    callback.ChannelKind = "amqp"
+	Email   callback.ChannelKind = "email"
+	Inbox   callback.ChannelKind = "inbox"
+	Stream  callback.ChannelKind = "stream"
+)
+
+// Message is the notification message to deliver
+type Message struct {
+	// ID is the delivery id, the same across the retries
+	ID string
+	// CBType is the callback type of the notification
+	CBType callback.CBType
+	// Body is the rendered payload
+	Body []byte
+	// Headers are the message metadata e.g. the signatures
+	Headers map[string]string
+}
+
+// Result is the outcome of the delivery
+type Result struct {
+	// StatusCode is the response status, 0 if the channel has no statuses
+	StatusCode int
+	// Body is the response body, if any
+	Body []byte
+}
+
+// Channel delivers the messages to the callbacks of a kind
+type Channel interface {
+	// Validate validates the channel settings of the callback
+	Validate(callback.Callback) error
+	// Send delivers the message to the callback. The delivery failures
+	// implement Retryable so that the permanent failures are not retried.
+	Send(context.Context, callback.Callback, Message) (*Result, error)
+}
+
+// DeliveryError is returned when the message could not be delivered
+type DeliveryError struct {
+	Err error
+	// Permanent is set if retrying won't help
+	Permanent bool
+}
+
+func (e *DeliveryError) Error() string { return e.Err.Error() }
+
+func (e *DeliveryError) Unwrap() error { return e.Err }
+
+// Retryable reports whether the delivery can be retried
+func (e *DeliveryError) Retryable() bool { return !e.Permanent }
@@ -0,0 +1,370 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+// EmailConfig is the channel config of the email callbacks. The subject and
+// body are text/template templates with the notification payload as data.
+type EmailConfig struct {
+	// Subject is the subject template, defaults to the callback type
+	Subject string `json:"subject"`
+	// Body is the body template, defaults to the indented payload
+	Body string `json:"body"`
+}
+
+// SMTPConfig is the settings of the smtp server that sends the emails
+type SMTPConfig struct {
+	// Addr is the host:port of the smtp server
+	Addr string
+	// From is the sender address of the emails
+	From string
+	// Username and Password are the credentials for the plain auth,
+	// the auth is skipped if the username is empty
+	Username string
+	Password string
+	// RequireTLS fails the delivery if the server doesn't support STARTTLS
+	RequireTLS bool
+	// TLSConfig is the STARTTLS config, nil to verify against the server host
+	TLSConfig *tls.Config
+	// Timeout is the timeout of the whole smtp session
+	Timeout time.Duration
+	// AllowedDomains are the recipient domains that the callbacks can send
+	// to, the subdomains are not included. No email callback is allowed if
+	// empty so that the server can't be used to mail any address.
+	AllowedDomains []string
+}
+
+// DefaultSMTPTimeout is the default timeout of the smtp sessions
+const DefaultSMTPTimeout = 30 * time.Second
+
+// EmailChannel sends the messages as plain text emails to the address
+// in the callback url. The server upgrades the connection with STARTTLS
+// if it supports it. Rejections of the server (5xx replies) are permanent
+// while the temporary failures (4xx replies) and the network errors are
+// retried.
+type EmailChannel struct {
+	smtpConfig SMTPConfig
+}
+
+var _ Channel = (*EmailChannel)(nil)
+
+func NewEmailChannel(smtpConfig SMTPConfig) *EmailChannel {
+	if smtpConfig.Timeout == 0 {
+		smtpConfig.Timeout = DefaultSMTPTimeout
+	}
+
+	return &EmailChannel{smtpConfig: smtpConfig}
+}
+
+func (ec *EmailChannel) Validate(cb callback.Callback) error {
+	if cb.URL == "" {
+		return callback.ErrCallbackURLNotSet
+	}
+
+	to, err := parseRecipient(cb.URL)
+	if err != nil {
+		return callback.ErrInvalidChannelConfig
+	}
+
+	err = ec.checkRecipient(to)
+	if err != nil {
+		return fmt.Errorf("%w: %s", callback.ErrInvalidChannelConfig, err)
+	}
+
+	_, _, err = parseEmailConfig(cb.ChannelConfig)
+	if err != nil {
+		return fmt.Errorf("%w: %s", callback.ErrInvalidChannelConfig, err)
+	}
+
+	return nil
+}
+
+// parseRecipient parses the recipient address, the address
+// may be written as a mailto url e.g. mailto:billing@example.com
+func parseRecipient(urlStr string) (*mail.Address, error) {
+	addr, err := mail.ParseAddress(strings.TrimPrefix(urlStr, "mailto:"))
+	if err != nil {
+		return nil, err
+	}
+
+	return addr, nil
+}
+
+// checkRecipient checks that the domain of the recipient is allowed
+func (ec *EmailChannel) checkRecipient(to *mail.Address) error {
+	domain := to.Address[strings.LastIndex(to.Address, "@")+1:]
+	for _, allowed := range ec.smtpConfig.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return nil
+		}
+	}
+
+	return errors.Errorf("recipient domain %q is not allowed", domain)
+}
+
+// parseEmailConfig parses the email config and its subject and body templates
+func parseEmailConfig(b json.RawMessage) (*template.Template, *template.Template, error) {
+	var cfg EmailConfig
+	if len(b) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	subject, err := parseEmailTemplate("subject", cfg.Subject, `{{.cb_type}}`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := parseEmailTemplate("body", cfg.Body, `{{json .}}`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return subject, body, nil
+}
+
+var emailFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		return string(b), err
+	},
+}
+
+func parseEmailTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+
+	return template.New(name).Funcs(emailFuncs).Parse(text)
+}
+
+func (ec *EmailChannel) Send(ctx context.Context, cb callback.Callback, msg Message) (*Result, error) {
+	to, err := parseRecipient(cb.URL)
+	if err != nil {
+		return nil, &DeliveryError{Err: errors.Wrap(err, "parse recipient"), Permanent: true}
+	}
+
+	// The allowed domains may have changed since the callback was created
+	err = ec.checkRecipient(to)
+	if err != nil {
+		return nil, &DeliveryError{Err: err, Permanent: true}
+	}
+
+	email, err := ec.compose(cb, to, msg)
+	if err != nil {
+		// Rendering is deterministic so retrying won't help
+		return nil, &DeliveryError{Err: errors.Wrap(err, "compose email"), Permanent: true}
+	}
+
+	err = ec.sendMail(ctx, to.Address, email)
+	if err != nil {
+		return nil, newSMTPError(err)
+	}
+
+	return &Result{}, nil
+}
+
+// compose renders the email of the message, the headers of the
+// message e.g. the idempotent key are added as email headers
+func (ec *EmailChannel) compose(cb callback.Callback, to *mail.Address, msg Message) ([]byte, error) {
+	subjectTmpl, bodyTmpl, err := parseEmailConfig(cb.ChannelConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse config")
+	}
+
+	var payload map[string]interface{}
+	err = json.Unmarshal(msg.Body, &payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "json decode body")
+	}
+
+	subject := &bytes.Buffer{}
+	cbType := msg.CBType
+	if cbType == "" {
+		cbType = cb.CBType
+	}
+
+	err = subjectTmpl.Execute(subject, withCBType(payload, cbType))
+	if err != nil {
+		return nil, errors.Wrap(err, "render subject")
+	}
+
+	body := &bytes.Buffer{}
+	err = bodyTmpl.Execute(body, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "render body")
+	}
+
+	headers := map[string]string{}
+	for key, value := range msg.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(key)] = value
+	}
+
+	headers["From"] = ec.smtpConfig.From
+	headers["To"] = to.String()
+	// Line breaks would start new headers
+	headers["Subject"] = mime.QEncoding.Encode("utf-8",
+		strings.Join(strings.Fields(subject.String()), " "))
+	headers["Date"] = time.Now().Format(time.RFC1123Z)
+	headers["MIME-Version"] = "1.0"
+	headers["Content-Type"] = "text/plain; charset=utf-8"
+	headers["Content-Transfer-Encoding"] = "quoted-printable"
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	email := &bytes.Buffer{}
+	for _, key := range keys {
+		fmt.Fprintf(email, "%s: %s\r\n", key, headers[key])
+	}
+	email.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(email)
+	_, err = qp.Write(body.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "encode body")
+	}
+
+	err = qp.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "encode body")
+	}
+
+	return email.Bytes(), nil
+}
+
+// withCBType returns a copy of the payload with the callback type
+// so that it can be used in the subject e.g. {{.cb_type}}
+func withCBType(payload map[string]interface{}, cbType callback.CBType) map[string]interface{} {
+	data := make(map[string]interface{}, len(payload)+1)
+	for name, value := range payload {
+		data[name] = value
+	}
+
+	if _, ok := data["cb_type"]; !ok {
+		data["cb_type"] = string(cbType)
+	}
+
+	return data
+}
+
+// sendMail sends the email through the smtp server
+func (ec *EmailChannel) sendMail(ctx context.Context, to string, email []byte) error {
+	host, _, err := net.SplitHostPort(ec.smtpConfig.Addr)
+	if err != nil {
+		return errors.Wrap(err, "split host port")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ec.smtpConfig.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", ec.smtpConfig.Addr)
+	if err != nil {
+		return errors.Wrap(err, "dial")
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return errors.Wrap(err, "set deadline")
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return errors.Wrap(err, "new client")
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsConfig := ec.smtpConfig.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+
+		err = c.StartTLS(tlsConfig)
+		if err != nil {
+			return errors.Wrap(err, "starttls")
+		}
+	} else if ec.smtpConfig.RequireTLS {
+		return errors.New("smtp server doesn't support STARTTLS")
+	}
+
+	if ec.smtpConfig.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", ec.smtpConfig.Username,
+			ec.smtpConfig.Password, host))
+		if err != nil {
+			return errors.Wrap(err, "auth")
+		}
+	}
+
+	from, err := mail.ParseAddress(ec.smtpConfig.From)
+	if err != nil {
+		return errors.Wrap(err, "parse sender")
+	}
+
+	err = c.Mail(from.Address)
+	if err != nil {
+		return errors.Wrap(err, "mail")
+	}
+
+	err = c.Rcpt(to)
+	if err != nil {
+		return errors.Wrap(err, "rcpt")
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return errors.Wrap(err, "data")
+	}
+
+	_, err = w.Write(email)
+	if err != nil {
+		return errors.Wrap(err, "write data")
+	}
+
+	err = w.Close()
+	if err != nil {
+		return errors.Wrap(err, "close data")
+	}
+
+	// The email is accepted at this point
+	_ = c.Quit()
+
+	return nil
+}
+
+// newSMTPError returns the delivery error of the smtp failure, only
+// the permanent rejections of the server (5xx replies) are not retried
+func newSMTPError(err error) *DeliveryError {
+	var protoErr *textproto.Error
+	permanent := errors.As(err, &protoErr) && protoErr.Code >= 500
+	return &DeliveryError{Err: err, Permanent: permanent}
+}
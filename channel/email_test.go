@@ -0,0 +1,372 @@
+package channel_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/channel"
+)
+
+func TestEmailChannel(t *testing.T) {
+	serverTLS, clientTLS := newTestTLSConfigs(t)
+
+	cb := callback.Callback{
+		CBType:  "INVOICE",
+		Channel: channel.Email,
+		URL:     "mailto:billing@example.com",
+		ChannelConfig: json.RawMessage(`{"subject": "Invoice {{.id}} paid",
+			"body": "Amount: {{.amount}}"}`),
+	}
+
+	// only the allowed domains can receive emails
+	allowedDomains := []string{"example.com"}
+
+	msg := channel.Message{
+		Body:    []byte(`{"id":"1234","amount":100}`),
+		Headers: map[string]string{"X-IDEMPOTENT-KEY": "idemp-1234"},
+	}
+
+	t.Run("Validate", func(t *testing.T) {
+		emailCh := channel.NewEmailChannel(channel.SMTPConfig{
+			AllowedDomains: allowedDomains,
+		})
+		require.NoError(t, emailCh.Validate(cb))
+
+		upperCb := cb
+		upperCb.URL = "billing@EXAMPLE.com"
+		assert.NoError(t, emailCh.Validate(upperCb))
+
+		invalidCb := cb
+		invalidCb.URL = "mailto:billing@example.org"
+		assert.ErrorIs(t, emailCh.Validate(invalidCb), callback.ErrInvalidChannelConfig)
+
+		invalidCb.URL = "mailto:billing@mail.example.com"
+		assert.ErrorIs(t, emailCh.Validate(invalidCb), callback.ErrInvalidChannelConfig)
+
+		// no domain is allowed by default
+		assert.ErrorIs(t, channel.NewEmailChannel(channel.SMTPConfig{}).Validate(cb),
+			callback.ErrInvalidChannelConfig)
+
+		invalidCb = cb
+		invalidCb.URL = "billing"
+		assert.ErrorIs(t, emailCh.Validate(invalidCb), callback.ErrInvalidChannelConfig)
+
+		invalidCb = cb
+		invalidCb.ChannelConfig = json.RawMessage(`{"subject": "Invoice {{.id"}`)
+		assert.ErrorIs(t, emailCh.Validate(invalidCb), callback.ErrInvalidChannelConfig)
+
+		invalidCb = cb
+		invalidCb.ChannelConfig = json.RawMessage(`{"to": "billing@example.com"}`)
+		assert.ErrorIs(t, emailCh.Validate(invalidCb), callback.ErrInvalidChannelConfig)
+
+		// the config is optional
+		invalidCb = cb
+		invalidCb.ChannelConfig = nil
+		assert.NoError(t, emailCh.Validate(invalidCb))
+	})
+
+	t.Run("Send with STARTTLS and auth", func(t *testing.T) {
+		server := newFakeSMTPServer(t, serverTLS, "250 OK")
+		emailCh := channel.NewEmailChannel(channel.SMTPConfig{
+			Addr:       server.addr,
+			From:       "Notifi <notifi@example.com>",
+			Username:   "notifi",
+			Password:   "secret",
+			RequireTLS: true,
+			TLSConfig:  clientTLS,
+
+			AllowedDomains: allowedDomains,
+		})
+
+		_, err := emailCh.Send(context.TODO(), cb, msg)
+		require.NoError(t, err)
+
+		mails := server.received()
+		require.Len(t, mails, 1)
+
+		got := mails[0]
+		assert.True(t, got.tls)
+		assert.Equal(t, "\x00notifi\x00secret", got.auth)
+		assert.Equal(t, "<notifi@example.com>", got.from)
+		assert.Equal(t, "<billing@example.com>", got.to)
+
+		email, err := mail.ReadMessage(strings.NewReader(got.data))
+		require.NoError(t, err)
+		assert.Equal(t, "Invoice 1234 paid", email.Header.Get("Subject"))
+		assert.Equal(t, "<billing@example.com>", email.Header.Get("To"))
+		assert.Equal(t, "idemp-1234", email.Header.Get("X-Idempotent-Key"))
+
+		body, err := io.ReadAll(quotedprintable.NewReader(email.Body))
+		require.NoError(t, err)
+		assert.Equal(t, "Amount: 100", strings.TrimSpace(string(body)))
+	})
+
+	t.Run("Send without config", func(t *testing.T) {
+		server := newFakeSMTPServer(t, nil, "250 OK")
+		emailCh := channel.NewEmailChannel(channel.SMTPConfig{
+			Addr: server.addr,
+			From: "notifi@example.com",
+
+			AllowedDomains: allowedDomains,
+		})
+
+		defaultCb := cb
+		defaultCb.ChannelConfig = nil
+		_, err := emailCh.Send(context.TODO(), defaultCb, msg)
+		require.NoError(t, err)
+
+		mails := server.received()
+		require.Len(t, mails, 1)
+		assert.False(t, mails[0].tls)
+		assert.Empty(t, mails[0].auth)
+
+		email, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+		require.NoError(t, err)
+		assert.Equal(t, "INVOICE", email.Header.Get("Subject"))
+
+		body, err := io.ReadAll(quotedprintable.NewReader(email.Body))
+		require.NoError(t, err)
+		assert.JSONEq(t, string(msg.Body), string(body))
+	})
+
+	t.Run("Send failures", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			tlsConfig  *tls.Config
+			rcptReply  string
+			requireTLS bool
+			retryable  bool
+		}{
+			{name: "mailbox unavailable", rcptReply: "550 mailbox unavailable"},
+			{name: "mailbox busy", rcptReply: "451 try again later", retryable: true},
+			{name: "no STARTTLS", rcptReply: "250 OK", requireTLS: true, retryable: true},
+		}
+
+		for _, tc := range tests {
+			server := newFakeSMTPServer(t, tc.tlsConfig, tc.rcptReply)
+			emailCh := channel.NewEmailChannel(channel.SMTPConfig{
+				Addr:       server.addr,
+				From:       "notifi@example.com",
+				RequireTLS: tc.requireTLS,
+
+				AllowedDomains: allowedDomains,
+			})
+
+			_, err := emailCh.Send(context.TODO(), cb, msg)
+
+			var deliveryErr *channel.DeliveryError
+			require.ErrorAs(t, err, &deliveryErr, tc.name)
+			assert.Equal(t, tc.retryable, deliveryErr.Retryable(), tc.name)
+			assert.Empty(t, server.received(), tc.name)
+		}
+
+		// the server is down
+		emailCh := channel.NewEmailChannel(channel.SMTPConfig{
+			Addr:    "127.0.0.1:1",
+			From:    "notifi@example.com",
+			Timeout: time.Second,
+
+			AllowedDomains: allowedDomains,
+		})
+
+		_, err := emailCh.Send(context.TODO(), cb, msg)
+
+		var deliveryErr *channel.DeliveryError
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.True(t, deliveryErr.Retryable())
+
+		// the domain is no longer allowed
+		server := newFakeSMTPServer(t, nil, "250 OK")
+		emailCh = channel.NewEmailChannel(channel.SMTPConfig{
+			Addr: server.addr,
+			From: "notifi@example.com",
+		})
+
+		_, err = emailCh.Send(context.TODO(), cb, msg)
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.False(t, deliveryErr.Retryable())
+		assert.Empty(t, server.received())
+	})
+}
+
+// receivedMail is an email received by the fake smtp server
+type receivedMail struct {
+	tls  bool
+	auth string
+	from string
+	to   string
+	data string
+}
+
+// fakeSMTPServer is a minimal smtp server that records the received emails
+type fakeSMTPServer struct {
+	addr      string
+	tlsConfig *tls.Config
+	rcptReply string
+
+	mu    sync.Mutex
+	mails []receivedMail
+}
+
+// newFakeSMTPServer starts a fake smtp server, STARTTLS is
+// only supported if tlsConfig is set. The recipients are
+// answered with rcptReply e.g. "550 mailbox unavailable".
+func newFakeSMTPServer(t *testing.T, tlsConfig *tls.Config, rcptReply string) *fakeSMTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	server := &fakeSMTPServer{
+		addr:      ln.Addr().String(),
+		tlsConfig: tlsConfig,
+		rcptReply: rcptReply,
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeSMTPServer) received() []receivedMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mails
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	var m receivedMail
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			_ = tp.PrintfLine("500 empty command")
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "EHLO":
+			exts := []string{"localhost"}
+			if s.tlsConfig != nil && !m.tls {
+				exts = append(exts, "STARTTLS")
+			}
+			exts = append(exts, "AUTH PLAIN")
+
+			for i, ext := range exts {
+				sep := "-"
+				if i == len(exts)-1 {
+					sep = " "
+				}
+				_ = tp.PrintfLine("250%s%s", sep, ext)
+			}
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+
+			conn, tp, m.tls = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			auth, err := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			if err != nil {
+				_ = tp.PrintfLine("501 invalid auth")
+				continue
+			}
+
+			m.auth = string(auth)
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			m.from = strings.TrimPrefix(line[len("MAIL "):], "FROM:")
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			m.to = strings.TrimPrefix(line[len("RCPT "):], "TO:")
+			_ = tp.PrintfLine(s.rcptReply)
+		case "DATA":
+			_ = tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+
+			m.data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, m)
+			s.mu.Unlock()
+			_ = tp.PrintfLine("250 OK queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// newTestTLSConfigs returns the tls configs of a self-signed certificate for 127.0.0.1
+func newTestTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	serverTLS := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+
+	return serverTLS, &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+}
@@ -0,0 +1,56 @@
+package channel
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/inbox"
+)
+
+// InboxChannel stores the messages in the inbox of the receiver instead of
+// pushing them. It's meant for the receivers that can't expose a callback
+// url, they pull the messages through the inbox api instead.
+type InboxChannel struct {
+	inboxRepo inbox.Repository
+	// kind is the channel of the stored items
+	kind callback.ChannelKind
+}
+
+var _ Channel = (*InboxChannel)(nil)
+
+func NewInboxChannel(inboxRepo inbox.Repository) *InboxChannel {
+	return &InboxChannel{inboxRepo: inboxRepo, kind: Inbox}
+}
+
+func (ic *InboxChannel) Validate(cb callback.Callback) error {
+	// The inbox belongs to the token of the callback
+	if cb.URL != "" || len(cb.ChannelConfig) > 0 {
+		return callback.ErrInvalidChannelConfig
+	}
+
+	return nil
+}
+
+func (ic *InboxChannel) Send(ctx context.Context, cb callback.Callback, msg Message) (*Result, error) {
+	cbType := msg.CBType
+	if cbType == "" {
+		cbType = cb.CBType
+	}
+
+	err := ic.inboxRepo.CreateItem(ctx, inbox.Item{
+		ID:         inbox.NewID(),
+		TokenID:    cb.TokenID,
+		DeliveryID: msg.ID,
+		CBType:     cbType,
+		Channel:    ic.kind,
+		Body:       msg.Body,
+		Headers:    msg.Headers,
+	})
+	if err != nil {
+		return nil, &DeliveryError{Err: errors.Wrap(err, "create inbox item")}
+	}
+
+	return &Result{}, nil
+}
@@ -0,0 +1,63 @@
+package channel
+
+import (
+	"context"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/notifihttp"
+)
+
+// Registry is the set of the available channels
+type Registry struct {
+	channels map[callback.ChannelKind]Channel
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{channels: map[callback.ChannelKind]Channel{}}
+}
+
+// NewDefaultRegistry returns a registry with the webhook channel
+func NewDefaultRegistry(requestSender notifihttp.RequestSender) *Registry {
+	return NewRegistry().Register(Webhook, NewWebhookChannel(requestSender))
+}
+
+// Register adds the channel of the kind, replacing the existing one
+func (r *Registry) Register(kind callback.ChannelKind, ch Channel) *Registry {
+	r.channels[kind] = ch
+	return r
+}
+
+// Get returns the channel of the kind, callbacks without kind are webhooks
+func (r *Registry) Get(kind callback.ChannelKind) (Channel, error) {
+	if kind == "" {
+		kind = Webhook
+	}
+
+	ch, ok := r.channels[kind]
+	if !ok {
+		return nil, callback.ErrInvalidChannel
+	}
+
+	return ch, nil
+}
+
+// Validate validates the channel settings of the callback
+func (r *Registry) Validate(cb callback.Callback) error {
+	ch, err := r.Get(cb.Channel)
+	if err != nil {
+		return err
+	}
+
+	return ch.Validate(cb)
+}
+
+// Send delivers the message through the channel of the callback
+func (r *Registry) Send(ctx context.Context, cb callback.Callback, msg Message) (*Result, error) {
+	ch, err := r.Get(cb.Channel)
+	if err != nil {
+		return nil, &DeliveryError{Err: err, Permanent: true}
+	}
+
+	return ch.Send(ctx, cb, msg)
+}
@@ -0,0 +1,43 @@
+package channel
+
+import (
+	"context"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/inbox"
+	"github.com/stevenferrer/notifi/stream"
+)
+
+// StreamChannel pushes the messages to the streams of the receiver. The
+// messages are stored as the stream items of the receiver and the connected
+// streams are woken up to send them. The messages are streamed once the
+// receiver connects if it isn't connected. The stream items are separate
+// from the inbox items so the inbox api doesn't take them from the streams.
+type StreamChannel struct {
+	inbox *InboxChannel
+	hub   *stream.Hub
+}
+
+var _ Channel = (*StreamChannel)(nil)
+
+func NewStreamChannel(inboxRepo inbox.Repository, hub *stream.Hub) *StreamChannel {
+	return &StreamChannel{
+		inbox: &InboxChannel{inboxRepo: inboxRepo, kind: Stream},
+		hub:   hub,
+	}
+}
+
+func (sc *StreamChannel) Validate(cb callback.Callback) error {
+	return sc.inbox.Validate(cb)
+}
+
+func (sc *StreamChannel) Send(ctx context.Context, cb callback.Callback, msg Message) (*Result, error) {
+	result, err := sc.inbox.Send(ctx, cb, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	sc.hub.Publish(cb.TokenID)
+
+	return result, nil
+}
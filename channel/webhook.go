@@ -0,0 +1,56 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/notifihttp"
+)
+
+// WebhookChannel sends the messages as HTTP POST requests to the callback url.
+// The delivery succeeds if the response status is accepted by the callback.
+type WebhookChannel struct {
+	requestSender notifihttp.RequestSender
+}
+
+var _ Channel = (*WebhookChannel)(nil)
+
+func NewWebhookChannel(requestSender notifihttp.RequestSender) *WebhookChannel {
+	return &WebhookChannel{requestSender: requestSender}
+}
+
+func (wc *WebhookChannel) Validate(cb callback.Callback) error {
+	if cb.URL == "" {
+		return callback.ErrCallbackURLNotSet
+	}
+
+	u, err := url.Parse(cb.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return callback.ErrInvalidChannelConfig
+	}
+
+	// Webhooks are configured through the url
+	if len(cb.ChannelConfig) > 0 {
+		return callback.ErrInvalidChannelConfig
+	}
+
+	return nil
+}
+
+func (wc *WebhookChannel) Send(ctx context.Context, cb callback.Callback, msg Message) (*Result, error) {
+	resp, err := wc.requestSender.SendRequest(ctx, notifihttp.Request{
+		URL:              cb.URL,
+		Body:             bytes.NewReader(msg.Body),
+		Headers:          msg.Headers,
+		AcceptedStatuses: cb.AcceptedStatuses,
+	})
+
+	var result *Result
+	if resp != nil {
+		result = &Result{StatusCode: resp.StatusCode, Body: resp.Body}
+	}
+
+	return result, err
+}
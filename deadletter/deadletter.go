@@ -0,0 +1,54 @@
+package deadletter
+
+import (
+	"time"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/notif"
+	"github.com/stevenferrer/notifi/token"
+)
+
+// ID is the dead letter ID
+type ID string
+
+const (
+	NilID ID = ""
+)
+
+// DeadLetter is a notification message that couldn't be delivered
+type DeadLetter struct {
+	// ID is the dead letter ID
+	ID ID
+	// NotifID is the notification id, empty if the message can't be decoded
+	NotifID notif.ID
+	// DestTokenID is the token id of notif receiver
+	DestTokenID token.ID
+	// CBType is the callback type
+	CBType callback.CBType
+	// Reason is the reason why the message was dead lettered
+	Reason string
+	// Body is the raw message body
+	Body []byte
+	// CreatedAt is the created timestamp
+	CreatedAt time.Time
+}
+
+// Filter filters the dead letters, zero values are ignored
+type Filter struct {
+	// DestTokenID is the token id of notif receiver
+	DestTokenID token.ID
+	// CBType is the callback type
+	CBType callback.CBType
+	// From is the inclusive start of the created timestamp
+	From *time.Time
+	// To is the exclusive end of the created timestamp
+	To *time.Time
+	// Limit is the max number of dead letters, 0 means no limit
+	Limit int
+}
+
+// IsEmpty reports whether the filter matches all dead letters
+func (f Filter) IsEmpty() bool {
+	return f.DestTokenID == "" && f.CBType == "" &&
+		f.From == nil && f.To == nil
+}
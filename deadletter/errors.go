@@ -0,0 +1,9 @@
+package deadletter
+
+import "errors"
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrNotReplayable      = errors.New("dead letter is not replayable")
+	ErrEmptyFilter        = errors.New("empty filter, set all=true to match all dead letters")
+)
@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unrolled/render"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/deadletter"
+	"github.com/stevenferrer/notifi/notif"
+	"github.com/stevenferrer/notifi/notifihttp"
+	"github.com/stevenferrer/notifi/token"
+)
+
+// defaultLimit is the default max number of listed dead letters
+const defaultLimit = 100
+
+type deadLetterHandler struct {
+	deadLetterSvc deadletter.Service
+	mux           *chi.Mux
+	render        *render.Render
+	logger        zerolog.Logger
+}
+
+// NewDeadLetterHandler returns the admin handler for the dead letters
+func NewDeadLetterHandler(deadLetterSvc deadletter.Service, logger zerolog.Logger) http.Handler {
+	dlh := &deadLetterHandler{
+		deadLetterSvc: deadLetterSvc,
+		mux:           chi.NewMux(),
+		render:        render.New(),
+		logger:        logger,
+	}
+
+	// helper for adding http route
+	addRoute := func(method, pattern string, h notifihttp.Handler) {
+		dlh.mux.Method(method, pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := h.ServeHTTP(w, r)
+			if err != nil {
+				dlh.handleError(w, r, err)
+			}
+		}))
+	}
+
+	addRoute(http.MethodGet, "/", listDeadLetters(dlh))
+	addRoute(http.MethodDelete, "/", purgeDeadLetters(dlh))
+	addRoute(http.MethodPost, "/replay", replayDeadLetters(dlh))
+	addRoute(http.MethodGet, "/{dead_letter_id}", getDeadLetter(dlh))
+	addRoute(http.MethodDelete, "/{dead_letter_id}", purgeDeadLetter(dlh))
+	addRoute(http.MethodPost, "/{dead_letter_id}/replay", replayDeadLetter(dlh))
+
+	return dlh
+}
+
+func (dlh *deadLetterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dlh.mux.ServeHTTP(w, r)
+}
+
+func (dlh *deadLetterHandler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	dlh.logger.Error().Err(err).Msg("dead letter handler error")
+
+	apiErr := notifihttp.NewInternalServerError(err)
+	if e, ok := err.(*notifihttp.Error); ok {
+		apiErr = e
+	}
+
+	w.WriteHeader(apiErr.Status)
+	err = json.NewEncoder(w).Encode(apiErr)
+	if err != nil {
+		dlh.logger.Error().Err(err).Msg("json encode")
+	}
+}
+
+// parseFilter parses the filter from the query params
+func parseFilter(query url.Values) (deadletter.Filter, error) {
+	filter := deadletter.Filter{
+		DestTokenID: token.ID(query.Get("dest_token_id")),
+		CBType:      callback.CBType(query.Get("callback_type")),
+	}
+
+	parseTime := func(key string) (*time.Time, error) {
+		value := query.Get(key)
+		if value == "" {
+			return nil, nil
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s", key)
+		}
+
+		return &t, nil
+	}
+
+	var err error
+	filter.From, err = parseTime("from")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.To, err = parseTime("to")
+	if err != nil {
+		return filter, err
+	}
+
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 0 {
+			return filter, errors.New("invalid limit")
+		}
+	}
+
+	return filter, nil
+}
+
+type deadLetterResponse struct {
+	ID          deadletter.ID   `json:"dead_letter_id"`
+	NotifID     notif.ID        `json:"notification_id"`
+	DestTokenID token.ID        `json:"dest_token_id"`
+	CBType      callback.CBType `json:"callback_type"`
+	Reason      string          `json:"reason"`
+	Message     string          `json:"message"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+func newDeadLetterResponse(dl deadletter.DeadLetter) deadLetterResponse {
+	return deadLetterResponse{
+		ID:          dl.ID,
+		NotifID:     dl.NotifID,
+		DestTokenID: dl.DestTokenID,
+		CBType:      dl.CBType,
+		Reason:      dl.Reason,
+		Message:     string(dl.Body),
+		CreatedAt:   dl.CreatedAt,
+	}
+}
+
+type listDeadLettersResponse struct {
+	DeadLetters []deadLetterResponse `json:"dead_letters"`
+}
+
+func listDeadLetters(dlh *deadLetterHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		if filter.Limit == 0 {
+			filter.Limit = defaultLimit
+		}
+
+		deadLetters, err := dlh.deadLetterSvc.ListDeadLetters(r.Context(), filter)
+		if err != nil {
+			return errors.Wrap(err, "list dead letters")
+		}
+
+		response := listDeadLettersResponse{DeadLetters: []deadLetterResponse{}}
+		for _, dl := range deadLetters {
+			response.DeadLetters = append(response.DeadLetters, newDeadLetterResponse(dl))
+		}
+
+		return dlh.render.JSON(w, http.StatusOK, response)
+	})
+}
+
+func getDeadLetter(dlh *deadLetterHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		dlID := deadletter.ID(chi.URLParam(r, "dead_letter_id"))
+		dl, err := dlh.deadLetterSvc.GetDeadLetter(r.Context(), dlID)
+		if err != nil {
+			if err == deadletter.ErrDeadLetterNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "get dead letter")
+		}
+
+		return dlh.render.JSON(w, http.StatusOK, newDeadLetterResponse(*dl))
+	})
+}
+
+func replayDeadLetter(dlh *deadLetterHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		dlID := deadletter.ID(chi.URLParam(r, "dead_letter_id"))
+		err := dlh.deadLetterSvc.ReplayDeadLetter(r.Context(), dlID)
+		if err != nil {
+			switch err {
+			case deadletter.ErrDeadLetterNotFound:
+				return notifihttp.NewNotFoundError(err)
+			case deadletter.ErrNotReplayable:
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return errors.Wrap(err, "replay dead letter")
+		}
+
+		return dlh.render.JSON(w, http.StatusOK, map[string]string{
+			"message": "replay ok",
+		})
+	})
+}
+
+type bulkResponse struct {
+	Count int `json:"count"`
+}
+
+func replayDeadLetters(dlh *deadLetterHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		count, err := dlh.deadLetterSvc.ReplayDeadLetters(r.Context(), filter)
+		if err != nil {
+			return errors.Wrap(err, "replay dead letters")
+		}
+
+		return dlh.render.JSON(w, http.StatusOK, bulkResponse{Count: count})
+	})
+}
+
+func purgeDeadLetter(dlh *deadLetterHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		dlID := deadletter.ID(chi.URLParam(r, "dead_letter_id"))
+		err := dlh.deadLetterSvc.PurgeDeadLetter(r.Context(), dlID)
+		if err != nil {
+			if err == deadletter.ErrDeadLetterNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "purge dead letter")
+		}
+
+		return dlh.render.JSON(w, http.StatusOK, map[string]string{
+			"message": "purge ok",
+		})
+	})
+}
+
+func purgeDeadLetters(dlh *deadLetterHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		// Purging the whole queue must be explicit
+		if filter.IsEmpty() && r.URL.Query().Get("all") != "true" {
+			return notifihttp.NewBadRequestError(deadletter.ErrEmptyFilter)
+		}
+
+		count, err := dlh.deadLetterSvc.PurgeDeadLetters(r.Context(), filter)
+		if err != nil {
+			return errors.Wrap(err, "purge dead letters")
+		}
+
+		return dlh.render.JSON(w, http.StatusOK, bulkResponse{Count: count})
+	})
+}
@@ -0,0 +1,127 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/deadletter"
+	dlhandler "github.com/stevenferrer/notifi/deadletter/handler"
+	"github.com/stevenferrer/notifi/notif"
+	"github.com/stevenferrer/notifi/notifihttp"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/token"
+)
+
+func TestDeadLetterHandler(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	notifRepo := postgres.NewNotifRepository(db)
+	deadLetterRepo := postgres.NewDeadLetterRepository(db)
+	deadLetterSvc := deadletter.NewDeadLetterService(deadLetterRepo,
+		notifRepo, &notif.NopSender{})
+
+	const adminKey = "secret"
+	logger := zerolog.New(os.Stderr)
+	adminMw := notifihttp.NewAdminMw(adminKey)
+	handler := adminMw(dlhandler.NewDeadLetterHandler(deadLetterSvc, logger))
+
+	ctx := context.TODO()
+
+	tokenID := token.NewID()
+	dl := deadletter.DeadLetter{
+		ID:          deadletter.NewID(),
+		NotifID:     notif.NewID(),
+		DestTokenID: tokenID,
+		CBType:      "INVOICE",
+		Reason:      "retry policy exhausted",
+		Body:        []byte(`garbage`),
+	}
+	err := deadLetterRepo.CreateDeadLetter(ctx, dl)
+	require.NoError(t, err)
+
+	serve := func(method, target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-ADMIN-KEY", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/", "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = serve(http.MethodGet, "/", "wrong")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("List dead letters", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/?dest_token_id="+string(tokenID), adminKey)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response struct {
+			DeadLetters []struct {
+				ID      deadletter.ID `json:"dead_letter_id"`
+				Reason  string        `json:"reason"`
+				Message string        `json:"message"`
+			} `json:"dead_letters"`
+		}
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		require.NoError(t, err)
+
+		require.Len(t, response.DeadLetters, 1)
+		assert.Equal(t, dl.ID, response.DeadLetters[0].ID)
+		assert.Equal(t, dl.Reason, response.DeadLetters[0].Reason)
+		assert.Equal(t, string(dl.Body), response.DeadLetters[0].Message)
+
+		rr = serve(http.MethodGet, "/?from=yesterday", adminKey)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Get dead letter", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/"+string(dl.ID), adminKey)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = serve(http.MethodGet, "/"+string(deadletter.NewID()), adminKey)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Replay dead letter", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/"+string(dl.ID)+"/replay", adminKey)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Purge dead letters", func(t *testing.T) {
+		rr := serve(http.MethodDelete, "/", adminKey)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = serve(http.MethodDelete, "/?limit=10", adminKey)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = serve(http.MethodDelete, "/?callback_type=INVOICE", adminKey)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response struct {
+			Count int `json:"count"`
+		}
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		require.NoError(t, err)
+		assert.Equal(t, 1, response.Count)
+
+		rr = serve(http.MethodDelete, "/?all=true", adminKey)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
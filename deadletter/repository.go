@@ -0,0 +1,13 @@
+package deadletter
+
+import "context"
+
+// Repository is the dead letter repository
+type Repository interface {
+	CreateDeadLetter(context.Context, DeadLetter) error
+	GetDeadLetter(context.Context, ID) (*DeadLetter, error)
+	ListDeadLetters(context.Context, Filter) ([]DeadLetter, error)
+	DeleteDeadLetter(context.Context, ID) error
+	// DeleteDeadLetters deletes the matching dead letters and returns the number deleted
+	DeleteDeadLetters(context.Context, Filter) (int, error)
+}
@@ -0,0 +1,154 @@
+package deadletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/notif"
+)
+
+// Service is the dead letter service
+type Service interface {
+	GetDeadLetter(context.Context, ID) (*DeadLetter, error)
+	ListDeadLetters(context.Context, Filter) ([]DeadLetter, error)
+	ReplayDeadLetter(context.Context, ID) error
+	ReplayDeadLetters(context.Context, Filter) (int, error)
+	PurgeDeadLetter(context.Context, ID) error
+	PurgeDeadLetters(context.Context, Filter) (int, error)
+}
+
+// DeadLetterService implements the dead letter service
+type DeadLetterService struct {
+	deadLetterRepo Repository
+	notifRepo      notif.Repository
+	sender         notif.Sender
+}
+
+var _ Service = (*DeadLetterService)(nil)
+
+func NewDeadLetterService(deadLetterRepo Repository,
+	notifRepo notif.Repository, sender notif.Sender) *DeadLetterService {
+	return &DeadLetterService{
+		deadLetterRepo: deadLetterRepo,
+		notifRepo:      notifRepo,
+		sender:         sender,
+	}
+}
+
+func (dls *DeadLetterService) GetDeadLetter(ctx context.Context, dlID ID) (*DeadLetter, error) {
+	dl, err := dls.deadLetterRepo.GetDeadLetter(ctx, dlID)
+	if err != nil {
+		if err == ErrDeadLetterNotFound {
+			return nil, err
+		}
+
+		return nil, errors.Wrap(err, "get dead letter")
+	}
+
+	return dl, nil
+}
+
+func (dls *DeadLetterService) ListDeadLetters(ctx context.Context, filter Filter) ([]DeadLetter, error) {
+	deadLetters, err := dls.deadLetterRepo.ListDeadLetters(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "list dead letters")
+	}
+
+	return deadLetters, nil
+}
+
+// ReplayDeadLetter sends the notification back to the queue
+// with a fresh retry count and removes the dead letter
+func (dls *DeadLetterService) ReplayDeadLetter(ctx context.Context, dlID ID) error {
+	dl, err := dls.GetDeadLetter(ctx, dlID)
+	if err != nil {
+		return err
+	}
+
+	return dls.replay(ctx, *dl)
+}
+
+// ReplayDeadLetters replays the matching dead letters and returns the number replayed
+func (dls *DeadLetterService) ReplayDeadLetters(ctx context.Context, filter Filter) (int, error) {
+	deadLetters, err := dls.ListDeadLetters(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, dl := range deadLetters {
+		err = dls.replay(ctx, dl)
+		if err != nil {
+			// skip the messages that can't be replayed
+			if err == ErrNotReplayable {
+				continue
+			}
+
+			return replayed, errors.Wrapf(err, "replay dead letter %s", dl.ID)
+		}
+
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+func (dls *DeadLetterService) replay(ctx context.Context, dl DeadLetter) error {
+	var notifMsg notif.NotifMsg
+	err := json.NewDecoder(bytes.NewReader(dl.Body)).Decode(&notifMsg)
+	if err != nil || notifMsg.NotifID == notif.NilID {
+		return ErrNotReplayable
+	}
+
+	err = notif.UpdateMsgStatus(ctx, dls.notifRepo, notifMsg, notif.StatusPending)
+	if err != nil {
+		if errors.Cause(err) == notif.ErrNotifNotFound ||
+			errors.Cause(err) == notif.ErrDeliveryNotFound {
+			return ErrNotReplayable
+		}
+
+		return err
+	}
+
+	// start over
+	notifMsg.RetryCount = 0
+	notifMsg.CreatedAt = time.Now()
+
+	err = dls.sender.Send(ctx, notifMsg)
+	if err != nil {
+		return errors.Wrap(err, "send notif message to queue")
+	}
+
+	err = dls.deadLetterRepo.DeleteDeadLetter(ctx, dl.ID)
+	if err != nil {
+		return errors.Wrap(err, "delete dead letter")
+	}
+
+	return nil
+}
+
+func (dls *DeadLetterService) PurgeDeadLetter(ctx context.Context, dlID ID) error {
+	err := dls.deadLetterRepo.DeleteDeadLetter(ctx, dlID)
+	if err != nil {
+		if err == ErrDeadLetterNotFound {
+			return err
+		}
+
+		return errors.Wrap(err, "delete dead letter")
+	}
+
+	return nil
+}
+
+func (dls *DeadLetterService) PurgeDeadLetters(ctx context.Context, filter Filter) (int, error) {
+	deleted, err := dls.deadLetterRepo.DeleteDeadLetters(ctx, filter)
+	if err != nil {
+		return 0, errors.Wrap(err, "delete dead letters")
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,125 @@
+package deadletter_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/deadletter"
+	"github.com/stevenferrer/notifi/notif"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/token"
+)
+
+func TestDeadLetterService(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	tokenRepo := postgres.NewTokenRepository(db)
+	callbackRepo := postgres.NewCallbackRepository(db)
+	notifRepo := postgres.NewNotifRepository(db)
+	deadLetterRepo := postgres.NewDeadLetterRepository(db)
+	deadLetterSvc := deadletter.NewDeadLetterService(deadLetterRepo,
+		notifRepo, &notif.NopSender{})
+
+	ctx := context.TODO()
+
+	// create token
+	tk := token.Token{
+		ID:    token.NewID(),
+		CBKey: token.NewCBKey(),
+	}
+	err := tokenRepo.CreateToken(ctx, tk)
+	require.NoError(t, err)
+
+	// create callback
+	cb := callback.Callback{
+		ID:      callback.NewID(),
+		TokenID: tk.ID,
+		CBType:  "INVOICE",
+		URL:     "https://example.com",
+	}
+	err = callbackRepo.CreateCallback(ctx, cb)
+	require.NoError(t, err)
+
+	// create dead notif
+	nf := notif.Notif{
+		ID:          notif.NewID(),
+		SrcTokenID:  tk.ID,
+		DestTokenID: tk.ID,
+		CBType:      cb.CBType,
+		Status:      notif.StatusDead,
+		Payload:     map[string]interface{}{"id": "1234"},
+	}
+	err = notifRepo.CreateNotif(ctx, nf)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = json.NewEncoder(buf).Encode(notif.NotifMsg{
+		NotifID:     nf.ID,
+		DestTokenID: nf.DestTokenID,
+		CBType:      nf.CBType,
+		Payload:     nf.Payload,
+		RetryCount:  25,
+	})
+	require.NoError(t, err)
+
+	dl := deadletter.DeadLetter{
+		ID:          deadletter.NewID(),
+		NotifID:     nf.ID,
+		DestTokenID: nf.DestTokenID,
+		CBType:      nf.CBType,
+		Reason:      "retry policy exhausted",
+		Body:        buf.Bytes(),
+	}
+	err = deadLetterRepo.CreateDeadLetter(ctx, dl)
+	require.NoError(t, err)
+
+	// undecodable message
+	garbage := deadletter.DeadLetter{
+		ID:     deadletter.NewID(),
+		Reason: "json decode message",
+		Body:   []byte("garbage"),
+	}
+	err = deadLetterRepo.CreateDeadLetter(ctx, garbage)
+	require.NoError(t, err)
+
+	t.Run("replay", func(t *testing.T) {
+		err := deadLetterSvc.ReplayDeadLetter(ctx, garbage.ID)
+		assert.Equal(t, deadletter.ErrNotReplayable, err)
+
+		err = deadLetterSvc.ReplayDeadLetter(ctx, deadletter.NewID())
+		assert.Equal(t, deadletter.ErrDeadLetterNotFound, err)
+
+		replayed, err := deadLetterSvc.ReplayDeadLetters(ctx, deadletter.Filter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, replayed)
+
+		// notification is pending again
+		gotNf, err := notifRepo.GetNotif(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusPending, gotNf.Status)
+
+		// replayed dead letter is removed
+		_, err = deadLetterSvc.GetDeadLetter(ctx, dl.ID)
+		assert.Equal(t, deadletter.ErrDeadLetterNotFound, err)
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		err := deadLetterSvc.PurgeDeadLetter(ctx, garbage.ID)
+		require.NoError(t, err)
+
+		deadLetters, err := deadLetterSvc.ListDeadLetters(ctx, deadletter.Filter{})
+		require.NoError(t, err)
+		assert.Len(t, deadLetters, 0)
+	})
+}
@@ -0,0 +1,110 @@
+package deadletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/streadway/amqp"
+
+	"github.com/stevenferrer/notifi/notif"
+)
+
+// DeadLetterWorker moves the messages in the dead
+// letter queue to the repository for inspection
+type DeadLetterWorker struct {
+	ch             *amqp.Channel
+	doneChan       chan bool
+	deadLetterRepo Repository
+	logger         zerolog.Logger
+}
+
+// NewDeadLetterWorker returns a new DeadLetterWorker. The dead letter
+// queue is declared by notif.NewNotifWorker.
+func NewDeadLetterWorker(
+	ch *amqp.Channel,
+	deadLetterRepo Repository,
+	logger zerolog.Logger,
+) *DeadLetterWorker {
+	return &DeadLetterWorker{
+		ch:             ch,
+		doneChan:       make(chan bool),
+		deadLetterRepo: deadLetterRepo,
+		logger:         logger,
+	}
+}
+
+func (worker *DeadLetterWorker) Start(ctx context.Context) error {
+	msgs, err := worker.ch.Consume(
+		notif.DeadLetterQueue, // queue
+		"",                    // consumer
+		false,                 // auto-ack
+		false,                 // exclusive
+		false,                 // no local
+		false,                 // no wait
+		nil,
+	)
+	if err != nil {
+		return errors.Wrap(err, "consume messages")
+	}
+
+	for {
+		select {
+		case msg := <-msgs:
+			err = worker.saveMsg(ctx, msg)
+			if err != nil {
+				worker.logger.Error().Err(err).Msg("save dead letter")
+
+				// Keep the message in the queue
+				err = msg.Nack(false, true)
+				if err != nil {
+					worker.logger.Error().Err(err).Msg("nack")
+				}
+				continue
+			}
+
+			err = msg.Ack(false)
+			if err != nil {
+				worker.logger.Error().Err(err).Msg("ack")
+			}
+
+		case <-worker.doneChan:
+			close(worker.doneChan)
+			return nil
+		}
+	}
+}
+
+func (worker *DeadLetterWorker) Stop() {
+	worker.doneChan <- true
+}
+
+func (worker *DeadLetterWorker) saveMsg(ctx context.Context, msg amqp.Delivery) error {
+	dl := DeadLetter{
+		ID:   NewID(),
+		Body: msg.Body,
+	}
+
+	if reason, ok := msg.Headers[notif.DeadLetterReasonHeader].(string); ok {
+		dl.Reason = reason
+	}
+
+	// The message might not be decodable, which is
+	// probably the reason why it was dead lettered
+	var notifMsg notif.NotifMsg
+	err := json.NewDecoder(bytes.NewReader(msg.Body)).Decode(&notifMsg)
+	if err == nil {
+		dl.NotifID = notifMsg.NotifID
+		dl.DestTokenID = notifMsg.DestTokenID
+		dl.CBType = notifMsg.CBType
+	}
+
+	err = worker.deadLetterRepo.CreateDeadLetter(ctx, dl)
+	if err != nil {
+		return errors.Wrap(err, "create dead letter")
+	}
+
+	return nil
+}
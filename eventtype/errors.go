@@ -0,0 +1,29 @@
+package eventtype
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrEventTypeExists   = errors.New("event type exists")
+	ErrEventTypeNotFound = errors.New("event type not found")
+	ErrInvalidSchema     = errors.New("invalid schema")
+	ErrInvalidPayload    = errors.New("invalid payload")
+	ErrVersionNotFound   = errors.New("version not found")
+	ErrVersionExists     = errors.New("version exists")
+	ErrInvalidConverter  = errors.New("invalid converter")
+)
+
+// ValidationError is returned when the payload doesn't match the schema
+type ValidationError struct {
+	// Errors are the schema violations of the payload
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return ErrInvalidPayload.Error() + ": " + strings.Join(e.Errors, "; ")
+}
+
+func (e *ValidationError) Unwrap() error { return ErrInvalidPayload }
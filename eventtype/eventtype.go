@@ -0,0 +1,54 @@
+package eventtype
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/schema"
+	"github.com/stevenferrer/notifi/token"
+)
+
+// EventType is a registered notification type
+type EventType struct {
+	// Name is the callback type of the notifications
+	Name callback.CBType
+	// TokenID is the token that registered the event type
+	TokenID token.ID
+	// Description describes the event type to the receivers
+	Description string
+	// Version is the latest payload version
+	Version int
+	// Schema is the json schema of the latest version, empty to accept any payload
+	Schema json.RawMessage
+	// CreatedAt is the created timestamp
+	CreatedAt *time.Time
+}
+
+// ValidatePayload validates the payload against the schema of the event type
+func (et EventType) ValidatePayload(payload map[string]interface{}) error {
+	return validatePayload(et.Schema, payload)
+}
+
+// ValidatePayload validates the payload against the schema of the version
+func (v Version) ValidatePayload(payload map[string]interface{}) error {
+	return validatePayload(v.Schema, payload)
+}
+
+func validatePayload(rawSchema json.RawMessage, payload map[string]interface{}) error {
+	if len(rawSchema) == 0 {
+		return nil
+	}
+
+	s, err := schema.Parse(rawSchema)
+	if err != nil {
+		return ErrInvalidSchema
+	}
+
+	errs := s.Validate(payload)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unrolled/render"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/eventtype"
+	"github.com/stevenferrer/notifi/notifihttp"
+)
+
+type eventTypeHandler struct {
+	eventTypeSvc eventtype.Service
+	mux          *chi.Mux
+	logger       zerolog.Logger
+	render       *render.Render
+}
+
+func NewEventTypeHandler(eventTypeSvc eventtype.Service, logger zerolog.Logger) http.Handler {
+	eth := &eventTypeHandler{
+		eventTypeSvc: eventTypeSvc,
+		mux:          chi.NewMux(),
+		logger:       logger,
+		render:       render.New(),
+	}
+
+	addRoute := func(method, pattern string, h notifihttp.Handler) {
+		eth.mux.Method(method, pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := h.ServeHTTP(w, r)
+			if err != nil {
+				eth.handleError(w, r, err)
+			}
+		}))
+	}
+
+	addRoute(http.MethodPost, "/", registerEventType(eth))
+	addRoute(http.MethodGet, "/", listEventTypes(eth))
+	addRoute(http.MethodGet, "/{name}", getEventType(eth))
+	addRoute(http.MethodGet, "/{name}/versions", listVersions(eth))
+	addRoute(http.MethodPost, "/{name}/versions", addVersion(eth))
+
+	return eth
+}
+
+func (eth *eventTypeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	eth.mux.ServeHTTP(w, r)
+}
+
+func (eth *eventTypeHandler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	eth.logger.Error().Err(err).Msg("event type handler error")
+
+	apiErr := notifihttp.NewInternalServerError(err)
+	if e, ok := err.(*notifihttp.Error); ok {
+		apiErr = e
+	}
+
+	w.WriteHeader(apiErr.Status)
+	err = json.NewEncoder(w).Encode(apiErr)
+	if err != nil {
+		eth.logger.Error().Err(err).Msg("json encode")
+	}
+}
+
+// eventTypeResponse is the catalog entry of the event type,
+// the token of the sender is an api key so it's not exposed
+type eventTypeResponse struct {
+	Name        callback.CBType `json:"name"`
+	Description string          `json:"description"`
+	Version     int             `json:"version"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	CreatedAt   *time.Time      `json:"created_at,omitempty"`
+}
+
+func newEventTypeResponse(et eventtype.EventType) eventTypeResponse {
+	return eventTypeResponse{
+		Name:        et.Name,
+		Description: et.Description,
+		Version:     et.Version,
+		Schema:      et.Schema,
+		CreatedAt:   et.CreatedAt,
+	}
+}
+
+type registerEventTypeRequest struct {
+	Name        callback.CBType `json:"name"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+func registerEventType(eth *eventTypeHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		var request registerEventTypeRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		// explicit null is the same as no schema
+		if string(request.Schema) == "null" {
+			request.Schema = nil
+		}
+
+		et := eventtype.EventType{
+			Name:        request.Name,
+			TokenID:     token.ID,
+			Description: request.Description,
+			Version:     1,
+			Schema:      request.Schema,
+		}
+		err = eth.eventTypeSvc.RegisterEventType(r.Context(), et)
+		if err != nil {
+			if err == eventtype.ErrEventTypeExists ||
+				err == callback.ErrInvalidCBType ||
+				errors.Is(err, eventtype.ErrInvalidSchema) {
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return errors.Wrap(err, "register event type")
+		}
+
+		return eth.render.JSON(w, http.StatusOK, newEventTypeResponse(et))
+	})
+}
+
+type listEventTypesResponse struct {
+	EventTypes []eventTypeResponse `json:"event_types"`
+}
+
+func listEventTypes(eth *eventTypeHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		eventTypes, err := eth.eventTypeSvc.ListEventTypes(r.Context())
+		if err != nil {
+			return errors.Wrap(err, "list event types")
+		}
+
+		response := listEventTypesResponse{
+			EventTypes: make([]eventTypeResponse, 0, len(eventTypes)),
+		}
+		for _, et := range eventTypes {
+			response.EventTypes = append(response.EventTypes, newEventTypeResponse(et))
+		}
+
+		return eth.render.JSON(w, http.StatusOK, response)
+	})
+}
+
+func getEventType(eth *eventTypeHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		name := callback.CBType(chi.URLParam(r, "name"))
+		et, err := eth.eventTypeSvc.GetEventType(r.Context(), name)
+		if err != nil {
+			if err == eventtype.ErrEventTypeNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "get event type")
+		}
+
+		return eth.render.JSON(w, http.StatusOK, newEventTypeResponse(*et))
+	})
+}
+
+type versionResponse struct {
+	Version   int             `json:"version"`
+	Schema    json.RawMessage `json:"schema,omitempty"`
+	Upcast    []eventtype.Op  `json:"upcast,omitempty"`
+	Downcast  []eventtype.Op  `json:"downcast,omitempty"`
+	CreatedAt *time.Time      `json:"created_at,omitempty"`
+}
+
+func newVersionResponse(v eventtype.Version) versionResponse {
+	return versionResponse{
+		Version:   v.Version,
+		Schema:    v.Schema,
+		Upcast:    v.Upcast,
+		Downcast:  v.Downcast,
+		CreatedAt: v.CreatedAt,
+	}
+}
+
+type listVersionsResponse struct {
+	Versions []versionResponse `json:"versions"`
+}
+
+func listVersions(eth *eventTypeHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		name := callback.CBType(chi.URLParam(r, "name"))
+		versions, err := eth.eventTypeSvc.ListVersions(r.Context(), name)
+		if err != nil {
+			if err == eventtype.ErrEventTypeNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "list versions")
+		}
+
+		response := listVersionsResponse{
+			Versions: make([]versionResponse, 0, len(versions)),
+		}
+		for _, v := range versions {
+			response.Versions = append(response.Versions, newVersionResponse(v))
+		}
+
+		return eth.render.JSON(w, http.StatusOK, response)
+	})
+}
+
+type addVersionRequest struct {
+	Schema json.RawMessage `json:"schema"`
+	// Upcast converts the payload of the previous version to the new version
+	Upcast []eventtype.Op `json:"upcast"`
+	// Downcast converts the payload of the new version to the previous version
+	Downcast []eventtype.Op `json:"downcast"`
+}
+
+func addVersion(eth *eventTypeHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		var request addVersionRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		// explicit null is the same as no schema
+		if string(request.Schema) == "null" {
+			request.Schema = nil
+		}
+
+		v, err := eth.eventTypeSvc.AddVersion(r.Context(), token.ID, eventtype.Version{
+			EventType: callback.CBType(chi.URLParam(r, "name")),
+			Schema:    request.Schema,
+			Upcast:    request.Upcast,
+			Downcast:  request.Downcast,
+		})
+		if err != nil {
+			if err == eventtype.ErrEventTypeNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			if err == eventtype.ErrVersionExists ||
+				err == eventtype.ErrInvalidConverter ||
+				errors.Is(err, eventtype.ErrInvalidSchema) {
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return errors.Wrap(err, "add version")
+		}
+
+		return eth.render.JSON(w, http.StatusOK, newVersionResponse(*v))
+	})
+}
@@ -0,0 +1,106 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/eventtype"
+	ethandler "github.com/stevenferrer/notifi/eventtype/handler"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/token"
+	tkhandler "github.com/stevenferrer/notifi/token/handler"
+)
+
+func TestEventTypeHandler(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	tokenRepo := postgres.NewTokenRepository(db)
+	tokenSvc := token.NewTokenService(tokenRepo)
+	tokenMw := tkhandler.NewTokenMw(tokenSvc)
+
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
+	eventTypeSvc := eventtype.NewEventTypeService(eventTypeRepo)
+
+	logger := zerolog.New(os.Stderr)
+	authHandler := tokenMw(ethandler.NewEventTypeHandler(eventTypeSvc, logger))
+
+	ctx := context.TODO()
+
+	// create a token
+	tk, err := tokenSvc.CreateToken(ctx)
+	require.NoError(t, err)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		httpReq, err := http.NewRequestWithContext(ctx, method,
+			target, strings.NewReader(body))
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+		rr := httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		return rr
+	}
+
+	t.Run("Register event type", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/", `{"name":"invoice.paid",
+			"description":"Sent when the invoice is paid",
+			"schema":{"type":"object","required":["invoice_id"]}}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		// already registered
+		rr = serve(http.MethodPost, "/", `{"name":"invoice.paid"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		// invalid schema
+		rr = serve(http.MethodPost, "/", `{"name":"invoice.created",
+			"schema":{"type":"decimal"}}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("List event types", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response = struct {
+			EventTypes []struct {
+				Name        string          `json:"name"`
+				Description string          `json:"description"`
+				Schema      json.RawMessage `json:"schema"`
+			} `json:"event_types"`
+		}{}
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		require.NoError(t, err)
+
+		require.Len(t, response.EventTypes, 1)
+		assert.Equal(t, "invoice.paid", response.EventTypes[0].Name)
+		assert.Equal(t, "Sent when the invoice is paid", response.EventTypes[0].Description)
+		assert.JSONEq(t, `{"type":"object","required":["invoice_id"]}`,
+			string(response.EventTypes[0].Schema))
+
+		// the api key of the sender is not exposed
+		assert.NotContains(t, rr.Body.String(), string(tk.ID))
+	})
+
+	t.Run("Get event type", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/invoice.paid", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = serve(http.MethodGet, "/invoice.created", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,17 @@
+package eventtype
+
+import (
+	"context"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+type Repository interface {
+	CreateEventType(context.Context, EventType) error
+	GetEventType(context.Context, callback.CBType) (*EventType, error)
+	ListEventTypes(context.Context) ([]EventType, error)
+	// CreateVersion adds the version and makes it the latest version of the event type
+	CreateVersion(context.Context, Version) error
+	// ListVersions lists the versions of the event type, oldest first
+	ListVersions(context.Context, callback.CBType) ([]Version, error)
+}
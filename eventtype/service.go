@@ -0,0 +1,146 @@
+package eventtype
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/schema"
+	"github.com/stevenferrer/notifi/token"
+)
+
+type Service interface {
+	// RegisterEventType adds the event type to the catalog
+	RegisterEventType(context.Context, EventType) error
+	GetEventType(context.Context, callback.CBType) (*EventType, error)
+	// ListEventTypes lists the catalog of event types
+	ListEventTypes(context.Context) ([]EventType, error)
+	// AddVersion adds a payload version to the event type registered by the token
+	AddVersion(context.Context, token.ID, Version) (*Version, error)
+	ListVersions(context.Context, callback.CBType) ([]Version, error)
+}
+
+type EventTypeService struct{ repo Repository }
+
+var _ Service = (*EventTypeService)(nil)
+
+func NewEventTypeService(repo Repository) *EventTypeService {
+	return &EventTypeService{repo: repo}
+}
+
+func (ets *EventTypeService) RegisterEventType(ctx context.Context, et EventType) error {
+	// Patterns are for subscriptions only
+	err := et.Name.Validate()
+	if err != nil || et.Name.IsPattern() {
+		return callback.ErrInvalidCBType
+	}
+
+	err = validateSchema(et.Schema)
+	if err != nil {
+		return err
+	}
+
+	err = ets.repo.CreateEventType(ctx, et)
+	if err != nil {
+		if err == ErrEventTypeExists {
+			return err
+		}
+
+		return errors.Wrap(err, "create event type")
+	}
+
+	return nil
+}
+
+func validateSchema(rawSchema json.RawMessage) error {
+	if len(rawSchema) == 0 {
+		return nil
+	}
+
+	_, err := schema.Parse(rawSchema)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+	}
+
+	return nil
+}
+
+func (ets *EventTypeService) GetEventType(ctx context.Context, name callback.CBType) (*EventType, error) {
+	et, err := ets.repo.GetEventType(ctx, name)
+	if err != nil {
+		if err == ErrEventTypeNotFound {
+			return nil, err
+		}
+
+		return nil, errors.Wrap(err, "get event type")
+	}
+
+	return et, nil
+}
+
+func (ets *EventTypeService) ListEventTypes(ctx context.Context) ([]EventType, error) {
+	eventTypes, err := ets.repo.ListEventTypes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list event types")
+	}
+
+	return eventTypes, nil
+}
+
+func (ets *EventTypeService) AddVersion(ctx context.Context,
+	tokenID token.ID, v Version) (*Version, error) {
+	err := validateSchema(v.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateOps(v.Upcast)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateOps(v.Downcast)
+	if err != nil {
+		return nil, err
+	}
+
+	et, err := ets.GetEventType(ctx, v.EventType)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the sender that registered the event type can evolve it
+	if et.TokenID != tokenID {
+		return nil, ErrEventTypeNotFound
+	}
+
+	v.Version = et.Version + 1
+	err = ets.repo.CreateVersion(ctx, v)
+	if err != nil {
+		if err == ErrVersionExists {
+			return nil, err
+		}
+
+		return nil, errors.Wrap(err, "create version")
+	}
+
+	return &v, nil
+}
+
+func (ets *EventTypeService) ListVersions(ctx context.Context,
+	name callback.CBType) ([]Version, error) {
+	_, err := ets.GetEventType(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := ets.repo.ListVersions(ctx, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "list versions")
+	}
+
+	return versions, nil
+}
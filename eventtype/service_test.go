@@ -0,0 +1,136 @@
+package eventtype_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/eventtype"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/token"
+)
+
+func TestEventTypeService(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	tokenRepo := postgres.NewTokenRepository(db)
+	tokenSvc := token.NewTokenService(tokenRepo)
+
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
+	eventTypeSvc := eventtype.NewEventTypeService(eventTypeRepo)
+
+	ctx := context.TODO()
+	tk, err := tokenSvc.CreateToken(ctx)
+	require.NoError(t, err)
+
+	et := eventtype.EventType{
+		Name:        "invoice.paid",
+		TokenID:     tk.ID,
+		Description: "Sent when the invoice is paid",
+		Schema:      json.RawMessage(`{"type": "object", "required": ["invoice_id"]}`),
+	}
+	err = eventTypeSvc.RegisterEventType(ctx, et)
+	require.NoError(t, err)
+
+	gotEt, err := eventTypeSvc.GetEventType(ctx, et.Name)
+	require.NoError(t, err)
+	assert.Equal(t, et.Name, gotEt.Name)
+	assert.Equal(t, et.TokenID, gotEt.TokenID)
+	assert.Equal(t, et.Description, gotEt.Description)
+	assert.JSONEq(t, string(et.Schema), string(gotEt.Schema))
+	assert.NotNil(t, gotEt.CreatedAt)
+
+	// registered payloads are validated
+	assert.NoError(t, gotEt.ValidatePayload(map[string]interface{}{"invoice_id": "1234"}))
+	assert.ErrorIs(t, gotEt.ValidatePayload(map[string]interface{}{}), eventtype.ErrInvalidPayload)
+
+	// event types are unique
+	err = eventTypeSvc.RegisterEventType(ctx, et)
+	assert.ErrorIs(t, err, eventtype.ErrEventTypeExists)
+
+	// no schema accepts any payload
+	err = eventTypeSvc.RegisterEventType(ctx, eventtype.EventType{
+		Name:    "invoice.created",
+		TokenID: tk.ID,
+	})
+	require.NoError(t, err)
+
+	// event types are concrete callback types
+	err = eventTypeSvc.RegisterEventType(ctx, eventtype.EventType{
+		Name:    "invoice.*",
+		TokenID: tk.ID,
+	})
+	assert.ErrorIs(t, err, callback.ErrInvalidCBType)
+
+	err = eventTypeSvc.RegisterEventType(ctx, eventtype.EventType{
+		Name:    "invoice.refunded",
+		TokenID: tk.ID,
+		Schema:  json.RawMessage(`{"type": "decimal"}`),
+	})
+	assert.ErrorIs(t, err, eventtype.ErrInvalidSchema)
+
+	_, err = eventTypeSvc.GetEventType(ctx, "invoice.refunded")
+	assert.ErrorIs(t, err, eventtype.ErrEventTypeNotFound)
+
+	eventTypes, err := eventTypeSvc.ListEventTypes(ctx)
+	require.NoError(t, err)
+	require.Len(t, eventTypes, 2)
+	assert.Equal(t, callback.CBType("invoice.created"), eventTypes[0].Name)
+	assert.Nil(t, eventTypes[0].Schema)
+	assert.Equal(t, callback.CBType("invoice.paid"), eventTypes[1].Name)
+
+	t.Run("versions", func(t *testing.T) {
+		gotEt, err := eventTypeSvc.GetEventType(ctx, et.Name)
+		require.NoError(t, err)
+		assert.Equal(t, 1, gotEt.Version)
+
+		v, err := eventTypeSvc.AddVersion(ctx, tk.ID, eventtype.Version{
+			EventType: et.Name,
+			Schema:    json.RawMessage(`{"type": "object", "required": ["id"]}`),
+			Upcast:    []eventtype.Op{{Op: eventtype.OpRename, From: "invoice_id", Path: "id"}},
+			Downcast:  []eventtype.Op{{Op: eventtype.OpRename, From: "id", Path: "invoice_id"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, v.Version)
+
+		// the latest version is the schema of the event type
+		gotEt, err = eventTypeSvc.GetEventType(ctx, et.Name)
+		require.NoError(t, err)
+		assert.Equal(t, 2, gotEt.Version)
+		assert.JSONEq(t, string(v.Schema), string(gotEt.Schema))
+
+		versions, err := eventTypeSvc.ListVersions(ctx, et.Name)
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+		assert.Equal(t, 1, versions[0].Version)
+		assert.JSONEq(t, string(et.Schema), string(versions[0].Schema))
+		assert.Equal(t, 2, versions[1].Version)
+		assert.Equal(t, v.Upcast, versions[1].Upcast)
+		assert.Equal(t, v.Downcast, versions[1].Downcast)
+
+		// only the sender that registered the event type can add versions
+		other, err := tokenSvc.CreateToken(ctx)
+		require.NoError(t, err)
+
+		_, err = eventTypeSvc.AddVersion(ctx, other.ID, eventtype.Version{EventType: et.Name})
+		assert.ErrorIs(t, err, eventtype.ErrEventTypeNotFound)
+
+		_, err = eventTypeSvc.AddVersion(ctx, tk.ID, eventtype.Version{
+			EventType: et.Name,
+			Upcast:    []eventtype.Op{{Op: "move"}},
+		})
+		assert.ErrorIs(t, err, eventtype.ErrInvalidConverter)
+
+		_, err = eventTypeSvc.ListVersions(ctx, "invoice.refunded")
+		assert.ErrorIs(t, err, eventtype.ErrEventTypeNotFound)
+	})
+}
@@ -0,0 +1,216 @@
+package eventtype
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+// Version is a payload version of the event type
+type Version struct {
+	// EventType is the name of the event type
+	EventType callback.CBType
+	// Version is the version number, the first version is 1
+	Version int
+	// Schema is the json schema of the payload, empty to accept any payload
+	Schema json.RawMessage
+	// Upcast converts the payload of the previous version to this version
+	Upcast []Op
+	// Downcast converts the payload of this version to the previous version
+	Downcast []Op
+	// CreatedAt is the created timestamp
+	CreatedAt *time.Time
+}
+
+// OpKind is the kind of a conversion operation
+type OpKind string
+
+const (
+	// OpRename moves the value at From to Path
+	OpRename OpKind = "rename"
+	// OpCopy copies the value at From to Path
+	OpCopy OpKind = "copy"
+	// OpRemove removes the value at Path
+	OpRemove OpKind = "remove"
+	// OpSet sets the value at Path to Value
+	OpSet OpKind = "set"
+	// OpDefault sets the value at Path to Value if it's missing
+	OpDefault OpKind = "default"
+)
+
+// Op is a conversion operation on the payload, the paths are
+// dot separated field names e.g. customer.address.city
+type Op struct {
+	Op    OpKind      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Validate validates the operation
+func (op Op) Validate() error {
+	if !validPath(op.Path) {
+		return ErrInvalidConverter
+	}
+
+	switch op.Op {
+	case OpRename, OpCopy:
+		if !validPath(op.From) {
+			return ErrInvalidConverter
+		}
+	case OpRemove, OpSet, OpDefault:
+	default:
+		return ErrInvalidConverter
+	}
+
+	return nil
+}
+
+func validPath(path string) bool {
+	if path == "" {
+		return false
+	}
+
+	for _, field := range strings.Split(path, ".") {
+		if field == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidateOps validates the conversion operations
+func ValidateOps(ops []Op) error {
+	for _, op := range ops {
+		err := op.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Convert converts the payload from a version to another by applying
+// the upcasts or downcasts of the versions in between. The payload is
+// not modified, the converted payload is a copy.
+func Convert(versions []Version, payload map[string]interface{},
+	from, to int) (map[string]interface{}, error) {
+	byNumber := make(map[int]Version, len(versions))
+	for _, v := range versions {
+		byNumber[v.Version] = v
+	}
+
+	for _, number := range []int{from, to} {
+		if _, ok := byNumber[number]; !ok {
+			return nil, errors.Wrapf(ErrVersionNotFound, "version %d", number)
+		}
+	}
+
+	converted := deepCopy(payload).(map[string]interface{})
+	for number := from; number < to; number++ {
+		applyOps(converted, byNumber[number+1].Upcast)
+	}
+
+	for number := from; number > to; number-- {
+		applyOps(converted, byNumber[number].Downcast)
+	}
+
+	return converted, nil
+}
+
+func applyOps(payload map[string]interface{}, ops []Op) {
+	for _, op := range ops {
+		switch op.Op {
+		case OpRename:
+			if value, ok := removePath(payload, op.From); ok {
+				setPath(payload, op.Path, value)
+			}
+		case OpCopy:
+			if value, ok := getPath(payload, op.From); ok {
+				setPath(payload, op.Path, deepCopy(value))
+			}
+		case OpRemove:
+			removePath(payload, op.Path)
+		case OpSet:
+			setPath(payload, op.Path, deepCopy(op.Value))
+		case OpDefault:
+			if _, ok := getPath(payload, op.Path); !ok {
+				setPath(payload, op.Path, deepCopy(op.Value))
+			}
+		}
+	}
+}
+
+func getPath(payload map[string]interface{}, path string) (interface{}, bool) {
+	fields := strings.Split(path, ".")
+	obj := payload
+	for _, field := range fields[:len(fields)-1] {
+		next, ok := obj[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		obj = next
+	}
+
+	value, ok := obj[fields[len(fields)-1]]
+	return value, ok
+}
+
+// setPath sets the value at the path, the missing
+// objects in between are created along the way
+func setPath(payload map[string]interface{}, path string, value interface{}) {
+	fields := strings.Split(path, ".")
+	obj := payload
+	for _, field := range fields[:len(fields)-1] {
+		next, ok := obj[field].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			obj[field] = next
+		}
+		obj = next
+	}
+
+	obj[fields[len(fields)-1]] = value
+}
+
+func removePath(payload map[string]interface{}, path string) (interface{}, bool) {
+	fields := strings.Split(path, ".")
+	obj := payload
+	for _, field := range fields[:len(fields)-1] {
+		next, ok := obj[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		obj = next
+	}
+
+	field := fields[len(fields)-1]
+	value, ok := obj[field]
+	delete(obj, field)
+	return value, ok
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(t))
+		for name, value := range t {
+			copied[name] = deepCopy(value)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(t))
+		for i, value := range t {
+			copied[i] = deepCopy(value)
+		}
+		return copied
+	}
+
+	return v
+}
@@ -0,0 +1,94 @@
+package eventtype_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/eventtype"
+)
+
+func TestConvert(t *testing.T) {
+	versions := []eventtype.Version{
+		{Version: 1},
+		{
+			// version 2 moves the customer name into an object
+			Version: 2,
+			Upcast: []eventtype.Op{
+				{Op: eventtype.OpRename, From: "customer_name", Path: "customer.name"},
+				{Op: eventtype.OpDefault, Path: "currency", Value: "USD"},
+			},
+			Downcast: []eventtype.Op{
+				{Op: eventtype.OpRename, From: "customer.name", Path: "customer_name"},
+				{Op: eventtype.OpRemove, Path: "customer"},
+				{Op: eventtype.OpRemove, Path: "currency"},
+			},
+		},
+		{
+			// version 3 renames the amount and adds a static field
+			Version: 3,
+			Upcast: []eventtype.Op{
+				{Op: eventtype.OpRename, From: "amount", Path: "total"},
+				{Op: eventtype.OpSet, Path: "schema", Value: "v3"},
+			},
+			Downcast: []eventtype.Op{
+				{Op: eventtype.OpRename, From: "total", Path: "amount"},
+				{Op: eventtype.OpRemove, Path: "schema"},
+			},
+		},
+	}
+
+	v1 := map[string]interface{}{"customer_name": "Jane", "amount": 100.0}
+	v3 := map[string]interface{}{
+		"customer": map[string]interface{}{"name": "Jane"},
+		"currency": "USD",
+		"total":    100.0,
+		"schema":   "v3",
+	}
+
+	got, err := eventtype.Convert(versions, v1, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, v3, got)
+
+	got, err = eventtype.Convert(versions, v3, 3, 1)
+	require.NoError(t, err)
+	assert.Equal(t, v1, got)
+
+	// the original payload is not modified
+	assert.Equal(t, map[string]interface{}{"customer_name": "Jane", "amount": 100.0}, v1)
+
+	got, err = eventtype.Convert(versions, v1, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, v1, got)
+
+	t.Run("copy", func(t *testing.T) {
+		got, err := eventtype.Convert([]eventtype.Version{{Version: 1}, {
+			Version: 2,
+			Upcast:  []eventtype.Op{{Op: eventtype.OpCopy, From: "id", Path: "meta.ref"}},
+		}}, map[string]interface{}{"id": "1234"}, 1, 2)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"id":   "1234",
+			"meta": map[string]interface{}{"ref": "1234"},
+		}, got)
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		_, err := eventtype.Convert(versions, v1, 1, 4)
+		assert.ErrorIs(t, err, eventtype.ErrVersionNotFound)
+	})
+
+	t.Run("validate ops", func(t *testing.T) {
+		assert.NoError(t, eventtype.ValidateOps(versions[1].Upcast))
+
+		for _, op := range []eventtype.Op{
+			{Op: "move", From: "a", Path: "b"},
+			{Op: eventtype.OpRename, Path: "b"},
+			{Op: eventtype.OpRemove, Path: "a..b"},
+			{Op: eventtype.OpSet},
+		} {
+			assert.ErrorIs(t, op.Validate(), eventtype.ErrInvalidConverter, op)
+		}
+	})
+}
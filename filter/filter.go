@@ -0,0 +1,346 @@
+// Package filter implements the payload filter expressions of the callbacks.
+//
+// An expression is a predicate over the notification payload, for example:
+//
+//	payload.status == "shipped" || payload.amount > 1000
+//
+// Fields are accessed with payload.field or payload["field"] and the list
+// items with payload.items[0]. Missing fields are null. The operators are
+// ==, !=, <, <=, >, >=, &&, || and !, with parentheses for grouping. The
+// literals are strings, numbers, true, false and null. The comparisons of
+// mismatched types are false, except for != which is true.
+package filter
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Filter is a parsed filter expression
+type Filter struct {
+	expr string
+	root node
+}
+
+// Parse parses the filter expression
+func Parse(expr string) (*Filter, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tk := p.peek(); tk.kind != tokenEOF {
+		return nil, errors.Errorf("unexpected token at %d", tk.pos)
+	}
+
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// String returns the filter expression
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether the payload satisfies the filter
+func (f *Filter) Match(payload map[string]interface{}) bool {
+	return truthy(f.root.eval(payload))
+}
+
+type node interface {
+	eval(payload map[string]interface{}) interface{}
+}
+
+type (
+	literalNode struct{ value interface{} }
+	// pathNode is a field access, the segments are strings or list indexes
+	pathNode   struct{ segments []interface{} }
+	notNode    struct{ operand node }
+	binaryNode struct {
+		op          string
+		left, right node
+	}
+)
+
+func (n *literalNode) eval(map[string]interface{}) interface{} {
+	return n.value
+}
+
+func (n *pathNode) eval(payload map[string]interface{}) interface{} {
+	var value interface{} = payload
+	for _, segment := range n.segments {
+		switch s := segment.(type) {
+		case string:
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = m[s]
+		case int:
+			l, ok := value.([]interface{})
+			if !ok || s < 0 || s >= len(l) {
+				return nil
+			}
+			value = l[s]
+		}
+	}
+
+	return value
+}
+
+func (n *notNode) eval(payload map[string]interface{}) interface{} {
+	return !truthy(n.operand.eval(payload))
+}
+
+func (n *binaryNode) eval(payload map[string]interface{}) interface{} {
+	switch n.op {
+	case "&&":
+		return truthy(n.left.eval(payload)) && truthy(n.right.eval(payload))
+	case "||":
+		return truthy(n.left.eval(payload)) || truthy(n.right.eval(payload))
+	}
+
+	left, right := normalize(n.left.eval(payload)), normalize(n.right.eval(payload))
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right)
+	case "!=":
+		return !reflect.DeepEqual(left, right)
+	}
+
+	// ordering is defined for numbers and strings only
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		return ok && compare(n.op, l < r, l == r)
+	case string:
+		r, ok := right.(string)
+		return ok && compare(n.op, l < r, l == r)
+	}
+
+	return false
+}
+
+func compare(op string, less, equal bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	case ">=":
+		return !less
+	}
+
+	return false
+}
+
+// normalize converts the numbers to float64 so that
+// payloads that are not decoded from json also work
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	}
+
+	return v
+}
+
+// truthy reports whether the value is considered true, only
+// true, non-zero numbers and non-empty strings are true
+func truthy(v interface{}) bool {
+	switch t := normalize(v).(type) {
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	}
+
+	return false
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tk := p.tokens[p.pos]
+	if tk.kind != tokenEOF {
+		p.pos++
+	}
+	return tk
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	tk := p.peek()
+	if tk.kind != tokenOp {
+		return false
+	}
+
+	for _, op := range ops {
+		if tk.text == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=") {
+		return left, nil
+	}
+
+	op := p.next().text
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &binaryNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tk := p.next()
+	switch tk.kind {
+	case tokenLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next().kind != tokenRParen {
+			return nil, errors.Errorf("missing ) for ( at %d", tk.pos)
+		}
+
+		return n, nil
+	case tokenString:
+		return &literalNode{value: tk.text}, nil
+	case tokenNumber:
+		return &literalNode{value: tk.num}, nil
+	case tokenIdent:
+		switch tk.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		case "payload":
+			return p.parsePath()
+		}
+
+		return nil, errors.Errorf("unknown identifier %q at %d, "+
+			"fields must start with payload", tk.text, tk.pos)
+	case tokenEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	return nil, errors.Errorf("unexpected token at %d", tk.pos)
+}
+
+func (p *parser) parsePath() (node, error) {
+	path := &pathNode{}
+	for {
+		switch p.peek().kind {
+		case tokenDot:
+			p.next()
+			tk := p.next()
+			if tk.kind != tokenIdent {
+				return nil, errors.Errorf("expecting field name at %d", tk.pos)
+			}
+			path.segments = append(path.segments, tk.text)
+		case tokenLBracket:
+			p.next()
+			tk := p.next()
+			switch {
+			case tk.kind == tokenString:
+				path.segments = append(path.segments, tk.text)
+			case tk.kind == tokenNumber && tk.num == float64(int(tk.num)):
+				path.segments = append(path.segments, int(tk.num))
+			default:
+				return nil, errors.Errorf("expecting field name or index at %d", tk.pos)
+			}
+
+			if p.next().kind != tokenRBracket {
+				return nil, errors.Errorf("missing ] at %d", tk.pos)
+			}
+		default:
+			return path, nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package filter_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/filter"
+)
+
+func TestFilter(t *testing.T) {
+	var payload map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"status": "shipped",
+		"amount": 1500,
+		"paid": true,
+		"customer": {"tier": "gold", "tags": ["vip", "beta"]},
+		"note": null,
+		"dotted.key": "yes"
+	}`), &payload)
+	require.NoError(t, err)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`payload.status == "shipped"`, true},
+		{`payload.status == 'pending'`, false},
+		{`payload.status != "pending"`, true},
+		{`payload.amount > 1000`, true},
+		{`payload.amount >= 1500 && payload.amount <= 1500`, true},
+		{`payload.amount < -1`, false},
+		{`payload.amount > 1e3`, true},
+		{`payload.status == "pending" || payload.amount > 1000`, true},
+		{`payload.status == "pending" || payload.amount > 2000`, false},
+		{`!(payload.status == "pending")`, true},
+		{`payload.paid`, true},
+		{`!payload.paid`, false},
+		{`payload.paid == true`, true},
+		{`payload.customer.tier == "gold"`, true},
+		{`payload.customer.tags[0] == "vip"`, true},
+		{`payload.customer.tags[5] == null`, true},
+		{`payload["dotted.key"] == "yes"`, true},
+		{`payload.note == null`, true},
+		{`payload.missing == null`, true},
+		{`payload.missing.deep == null`, true},
+		{`payload.missing`, false},
+		// mismatched types
+		{`payload.status > 1`, false},
+		{`payload.amount == "1500"`, false},
+		{`payload.amount != "1500"`, true},
+		{`payload.status > "a"`, true},
+	}
+
+	for _, tc := range tests {
+		f, err := filter.Parse(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.want, f.Match(payload), tc.expr)
+		assert.Equal(t, tc.expr, f.String())
+	}
+
+	invalid := []string{
+		``,
+		`payload.status ==`,
+		`status == "shipped"`,
+		`payload.status = "shipped"`,
+		`payload.status == "shipped`,
+		`(payload.amount > 1`,
+		`payload.amount > 1)`,
+		`payload.items[`,
+		`payload.items[1.5]`,
+		`payload.`,
+		`payload.amount > 1 payload.amount < 2`,
+		`payload.amount ~ 1`,
+	}
+	for _, expr := range invalid {
+		_, err := filter.Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,131 @@
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenDot
+)
+
+type token struct {
+	kind tokenKind
+	// text is the identifier, the unquoted string or the operator
+	text string
+	num  float64
+	pos  int
+}
+
+// operators are the operators, longest first
+var operators = []string{"==", "!=", ">=", "<=", "&&", "||", ">", "<", "!"}
+
+// lex splits the expression into tokens
+func lex(expr string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, pos: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, pos: i})
+			i++
+		case c == '.':
+			tokens = append(tokens, token{kind: tokenDot, pos: i})
+			i++
+		case c == '"' || c == '\'':
+			end, text, err := lexString(expr, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = end
+		case c == '-' || unicode.IsDigit(c):
+			end := i + 1
+			for end < len(expr) && strings.ContainsRune("0123456789.eE+-", rune(expr[end])) {
+				// signs are only part of the exponent
+				if (expr[end] == '+' || expr[end] == '-') &&
+					expr[end-1] != 'e' && expr[end-1] != 'E' {
+					break
+				}
+				end++
+			}
+			num, err := strconv.ParseFloat(expr[i:end], 64)
+			if err != nil {
+				return nil, errors.Errorf("invalid number %q at %d", expr[i:end], i)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, num: num, pos: i})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(expr) && (expr[end] == '_' ||
+				unicode.IsLetter(rune(expr[end])) || unicode.IsDigit(rune(expr[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expr[i:end], pos: i})
+			i = end
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errors.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(expr)}), nil
+}
+
+// lexString reads the quoted string starting at i, it
+// returns the end of the string and the unquoted text
+func lexString(expr string, i int) (int, string, error) {
+	quote := expr[i]
+	var sb strings.Builder
+	for j := i + 1; j < len(expr); j++ {
+		switch expr[j] {
+		case '\\':
+			if j+1 >= len(expr) {
+				return 0, "", errors.Errorf("unterminated string at %d", i)
+			}
+			j++
+			sb.WriteByte(expr[j])
+		case quote:
+			return j + 1, sb.String(), nil
+		default:
+			sb.WriteByte(expr[j])
+		}
+	}
+
+	return 0, "", errors.Errorf("unterminated string at %d", i)
+}
@@ -1,6 +1,6 @@
 module github.com/stevenferrer/notifi
 
-go 1.19
+go 1.21
 
 require (
 	github.com/DATA-DOG/go-txdb v0.2.0
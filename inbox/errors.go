@@ -0,0 +1,9 @@
+package inbox
+
+import "errors"
+
+var (
+	ErrInvalidLimit             = errors.New("invalid limit")
+	ErrInvalidVisibilityTimeout = errors.New("invalid visibility timeout")
+	ErrNoItems                  = errors.New("no items to ack")
+)
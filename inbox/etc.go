@@ -0,0 +1,15 @@
+package inbox
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+func NewID() ID {
+	return ID(genUUID())
+}
+
+func genUUID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unrolled/render"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/channel"
+	"github.com/stevenferrer/notifi/inbox"
+	"github.com/stevenferrer/notifi/notifihttp"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type inboxHandler struct {
+	inboxSvc inbox.Service
+	mux      *chi.Mux
+	render   *render.Render
+	logger   zerolog.Logger
+}
+
+// NewInboxHandler returns the handler for pulling the inbox items
+func NewInboxHandler(inboxSvc inbox.Service, logger zerolog.Logger) http.Handler {
+	ibh := &inboxHandler{
+		inboxSvc: inboxSvc,
+		mux:      chi.NewMux(),
+		render:   render.New(),
+		logger:   logger,
+	}
+
+	// helper for adding http route
+	addRoute := func(method, pattern string, h notifihttp.Handler) {
+		ibh.mux.Method(method, pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := h.ServeHTTP(w, r)
+			if err != nil {
+				HandleError(w, err, ibh.logger)
+			}
+		}))
+	}
+
+	addRoute(http.MethodGet, "/", receiveItems(ibh))
+	addRoute(http.MethodPost, "/ack", AckItems(ibh.inboxSvc, ibh.render))
+
+	return ibh
+}
+
+func (ibh *inboxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ibh.mux.ServeHTTP(w, r)
+}
+
+// HandleError writes the error response, the errors that are
+// not *notifihttp.Error are written as internal server errors
+func HandleError(w http.ResponseWriter, err error, logger zerolog.Logger) {
+	logger.Error().Err(err).Msg("handler error")
+
+	apiErr := notifihttp.NewInternalServerError(err)
+	if e, ok := err.(*notifihttp.Error); ok {
+		apiErr = e
+	}
+
+	w.WriteHeader(apiErr.Status)
+	err = json.NewEncoder(w).Encode(apiErr)
+	if err != nil {
+		logger.Error().Err(err).Msg("json encode")
+	}
+}
+
+// encodeCursor encodes the seq of the item into an opaque cursor
+func encodeCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(seq, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+
+	seq, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || seq < 0 {
+		return 0, errInvalidCursor
+	}
+
+	return seq, nil
+}
+
+// ParseReceiveOptions parses the receive options from the query params
+func ParseReceiveOptions(query url.Values) (inbox.ReceiveOptions, error) {
+	opts := inbox.ReceiveOptions{
+		CBType: callback.CBType(query.Get("callback_type")),
+	}
+
+	var err error
+	if value := query.Get("cursor"); value != "" {
+		opts.After, err = decodeCursor(value)
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		opts.Limit, err = strconv.Atoi(value)
+		if err != nil || opts.Limit <= 0 {
+			return opts, inbox.ErrInvalidLimit
+		}
+	}
+
+	// The visibility timeout is in seconds
+	if value := query.Get("visibility_timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 ||
+			time.Duration(seconds)*time.Second > inbox.MaxVisibilityTimeout {
+			return opts, inbox.ErrInvalidVisibilityTimeout
+		}
+
+		opts.VisibilityTimeout = time.Duration(seconds) * time.Second
+	}
+
+	return opts, nil
+}
+
+// ItemResponse is the inbox item in the responses
+type ItemResponse struct {
+	ID     inbox.ID        `json:"item_id"`
+	CBType callback.CBType `json:"callback_type"`
+	// Body is the exact body that the signature in the headers is for
+	Body string `json:"body"`
+	// Payload is the decoded body, only set if the body is json
+	Payload   json.RawMessage   `json:"payload,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Receives  int               `json:"receives"`
+	VisibleAt time.Time         `json:"visible_at"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// NewItemResponse returns the response of the item
+func NewItemResponse(item inbox.Item) ItemResponse {
+	response := ItemResponse{
+		ID:        item.ID,
+		CBType:    item.CBType,
+		Body:      string(item.Body),
+		Headers:   item.Headers,
+		Receives:  item.Receives,
+		VisibleAt: item.VisibleAt,
+		CreatedAt: item.CreatedAt,
+	}
+
+	// The templates may render other formats
+	if json.Valid(item.Body) {
+		response.Payload = item.Body
+	}
+
+	return response
+}
+
+type receiveItemsResponse struct {
+	Items []ItemResponse `json:"items"`
+	// NextCursor is the cursor of the next page, it's the same
+	// as the request cursor if there are no new items yet
+	NextCursor string `json:"next_cursor"`
+}
+
+func receiveItems(ibh *inboxHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tk, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		query := r.URL.Query()
+		opts, err := ParseReceiveOptions(query)
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+		opts.Channel = channel.Inbox
+
+		items, err := ibh.inboxSvc.ReceiveItems(r.Context(), tk.ID, opts)
+		if err != nil {
+			if err == inbox.ErrInvalidLimit || err == inbox.ErrInvalidVisibilityTimeout {
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return errors.Wrap(err, "receive items")
+		}
+
+		response := receiveItemsResponse{
+			Items:      []ItemResponse{},
+			NextCursor: query.Get("cursor"),
+		}
+		for _, item := range items {
+			response.Items = append(response.Items, NewItemResponse(item))
+
+			// The redelivered items are behind the cursor
+			if item.Seq > opts.After {
+				opts.After = item.Seq
+				response.NextCursor = encodeCursor(item.Seq)
+			}
+		}
+
+		return ibh.render.JSON(w, http.StatusOK, response)
+	})
+}
+
+type ackItemsRequest struct {
+	ItemIDs []inbox.ID `json:"item_ids"`
+}
+
+type ackItemsResponse struct {
+	Acked int `json:"acked"`
+}
+
+// AckItems returns the handler for acking the items of the token
+func AckItems(inboxSvc inbox.Service, rd *render.Render) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tk, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		var request ackItemsRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		// The items of the other tokens are not acked
+		acked, err := inboxSvc.AckItems(r.Context(), tk.ID, request.ItemIDs)
+		if err != nil {
+			if err == inbox.ErrNoItems {
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return errors.Wrap(err, "ack items")
+		}
+
+		return rd.JSON(w, http.StatusOK, ackItemsResponse{Acked: acked})
+	})
+}
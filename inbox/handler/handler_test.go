@@ -0,0 +1,164 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/callback"
+	callbacksvc "github.com/stevenferrer/notifi/callback/service"
+	"github.com/stevenferrer/notifi/channel"
+	"github.com/stevenferrer/notifi/inbox"
+	ibhandler "github.com/stevenferrer/notifi/inbox/handler"
+	"github.com/stevenferrer/notifi/notifihttp"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/token"
+	tkhandler "github.com/stevenferrer/notifi/token/handler"
+)
+
+func TestInboxHandler(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	tokenRepo := postgres.NewTokenRepository(db)
+	tokenSvc := token.NewTokenService(tokenRepo)
+	tokenMw := tkhandler.NewTokenMw(tokenSvc)
+
+	inboxRepo := postgres.NewInboxRepository(db)
+	inboxSvc := inbox.NewInboxService(inboxRepo)
+	inboxCh := channel.NewInboxChannel(inboxRepo)
+
+	requestSender := notifihttp.NewDefaultRequestSender()
+	channels := channel.NewDefaultRegistry(requestSender).
+		Register(channel.Inbox, inboxCh)
+	callbackRepo := postgres.NewCallbackRepository(db)
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
+	callbackSvc := callbacksvc.NewCallbackService(callbackRepo,
+		tokenRepo, eventTypeRepo, requestSender).WithChannels(channels)
+
+	logger := zerolog.New(os.Stderr)
+	authHandler := tokenMw(ibhandler.NewInboxHandler(inboxSvc, logger))
+
+	ctx := context.TODO()
+
+	tk, err := tokenSvc.CreateToken(ctx)
+	require.NoError(t, err)
+
+	// the inbox callbacks don't have a url
+	cb := callback.Callback{
+		TokenID: tk.ID,
+		CBType:  "INVOICE",
+		Channel: channel.Inbox,
+	}
+	cbID, err := callbackSvc.CreateCallback(ctx, cb)
+	require.NoError(t, err)
+	cb.ID = cbID
+
+	_, err = callbackSvc.CreateCallback(ctx, callback.Callback{
+		TokenID: tk.ID,
+		CBType:  "PAYMENT",
+		Channel: channel.Inbox,
+		URL:     "https://example.com",
+	})
+	require.ErrorIs(t, err, callback.ErrInvalidChannelConfig)
+
+	// deliver the notifications to the inbox
+	for _, deliveryID := range []string{"1", "2", "3"} {
+		_, err = inboxCh.Send(ctx, cb, channel.Message{
+			ID:      deliveryID,
+			CBType:  cb.CBType,
+			Body:    []byte(`{"id":"` + deliveryID + `"}`),
+			Headers: map[string]string{"X-IDEMPOTENT-KEY": deliveryID},
+		})
+		require.NoError(t, err)
+	}
+
+	serve := func(method, target string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set("X-API-KEY", string(tk.ID))
+		rr := httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	type receiveResponse struct {
+		Items []struct {
+			ID       inbox.ID               `json:"item_id"`
+			CBType   callback.CBType        `json:"callback_type"`
+			Body     string                 `json:"body"`
+			Payload  map[string]interface{} `json:"payload"`
+			Receives int                    `json:"receives"`
+		} `json:"items"`
+		NextCursor string `json:"next_cursor"`
+	}
+
+	receive := func(target string) receiveResponse {
+		rr := serve(http.MethodGet, target, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response receiveResponse
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		require.NoError(t, err)
+		return response
+	}
+
+	var itemIDs []inbox.ID
+	t.Run("Receive items", func(t *testing.T) {
+		response := receive("/?limit=2&visibility_timeout=60")
+		require.Len(t, response.Items, 2)
+		assert.Equal(t, "1", response.Items[0].Payload["id"])
+		assert.Equal(t, `{"id":"1"}`, response.Items[0].Body)
+		assert.Equal(t, cb.CBType, response.Items[0].CBType)
+		assert.Equal(t, 1, response.Items[0].Receives)
+		require.NotEmpty(t, response.NextCursor)
+
+		itemIDs = append(itemIDs, response.Items[0].ID, response.Items[1].ID)
+
+		// next page
+		response = receive("/?limit=2&cursor=" + response.NextCursor)
+		require.Len(t, response.Items, 1)
+		assert.Equal(t, "3", response.Items[0].Payload["id"])
+		itemIDs = append(itemIDs, response.Items[0].ID)
+
+		// nothing new yet, the cursor stays the same
+		nextCursor := response.NextCursor
+		response = receive("/?cursor=" + nextCursor)
+		assert.Empty(t, response.Items)
+		assert.Equal(t, nextCursor, response.NextCursor)
+
+		for _, target := range []string{"/?cursor=garbage", "/?limit=-1",
+			"/?limit=1000", "/?visibility_timeout=0"} {
+			rr := serve(http.MethodGet, target, nil)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+		}
+	})
+
+	t.Run("Ack items", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/ack", strings.NewReader(
+			`{"item_ids":["`+string(itemIDs[0])+`","`+string(itemIDs[1])+`"]}`))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response struct {
+			Acked int `json:"acked"`
+		}
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		require.NoError(t, err)
+		assert.Equal(t, 2, response.Acked)
+
+		rr = serve(http.MethodPost, "/ack", strings.NewReader(`{"item_ids":[]}`))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
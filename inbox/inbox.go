@@ -0,0 +1,74 @@
+package inbox
+
+import (
+	"time"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/token"
+)
+
+// ID is the inbox item ID
+type ID string
+
+const (
+	NilID ID = ""
+)
+
+const (
+	// DefaultLimit is the default max number of received items
+	DefaultLimit = 50
+	// MaxLimit is the max number of items that can be received at once
+	MaxLimit = 500
+	// DefaultVisibilityTimeout is the default time the received
+	// items are hidden from the other receives
+	DefaultVisibilityTimeout = 30 * time.Second
+	// MaxVisibilityTimeout is the max visibility timeout
+	MaxVisibilityTimeout = 12 * time.Hour
+)
+
+// Item is a notification stored for a receiver that pulls its
+// notifications instead of registering a callback url
+type Item struct {
+	// ID is the item ID
+	ID ID
+	// Seq is the position of the item in the inbox
+	Seq int64
+	// TokenID is the token id of the receiver
+	TokenID token.ID
+	// DeliveryID is the delivery of the notification, stored only once
+	DeliveryID string
+	// CBType is the callback type of the notification
+	CBType callback.CBType
+	// Channel is the channel that stored the item, the items
+	// are received only through the api of their channel
+	Channel callback.ChannelKind
+	// Body is the message body, stored byte for byte so that
+	// the receivers can verify the signature in the headers
+	Body []byte
+	// Headers are the message metadata e.g. the idempotent key
+	Headers map[string]string
+	// Receives is the number of times the item was received
+	Receives int
+	// VisibleAt is when the item can be received again
+	VisibleAt time.Time
+	// CreatedAt is the created timestamp
+	CreatedAt time.Time
+}
+
+// ReceiveOptions are the options for receiving the items
+type ReceiveOptions struct {
+	// Channel is the channel of the items, the inbox and
+	// the streams don't receive each other's items
+	Channel callback.ChannelKind
+	// CBType filters the items by callback type, empty for all
+	CBType callback.CBType
+	// After is the seq of the last item of the previous page. The items
+	// that were received before and are visible again are returned
+	// regardless so that the unacked items are redelivered.
+	After int64
+	// Limit is the max number of items, 0 to use the default
+	Limit int
+	// VisibilityTimeout is how long the received items are hidden
+	// from the other receives, 0 to use the default
+	VisibilityTimeout time.Duration
+}
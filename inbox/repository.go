@@ -0,0 +1,20 @@
+package inbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/stevenferrer/notifi/token"
+)
+
+// Repository is the inbox repository
+type Repository interface {
+	// CreateItem stores the item, the deliveries that are
+	// already stored in the inbox are ignored
+	CreateItem(context.Context, Item) error
+	// ReceiveItems returns the items visible at the given time
+	// and hides them until the visibility timeout
+	ReceiveItems(context.Context, token.ID, ReceiveOptions, time.Time) ([]Item, error)
+	// DeleteItems deletes the items and returns the number deleted
+	DeleteItems(context.Context, token.ID, []ID) (int, error)
+}
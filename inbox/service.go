@@ -0,0 +1,70 @@
+package inbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/token"
+)
+
+// Service is the inbox service
+type Service interface {
+	// ReceiveItems returns the pending items of the receiver. The items
+	// are redelivered if they're not acked within the visibility timeout.
+	ReceiveItems(context.Context, token.ID, ReceiveOptions) ([]Item, error)
+	// AckItems acknowledges the items and returns the number acked
+	AckItems(context.Context, token.ID, []ID) (int, error)
+}
+
+// InboxService implements the inbox service
+type InboxService struct {
+	inboxRepo Repository
+}
+
+var _ Service = (*InboxService)(nil)
+
+func NewInboxService(inboxRepo Repository) *InboxService {
+	return &InboxService{inboxRepo: inboxRepo}
+}
+
+func (ibs *InboxService) ReceiveItems(ctx context.Context, tokenID token.ID,
+	opts ReceiveOptions) ([]Item, error) {
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+
+	if opts.Limit < 0 || opts.Limit > MaxLimit {
+		return nil, ErrInvalidLimit
+	}
+
+	if opts.VisibilityTimeout == 0 {
+		opts.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+
+	if opts.VisibilityTimeout < 0 || opts.VisibilityTimeout > MaxVisibilityTimeout {
+		return nil, ErrInvalidVisibilityTimeout
+	}
+
+	items, err := ibs.inboxRepo.ReceiveItems(ctx, tokenID, opts, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "receive items")
+	}
+
+	return items, nil
+}
+
+func (ibs *InboxService) AckItems(ctx context.Context, tokenID token.ID, itemIDs []ID) (int, error) {
+	if len(itemIDs) == 0 {
+		return 0, ErrNoItems
+	}
+
+	// Acked items are done so they're removed
+	acked, err := ibs.inboxRepo.DeleteItems(ctx, tokenID, itemIDs)
+	if err != nil {
+		return 0, errors.Wrap(err, "delete items")
+	}
+
+	return acked, nil
+}
@@ -0,0 +1,34 @@
+package notif
+
+import (
+	"strings"
+	"time"
+)
+
+// Attempt is a delivery attempt of a notification
+type Attempt struct {
+	// NotifID is the notification id
+	NotifID ID
+	// DeliveryID is the delivery id
+	DeliveryID DeliveryID
+	// AttemptNo is the attempt number, starting from 1
+	AttemptNo int
+	// URL is the destination where the notification was sent, the
+	// channel name for the channels without urls e.g. inbox
+	URL string
+	// ResponseStatus is the response status code, 0 if there was no response
+	ResponseStatus int
+	// Latency is the duration of the request
+	Latency time.Duration
+	// ResponseBody is the truncated response body
+	ResponseBody string
+	// Error is the error text, empty if the attempt succeeded
+	Error string
+	// CreatedAt is the created timestamp
+	CreatedAt time.Time
+}
+
+// sanitizeText makes the text safe for storing as text
+func sanitizeText(text string) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(text, ""), "\x00", "")
+}
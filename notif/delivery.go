@@ -0,0 +1,84 @@
+package notif
+
+import (
+	"time"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+// DeliveryID is the delivery ID
+type DeliveryID string
+
+const (
+	NilDeliveryID DeliveryID = ""
+)
+
+// Delivery is the delivery of a notification to one of the subscribed callbacks
+type Delivery struct {
+	// ID is the delivery ID
+	ID DeliveryID
+	// NotifID is the notification id
+	NotifID ID
+	// CallbackID is the subscribed callback
+	CallbackID callback.ID
+	// Status is the delivery status
+	Status Status
+	// CreatedAt is the created timestamp
+	CreatedAt time.Time
+}
+
+// AggregateStatus returns the notification status from the statuses of
+// its deliveries. The notification is complete if all the deliveries are
+// complete and partial if only some of them are complete. Otherwise, the
+// most severe status of the deliveries is used. The skipped deliveries
+// are left out unless all the deliveries are skipped.
+func AggregateStatus(statuses []Status) Status {
+	if len(statuses) == 0 {
+		return StatusPending
+	}
+
+	delivered := make([]Status, 0, len(statuses))
+	for _, status := range statuses {
+		if status != StatusSkipped {
+			delivered = append(delivered, status)
+		}
+	}
+
+	if len(delivered) == 0 {
+		return StatusSkipped
+	}
+	statuses = delivered
+
+	count := map[Status]int{}
+	final := true
+	for _, status := range statuses {
+		count[status]++
+		if !status.Final() {
+			final = false
+		}
+	}
+
+	if !final {
+		switch {
+		case count[StatusFailed] > 0:
+			return StatusFailed
+		case count[StatusParked] > 0:
+			return StatusParked
+		default:
+			return StatusPending
+		}
+	}
+
+	switch {
+	case count[StatusComplete] == len(statuses):
+		return StatusComplete
+	case count[StatusComplete] > 0:
+		return StatusPartial
+	case count[StatusExpired] == len(statuses):
+		return StatusExpired
+	case count[StatusCancelled] == len(statuses):
+		return StatusCancelled
+	default:
+		return StatusDead
+	}
+}
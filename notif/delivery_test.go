@@ -0,0 +1,62 @@
+package notif_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stevenferrer/notifi/notif"
+)
+
+func TestAggregateStatus(t *testing.T) {
+	tests := []struct {
+		statuses []notif.Status
+		want     notif.Status
+	}{
+		{statuses: nil, want: notif.StatusPending},
+		{
+			statuses: []notif.Status{notif.StatusComplete, notif.StatusPending},
+			want:     notif.StatusPending,
+		},
+		{
+			statuses: []notif.Status{notif.StatusComplete, notif.StatusParked},
+			want:     notif.StatusParked,
+		},
+		{
+			statuses: []notif.Status{notif.StatusParked, notif.StatusFailed},
+			want:     notif.StatusFailed,
+		},
+		{
+			statuses: []notif.Status{notif.StatusComplete, notif.StatusComplete},
+			want:     notif.StatusComplete,
+		},
+		{
+			statuses: []notif.Status{notif.StatusComplete, notif.StatusDead},
+			want:     notif.StatusPartial,
+		},
+		{
+			statuses: []notif.Status{notif.StatusExpired, notif.StatusExpired},
+			want:     notif.StatusExpired,
+		},
+		{
+			statuses: []notif.Status{notif.StatusExpired, notif.StatusDead},
+			want:     notif.StatusDead,
+		},
+		{
+			statuses: []notif.Status{notif.StatusSkipped, notif.StatusComplete},
+			want:     notif.StatusComplete,
+		},
+		{
+			statuses: []notif.Status{notif.StatusSkipped, notif.StatusPending},
+			want:     notif.StatusPending,
+		},
+		{
+			statuses: []notif.Status{notif.StatusSkipped, notif.StatusSkipped},
+			want:     notif.StatusSkipped,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, notif.AggregateStatus(tc.statuses), tc.statuses)
+	}
+}
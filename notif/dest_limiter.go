@@ -0,0 +1,59 @@
+package notif
+
+import (
+	"sync"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+// destKey is the destination of a delivery, each
+// callback is a separate endpoint of the receiver
+type destKey struct {
+	callbackID callback.ID
+}
+
+// destLimiter limits the number of concurrent deliveries per destination
+type destLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active map[destKey]int
+}
+
+func newDestLimiter(limit int) *destLimiter {
+	return &destLimiter{
+		limit:  limit,
+		active: make(map[destKey]int),
+	}
+}
+
+// acquire takes a delivery slot of the destination,
+// it returns false if the destination is at its limit
+func (dl *destLimiter) acquire(key destKey) bool {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	// no limit
+	if dl.limit <= 0 {
+		return true
+	}
+
+	if dl.active[key] >= dl.limit {
+		return false
+	}
+
+	dl.active[key]++
+	return true
+}
+
+// release gives back the delivery slot of the destination
+func (dl *destLimiter) release(key destKey) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	if dl.active[key] <= 1 {
+		delete(dl.active, key)
+		return
+	}
+
+	dl.active[key]--
+}
@@ -0,0 +1,36 @@
+package notif
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDestLimiter(t *testing.T) {
+	dl := newDestLimiter(2)
+
+	key1 := destKey{callbackID: "callback1"}
+	key2 := destKey{callbackID: "callback2"}
+
+	assert.True(t, dl.acquire(key1))
+	assert.True(t, dl.acquire(key1))
+	// destination is at its limit
+	assert.False(t, dl.acquire(key1))
+	// other destinations are not affected
+	assert.True(t, dl.acquire(key2))
+
+	dl.release(key1)
+	assert.True(t, dl.acquire(key1))
+
+	dl.release(key1)
+	dl.release(key1)
+	dl.release(key2)
+	assert.Empty(t, dl.active)
+
+	t.Run("no limit", func(t *testing.T) {
+		dl := newDestLimiter(0)
+		for i := 0; i < 100; i++ {
+			assert.True(t, dl.acquire(key1))
+		}
+	})
+}
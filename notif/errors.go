@@ -1,7 +1,34 @@
 package notif
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
-	ErrNotifNotFound = errors.New("notification not found")
+	ErrNotifNotFound     = errors.New("notification not found")
+	ErrNotifNotScheduled = errors.New("notification not scheduled")
+	ErrInvalidExpiry     = errors.New("invalid expiry")
+	ErrDeliveryNotFound  = errors.New("delivery not found")
+	ErrEventNotFound     = errors.New("event not found")
 )
+
+// DeferError postpones the processing of the message
+// without counting it as a delivery attempt
+type DeferError struct {
+	// Reason is the reason why the message was deferred
+	Reason string
+	// Delay is the delay before the message is processed again
+	Delay time.Duration
+}
+
+func (e *DeferError) Error() string {
+	return "deferred: " + e.Reason
+}
+
+// permanentError is an error that shouldn't be retried
+type permanentError struct{ error }
+
+func (e *permanentError) Unwrap() error { return e.error }
+
+func (e *permanentError) Retryable() bool { return false }
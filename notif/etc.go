@@ -10,6 +10,14 @@ func NewID() ID {
 	return ID(genUUID())
 }
 
+func NewDeliveryID() DeliveryID {
+	return DeliveryID(genUUID())
+}
+
+func NewEventID() EventID {
+	return EventID(genUUID())
+}
+
 func genUUID() string {
 	return strings.ReplaceAll(uuid.NewString(), "-", "")
 }
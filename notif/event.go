@@ -0,0 +1,30 @@
+package notif
+
+import (
+	"time"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/token"
+)
+
+// EventID is the event ID
+type EventID string
+
+const (
+	NilEventID EventID = ""
+)
+
+// Event is a notification broadcasted to all the subscribers of the
+// callback type, each subscriber gets its own notification of the event
+type Event struct {
+	// ID is the event ID
+	ID EventID
+	// SrcTokenID is the token id of the publisher
+	SrcTokenID token.ID
+	// CBType is the callback type
+	CBType callback.CBType
+	// Payload is the event payload in JSON format
+	Payload map[string]interface{}
+	// CreatedAt is the created timestamp
+	CreatedAt *time.Time
+}
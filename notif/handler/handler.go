@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pkg/errors"
@@ -10,6 +11,7 @@ import (
 	"github.com/unrolled/render"
 
 	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/eventtype"
 	"github.com/stevenferrer/notifi/notif"
 	"github.com/stevenferrer/notifi/notifihttp"
 	"github.com/stevenferrer/notifi/token"
@@ -42,8 +44,11 @@ func NewNotifHandler(notifSvc notif.Service, logger zerolog.Logger) http.Handler
 
 	addRoute(http.MethodPost, "/", createNotif(nth))
 	// addRoute(http.MethodGet, "/", getNotifs(nth))
+	addRoute(http.MethodGet, "/events/{event_id}", getEvent(nth))
 	addRoute(http.MethodGet, "/{notif_id}", getNotif(nth))
 	addRoute(http.MethodPost, "/{notif_id}/resend", resendNotif(nth))
+	addRoute(http.MethodPost, "/{notif_id}/cancel", cancelNotif(nth))
+	addRoute(http.MethodGet, "/{notif_id}/attempts", listAttempts(nth))
 
 	return nth
 }
@@ -68,15 +73,41 @@ func (nth *notifHandler) handleError(w http.ResponseWriter, r *http.Request, err
 }
 
 type createNotifRequest struct {
-	DestTokenID token.ID               `json:"dest_token_id"`
-	CBType      callback.CBType        `json:"callback_type"`
-	Payload     map[string]interface{} `json:"payload"`
+	DestTokenID  token.ID               `json:"dest_token_id"`
+	CBType       callback.CBType        `json:"callback_type"`
+	Payload      map[string]interface{} `json:"payload"`
+	OrderingKey  string                 `json:"ordering_key"`
+	DeliverAt    *time.Time             `json:"deliver_at"`
+	ExpiresAt    *time.Time             `json:"expires_at"`
+	TTL          *int64                 `json:"ttl"`
+	EventVersion int                    `json:"event_version"`
 }
 
 type createNotifResponse struct {
 	NotifID notif.ID `json:"notification_id"`
 }
 
+type publishEventResponse struct {
+	EventID  notif.EventID `json:"event_id"`
+	NotifIDs []notif.ID    `json:"notification_ids"`
+}
+
+// newInvalidNotifError returns the bad request error of the notification
+// validation error, nil if the error is not a validation error
+func newInvalidNotifError(err error) *notifihttp.Error {
+	var validationErr *eventtype.ValidationError
+	if errors.As(err, &validationErr) {
+		return notifihttp.NewValidationError(err, validationErr.Errors)
+	}
+
+	if err == notif.ErrInvalidExpiry || err == callback.ErrInvalidCBType ||
+		err == eventtype.ErrEventTypeNotFound || err == eventtype.ErrVersionNotFound {
+		return notifihttp.NewBadRequestError(err)
+	}
+
+	return nil
+}
+
 func createNotif(nth *notifHandler) notifihttp.Handler {
 	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 		token, ok := notifihttp.TokenFromCtx(r.Context())
@@ -90,13 +121,52 @@ func createNotif(nth *notifHandler) notifihttp.Handler {
 			return notifihttp.NewBadRequestError(err)
 		}
 
-		notifID, err := nth.notifSvc.CreateNotif(r.Context(), notif.Notif{
-			SrcTokenID:  token.ID,
-			DestTokenID: request.DestTokenID,
-			CBType:      request.CBType,
-			Payload:     request.Payload,
-		})
+		// ttl is the time to live in seconds, an alternative to expires at
+		expiresAt := request.ExpiresAt
+		if request.TTL != nil {
+			if expiresAt != nil || *request.TTL <= 0 {
+				return notifihttp.NewBadRequestError(notif.ErrInvalidExpiry)
+			}
+
+			t := time.Now().Add(time.Duration(*request.TTL) * time.Second)
+			expiresAt = &t
+		}
+
+		nf := notif.Notif{
+			SrcTokenID:   token.ID,
+			DestTokenID:  request.DestTokenID,
+			CBType:       request.CBType,
+			Payload:      request.Payload,
+			OrderingKey:  request.OrderingKey,
+			DeliverAt:    request.DeliverAt,
+			ExpiresAt:    expiresAt,
+			EventVersion: request.EventVersion,
+		}
+
+		// Without destination, the notification is
+		// broadcasted to all the subscribers
+		if nf.DestTokenID == "" {
+			eventID, notifIDs, err := nth.notifSvc.PublishEvent(r.Context(), nf)
+			if err != nil {
+				if apiErr := newInvalidNotifError(err); apiErr != nil {
+					return apiErr
+				}
+
+				return errors.Wrap(err, "publish event")
+			}
+
+			return nth.render.JSON(w, http.StatusOK, publishEventResponse{
+				EventID:  eventID,
+				NotifIDs: notifIDs,
+			})
+		}
+
+		notifID, err := nth.notifSvc.CreateNotif(r.Context(), nf)
 		if err != nil {
+			if apiErr := newInvalidNotifError(err); apiErr != nil {
+				return apiErr
+			}
+
 			return errors.Wrap(err, "create notif")
 		}
 
@@ -107,10 +177,22 @@ func createNotif(nth *notifHandler) notifihttp.Handler {
 }
 
 type getNotifResponse struct {
-	ID      notif.ID               `json:"notification_id"`
-	CBType  callback.CBType        `json:"callback_type"`
-	Status  notif.Status           `json:"status"`
-	Payload map[string]interface{} `json:"payload"`
+	ID           notif.ID               `json:"notification_id"`
+	CBType       callback.CBType        `json:"callback_type"`
+	Status       notif.Status           `json:"status"`
+	Payload      map[string]interface{} `json:"payload"`
+	OrderingKey  string                 `json:"ordering_key,omitempty"`
+	DeliverAt    *time.Time             `json:"deliver_at,omitempty"`
+	ExpiresAt    *time.Time             `json:"expires_at,omitempty"`
+	EventID      notif.EventID          `json:"event_id,omitempty"`
+	EventVersion int                    `json:"event_version,omitempty"`
+	Deliveries   []deliveryResponse     `json:"deliveries"`
+}
+
+type deliveryResponse struct {
+	ID         notif.DeliveryID `json:"delivery_id"`
+	CallbackID callback.ID      `json:"callback_id"`
+	Status     notif.Status     `json:"status"`
 }
 
 func getNotif(nth *notifHandler) notifihttp.Handler {
@@ -125,11 +207,84 @@ func getNotif(nth *notifHandler) notifihttp.Handler {
 			return errors.Wrap(err, "get notif")
 		}
 
+		deliveries, err := nth.notifSvc.ListDeliveries(r.Context(), notifID)
+		if err != nil {
+			return errors.Wrap(err, "list deliveries")
+		}
+
 		response := getNotifResponse{
-			ID:      nf.ID,
-			CBType:  nf.CBType,
-			Status:  nf.Status,
-			Payload: nf.Payload,
+			ID:           nf.ID,
+			CBType:       nf.CBType,
+			Status:       nf.Status,
+			Payload:      nf.Payload,
+			OrderingKey:  nf.OrderingKey,
+			DeliverAt:    nf.DeliverAt,
+			ExpiresAt:    nf.ExpiresAt,
+			EventID:      nf.EventID,
+			EventVersion: nf.EventVersion,
+			Deliveries:   []deliveryResponse{},
+		}
+		for _, delivery := range deliveries {
+			response.Deliveries = append(response.Deliveries, deliveryResponse{
+				ID:         delivery.ID,
+				CallbackID: delivery.CallbackID,
+				Status:     delivery.Status,
+			})
+		}
+
+		return nth.render.JSON(w, http.StatusOK, response)
+	})
+}
+
+type eventNotifResponse struct {
+	ID          notif.ID     `json:"notification_id"`
+	DestTokenID token.ID     `json:"dest_token_id"`
+	Status      notif.Status `json:"status"`
+}
+
+type getEventResponse struct {
+	ID            notif.EventID          `json:"event_id"`
+	CBType        callback.CBType        `json:"callback_type"`
+	Payload       map[string]interface{} `json:"payload"`
+	CreatedAt     *time.Time             `json:"created_at"`
+	Notifications []eventNotifResponse   `json:"notifications"`
+}
+
+func getEvent(nth *notifHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		eventID := notif.EventID(chi.URLParam(r, "event_id"))
+		event, nfs, err := nth.notifSvc.GetEvent(r.Context(), eventID)
+		if err != nil {
+			if err == notif.ErrEventNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "get event")
+		}
+
+		// only the publisher can see the subscribers
+		if event.SrcTokenID != token.ID {
+			return notifihttp.NewNotFoundError(notif.ErrEventNotFound)
+		}
+
+		response := getEventResponse{
+			ID:            event.ID,
+			CBType:        event.CBType,
+			Payload:       event.Payload,
+			CreatedAt:     event.CreatedAt,
+			Notifications: []eventNotifResponse{},
+		}
+		for _, nf := range nfs {
+			response.Notifications = append(response.Notifications, eventNotifResponse{
+				ID:          nf.ID,
+				DestTokenID: nf.DestTokenID,
+				Status:      nf.Status,
+			})
 		}
 
 		return nth.render.JSON(w, http.StatusOK, response)
@@ -149,3 +304,107 @@ func resendNotif(nth *notifHandler) notifihttp.Handler {
 		})
 	})
 }
+
+func cancelNotif(nth *notifHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		notifID := notif.ID(chi.URLParam(r, "notif_id"))
+		nf, err := nth.notifSvc.GetNotif(r.Context(), notifID)
+		if err != nil {
+			if err == notif.ErrNotifNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "get notif")
+		}
+
+		// only the sender can cancel the notification
+		if nf.SrcTokenID != token.ID {
+			return notifihttp.NewNotFoundError(notif.ErrNotifNotFound)
+		}
+
+		err = nth.notifSvc.CancelNotif(r.Context(), notifID)
+		if err != nil {
+			switch err {
+			case notif.ErrNotifNotFound:
+				return notifihttp.NewNotFoundError(err)
+			case notif.ErrNotifNotScheduled:
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return errors.Wrap(err, "cancel notif")
+		}
+
+		return nth.render.JSON(w, http.StatusOK, map[string]string{
+			"message": "cancel ok",
+		})
+	})
+}
+
+type attemptResponse struct {
+	DeliveryID     notif.DeliveryID `json:"delivery_id,omitempty"`
+	AttemptNo      int              `json:"attempt_no"`
+	URL            string           `json:"url"`
+	ResponseStatus int              `json:"response_status"`
+	LatencyMs      int64            `json:"latency_ms"`
+	ResponseBody   string           `json:"response_body"`
+	Error          string           `json:"error"`
+	CreatedAt      time.Time        `json:"created_at"`
+}
+
+type listAttemptsResponse struct {
+	Attempts []attemptResponse `json:"attempts"`
+}
+
+func listAttempts(nth *notifHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		notifID := notif.ID(chi.URLParam(r, "notif_id"))
+		nf, err := nth.notifSvc.GetNotif(r.Context(), notifID)
+		if err != nil {
+			if err == notif.ErrNotifNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "get notif")
+		}
+
+		// only the sender and the receiver can list the attempts
+		if nf.SrcTokenID != token.ID && nf.DestTokenID != token.ID {
+			return notifihttp.NewNotFoundError(notif.ErrNotifNotFound)
+		}
+
+		attempts, err := nth.notifSvc.ListAttempts(r.Context(), notifID)
+		if err != nil {
+			if err == notif.ErrNotifNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return errors.Wrap(err, "list attempts")
+		}
+
+		response := listAttemptsResponse{Attempts: []attemptResponse{}}
+		for _, attempt := range attempts {
+			response.Attempts = append(response.Attempts, attemptResponse{
+				DeliveryID:     attempt.DeliveryID,
+				AttemptNo:      attempt.AttemptNo,
+				URL:            attempt.URL,
+				ResponseStatus: attempt.ResponseStatus,
+				LatencyMs:      attempt.Latency.Milliseconds(),
+				ResponseBody:   attempt.ResponseBody,
+				Error:          attempt.Error,
+				CreatedAt:      attempt.CreatedAt,
+			})
+		}
+
+		return nth.render.JSON(w, http.StatusOK, response)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/stevenferrer/notifi/callback"
 	callbacksvc "github.com/stevenferrer/notifi/callback/service"
+	"github.com/stevenferrer/notifi/eventtype"
 	"github.com/stevenferrer/notifi/notif"
 	nfhandler "github.com/stevenferrer/notifi/notif/handler"
 	"github.com/stevenferrer/notifi/notifihttp"
@@ -36,12 +38,14 @@ func TestNotifHandler(t *testing.T) {
 	tokenMw := tkhandler.NewTokenMw(tokenSvc)
 
 	callbackRepo := postgres.NewCallbackRepository(db)
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
 	requestSender := notifihttp.NewDefaultRequestSender()
 	callbackSvc := callbacksvc.NewCallbackService(callbackRepo,
-		tokenRepo, requestSender)
+		tokenRepo, eventTypeRepo, requestSender)
 
 	notifRepo := postgres.NewNotifRepository(db)
-	notifSvc := notif.NewNotifService(notifRepo, &notif.NopSender{})
+	notifSvc := notif.NewNotifService(notifRepo, callbackRepo,
+		tokenRepo, eventTypeRepo, &notif.NopSender{})
 
 	logger := zerolog.New(os.Stderr)
 	notifHandler := nfhandler.NewNotifHandler(notifSvc, logger)
@@ -62,6 +66,15 @@ func TestNotifHandler(t *testing.T) {
 	_, err = callbackSvc.CreateCallback(ctx, cb)
 	require.NoError(t, err)
 
+	// register the event type
+	err = eventTypeRepo.CreateEventType(ctx, eventtype.EventType{
+		Name:    cb.CBType,
+		TokenID: tk.ID,
+		Schema: json.RawMessage(`{"type": "object", "required": ["id"],
+			"properties": {"id": {"type": "string"}}}`),
+	})
+	require.NoError(t, err)
+
 	var notifID notif.ID
 	t.Run("Create notification", func(t *testing.T) {
 		var request = struct {
@@ -101,6 +114,37 @@ func TestNotifHandler(t *testing.T) {
 		notifID = response.NotifID
 	})
 
+	t.Run("Create notification with invalid payload", func(t *testing.T) {
+		createNotif := func(body string) *httptest.ResponseRecorder {
+			httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+				"/", strings.NewReader(body))
+			require.NoError(t, err)
+
+			httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+			rr := httptest.NewRecorder()
+			authHandler.ServeHTTP(rr, httpReq)
+			return rr
+		}
+
+		// payload doesn't match the schema
+		rr := createNotif(`{"dest_token_id":"` + string(tk.ID) + `",
+			"callback_type":"INVOICE","payload":{"id":1234}}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		var response = struct {
+			Errors []string `json:"errors"`
+		}{}
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"payload.id: expected string, got number"}, response.Errors)
+
+		// unknown event type
+		rr = createNotif(`{"dest_token_id":"` + string(tk.ID) + `",
+			"callback_type":"INVOCE","payload":{"id":"1234"}}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
 	t.Run("Get notification", func(t *testing.T) {
 		httpReq, err := http.NewRequestWithContext(ctx,
 			http.MethodGet, "/"+string(notifID), nil)
@@ -125,4 +169,51 @@ func TestNotifHandler(t *testing.T) {
 		assert.NotEmpty(t, response.Status)
 		assert.NotNil(t, response.Payload)
 	})
+
+	t.Run("List attempts", func(t *testing.T) {
+		httpReq, err := http.NewRequestWithContext(ctx,
+			http.MethodGet, "/"+string(notifID)+"/attempts", nil)
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+		rr := httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response = struct {
+			Attempts []map[string]interface{} `json:"attempts"`
+		}{}
+		err = json.NewDecoder(rr.Body).Decode(&response)
+		require.NoError(t, err)
+
+		// nothing has been sent yet
+		assert.NotNil(t, response.Attempts)
+		assert.Empty(t, response.Attempts)
+
+		// not found notification
+		httpReq, err = http.NewRequestWithContext(ctx,
+			http.MethodGet, "/"+string(notif.NewID())+"/attempts", nil)
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", string(tk.ID))
+
+		rr = httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		// the other tokens can't list the attempts
+		otherTk, err := tokenSvc.CreateToken(ctx)
+		require.NoError(t, err)
+
+		httpReq, err = http.NewRequestWithContext(ctx,
+			http.MethodGet, "/"+string(notifID)+"/attempts", nil)
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", string(otherTk.ID))
+
+		rr = httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
 }
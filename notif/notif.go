@@ -27,8 +27,24 @@ type Notif struct {
 	Status Status
 	// Payload is the notification payload in JSON format
 	Payload map[string]interface{}
+	// OrderingKey groups the notifications of the destination that must be
+	// delivered in sequence, the callback type is used if empty
+	OrderingKey string
+	// Seq is the sequence number of the notification
+	Seq int64
+	// DeliverAt is the scheduled delivery time, nil to deliver right away
+	DeliverAt *time.Time
+	// ExpiresAt is the time after which the notification is not delivered anymore
+	ExpiresAt *time.Time
+	// EventID is the broadcasted event of the notification, if any
+	EventID EventID
+	// EventVersion is the event type version of the payload, 0 is the latest version
+	EventVersion int
 	// CreatedAt is the created timestamp
 	CreatedAt *time.Time
+}
 
-	// TODO: We could probably attach the send events here? or use a separate table?
+// Expired reports whether the notification is expired at the given time
+func (nf Notif) Expired(now time.Time) bool {
+	return nf.ExpiresAt != nil && !now.Before(*nf.ExpiresAt)
 }
@@ -4,22 +4,54 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"go.uber.org/multierr"
 
 	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/channel"
+	"github.com/stevenferrer/notifi/eventtype"
+	"github.com/stevenferrer/notifi/filter"
 	"github.com/stevenferrer/notifi/idemp"
 	"github.com/stevenferrer/notifi/notifihttp"
+	"github.com/stevenferrer/notifi/signature"
 	"github.com/stevenferrer/notifi/token"
 )
 
+const (
+	// minOrderingDelay and maxOrderingDelay bound the delay of the ordered
+	// notifications waiting for the earlier notifications of the ordering key
+	minOrderingDelay = time.Second
+	maxOrderingDelay = time.Minute
+)
+
+// orderingDelay doubles the delay each time the message is deferred
+func orderingDelay(deferrals int) time.Duration {
+	delay := minOrderingDelay
+	for i := 0; i < deferrals && delay < maxOrderingDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxOrderingDelay {
+		delay = maxOrderingDelay
+	}
+
+	return delay
+}
+
 type NotifMsgProcessor struct {
-	requestSender notifihttp.RequestSender
+	channels      *channel.Registry
 	callbackRepo  callback.Repository
 	notifRepo     Repository
 	tokenRepo     token.Repository
 	idempRepo     idemp.Repository
+	eventTypeRepo eventtype.Repository
+	breakerConfig callback.BreakerConfig
+	rateLimiter   *rateLimiter
+	logger        zerolog.Logger
 }
 
 func NewNotifMessageProcessor(
@@ -28,16 +60,116 @@ func NewNotifMessageProcessor(
 	notifRepo Repository,
 	tokenRepo token.Repository,
 	idemprepo idemp.Repository,
+	eventTypeRepo eventtype.Repository,
+	logger zerolog.Logger,
 ) *NotifMsgProcessor {
 	return &NotifMsgProcessor{
-		requestSender: requestSender,
+		channels:      channel.NewDefaultRegistry(requestSender),
 		callbackRepo:  callbackRepo,
 		notifRepo:     notifRepo,
 		tokenRepo:     tokenRepo,
 		idempRepo:     idemprepo,
+		eventTypeRepo: eventTypeRepo,
+		breakerConfig: callback.DefaultBreakerConfig,
+		rateLimiter:   newRateLimiter(),
+		logger:        logger,
 	}
 }
 
+// WithBreakerConfig overrides the default circuit breaker settings
+func (nmp *NotifMsgProcessor) WithBreakerConfig(breakerConfig callback.BreakerConfig) *NotifMsgProcessor {
+	nmp.breakerConfig = breakerConfig
+	return nmp
+}
+
+// WithChannels overrides the delivery channels, only webhooks are delivered by default
+func (nmp *NotifMsgProcessor) WithChannels(channels *channel.Registry) *NotifMsgProcessor {
+	nmp.channels = channels
+	return nmp
+}
+
+// FanOut creates the deliveries of the notification to all the callbacks
+// subscribed to the callback type and returns the messages of the
+// deliveries that are not done yet
+func (nmp *NotifMsgProcessor) FanOut(ctx context.Context, notifMsg NotifMsg) ([]NotifMsg, error) {
+	// Expired notifications are worthless
+	if notifMsg.Expired(time.Now()) {
+		err := UpdateMsgStatus(ctx, nmp.notifRepo, notifMsg, StatusExpired)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+
+	cbs, err := nmp.callbackRepo.ListCbsByTokenIDnCbType(
+		ctx, notifMsg.DestTokenID, notifMsg.CBType)
+	if err != nil {
+		return nil, errors.Wrap(err, "list cbs by token id and cb type")
+	}
+
+	// Overlapping subscriptions of an endpoint only get one delivery
+	cbs = callback.Resolve(cbs, notifMsg.CBType)
+
+	// The receiver might register a callback later
+	if len(cbs) == 0 {
+		return nil, nmp.fail(ctx, notifMsg, callback.ErrCallbackNotFound)
+	}
+
+	// The notifications that don't pass the filter
+	// of the callback are skipped instead of queued
+	deliveries := make([]Delivery, 0, len(cbs))
+	for _, cb := range cbs {
+		status := StatusPending
+		if !nmp.passFilter(cb, notifMsg.Payload) {
+			status = StatusSkipped
+		}
+
+		deliveries = append(deliveries, Delivery{
+			ID:         NewDeliveryID(),
+			NotifID:    notifMsg.NotifID,
+			CallbackID: cb.ID,
+			Status:     status,
+		})
+	}
+
+	deliveries, err = nmp.notifRepo.CreateDeliveries(ctx, notifMsg.NotifID, deliveries)
+	if err != nil {
+		return nil, errors.Wrap(err, "create deliveries")
+	}
+
+	deliveryMsgs := []NotifMsg{}
+	for _, delivery := range deliveries {
+		// Skipped or already done if the fan out is retried
+		if delivery.Status.Final() {
+			continue
+		}
+
+		deliveryMsgs = append(deliveryMsgs, notifMsg.deliveryMsg(delivery))
+	}
+
+	return deliveryMsgs, nil
+}
+
+// passFilter reports whether the payload passes the filter of the callback
+func (nmp *NotifMsgProcessor) passFilter(cb callback.Callback, payload map[string]interface{}) bool {
+	if cb.Filter == "" {
+		return true
+	}
+
+	f, err := filter.Parse(cb.Filter)
+	if err != nil {
+		// Filters are validated when saved so this shouldn't happen
+		nmp.logger.Error().Err(err).
+			Str("callback_id", string(cb.ID)).
+			Msg("parse filter")
+		return false
+	}
+
+	return f.Match(payload)
+}
+
+// Process sends the notification to the callback of the delivery
 func (nmp *NotifMsgProcessor) Process(ctx context.Context, msgBody []byte) error {
 	var notifMsg NotifMsg
 	err := json.NewDecoder(bytes.NewBuffer(msgBody)).Decode(&notifMsg)
@@ -45,6 +177,35 @@ func (nmp *NotifMsgProcessor) Process(ctx context.Context, msgBody []byte) error
 		return errors.Wrap(err, "json decode message")
 	}
 
+	if notifMsg.DeliveryID == NilDeliveryID {
+		return errors.New("message is not fanned out")
+	}
+
+	// The duplicate and stale messages of the final
+	// deliveries e.g. the cancelled ones are not sent
+	delivery, err := nmp.notifRepo.GetDelivery(ctx, notifMsg.DeliveryID)
+	if err != nil {
+		if err == ErrDeliveryNotFound {
+			return &permanentError{err}
+		}
+
+		return errors.Wrap(err, "get delivery")
+	}
+
+	if delivery.Status.Final() {
+		return nil
+	}
+
+	// Expired notifications are worthless
+	if notifMsg.Expired(time.Now()) {
+		err = UpdateMsgStatus(ctx, nmp.notifRepo, notifMsg, StatusExpired)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
 	// Compute and save idempkey
 	idempKey, err := notifMsg.IdempKey()
 	if err != nil {
@@ -57,54 +218,285 @@ func (nmp *NotifMsgProcessor) Process(ctx context.Context, msgBody []byte) error
 		return errors.Wrap(err, "save idemp key")
 	}
 
-	// 1. Retrieve URL from database
-	cb, err := nmp.callbackRepo.GetCbByTokenIDnCbType(
-		ctx, notifMsg.DestTokenID, notifMsg.CBType)
+	// Retrieve the callback of the delivery
+	cb, err := nmp.callbackRepo.GetCallback(ctx, notifMsg.CallbackID)
 	if err != nil {
-		return errors.Wrap(err, "get cb by token id and cb type")
+		if err == callback.ErrCallbackNotFound {
+			// The callback was removed after the fan out
+			return &permanentError{err}
+		}
+
+		return errors.Wrap(err, "get callback")
 	}
 
-	tk, err := nmp.tokenRepo.GetToken(ctx, cb.TokenID)
-	if err != nil {
-		return errors.Wrap(err, "get token")
+	// Disabled callbacks don't receive notifications anymore
+	if cb.DisabledAt != nil {
+		return &permanentError{callback.ErrCallbackDisabled}
 	}
 
-	buf := &bytes.Buffer{}
-	err = json.NewEncoder(buf).Encode(notifMsg.Payload)
-	if err != nil {
-		// Update notif status to failed and return an error
-		err2 := nmp.notifRepo.UpdateStatus(ctx, notifMsg.NotifID, StatusFailed)
+	// Wait for the earlier notifications of the ordering key
+	if cb.Ordered {
+		blocked, err := nmp.isBlocked(ctx, notifMsg.NotifID, cb.ID)
 		if err != nil {
-			err = multierr.Append(err, err2)
-			return errors.Wrap(err, "update notif status")
+			return errors.Wrap(err, "check ordering")
 		}
 
-		return errors.Wrap(err, "json encode notif payload")
+		if blocked {
+			return &DeferError{Reason: "waiting for earlier notifications", Delay: orderingDelay(notifMsg.Deferrals)}
+		}
+	}
+
+	// Park the notification while the endpoint is down
+	parkDelay, err := nmp.checkBreaker(ctx, cb.ID, cb.Breaker)
+	if err != nil {
+		return errors.Wrap(err, "check breaker")
 	}
 
-	headers := map[string]string{
-		"X-IDEMPOTENT-KEY": idempKey,
-		"X-CALLBACK-TOKEN": string(tk.CBKey),
+	if parkDelay > 0 {
+		return nmp.park(ctx, notifMsg, parkDelay)
 	}
 
-	// 2. Send the notification request
-	err = nmp.requestSender.SendRequest(ctx, cb.URL, buf, headers)
+	// Delay the notification if the rate limit is reached
+	if delay := nmp.rateLimiter.reserve(cb.ID, cb.RateLimit, time.Now()); delay > 0 {
+		return &DeferError{Reason: "rate limit reached", Delay: delay}
+	}
+
+	// Sign with all the active keys so that receivers
+	// can switch keys while the callback key is being rotated
+	cbKeys, err := nmp.tokenRepo.GetActiveCBKeys(ctx, cb.TokenID)
+	if err != nil {
+		return errors.Wrap(err, "get active cb keys")
+	}
+
+	payload, eventVersion, err := nmp.convertPayload(ctx, notifMsg, *cb)
 	if err != nil {
-		// Update notif status to failed and return an error
-		err2 := nmp.notifRepo.UpdateStatus(ctx, notifMsg.NotifID, StatusFailed)
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if cb.Template != "" {
+		// Rendering is deterministic so retrying won't help
+		body, err := cb.RenderPayload(payload)
 		if err != nil {
-			err = multierr.Append(err, err2)
-			return errors.Wrap(err, "update notif status")
+			return &permanentError{errors.Wrap(err, "render notif payload")}
 		}
 
-		return errors.Wrap(err, "send notif request")
+		buf.Write(body)
+	} else {
+		err = json.NewEncoder(buf).Encode(payload)
+		if err != nil {
+			return nmp.fail(ctx, notifMsg,
+				errors.Wrap(err, "json encode notif payload"))
+		}
+	}
+
+	// Sign the payload so that receivers can verify the request
+	headers := signature.Headers(time.Now(), idempKey, buf.Bytes(),
+		token.CBKeys(cbKeys)...)
+	if eventVersion > 0 {
+		headers["X-EVENT-VERSION"] = strconv.Itoa(eventVersion)
+	}
+
+	// Send the notification through the channel of the callback
+	start := time.Now()
+	result, err := nmp.channels.Send(ctx, *cb, channel.Message{
+		ID:      string(notifMsg.DeliveryID),
+		CBType:  notifMsg.CBType,
+		Body:    buf.Bytes(),
+		Headers: headers,
+	})
+	nmp.recordAttempt(ctx, notifMsg, destination(*cb), time.Since(start), result, err)
+	nmp.recordBreaker(ctx, cb.ID, cb.Breaker, err)
+	if err != nil {
+		return nmp.fail(ctx, notifMsg, errors.Wrap(err, "send notif"))
 	}
 
-	// Yay, no error! Update notif status to complete
-	err = nmp.notifRepo.UpdateStatus(ctx, notifMsg.NotifID, StatusComplete)
+	// Yay, no error! Update delivery status to complete
+	err = UpdateMsgStatus(ctx, nmp.notifRepo, notifMsg, StatusComplete)
 	if err != nil {
-		return errors.Wrap(err, "update notif status")
+		return err
 	}
 
 	return nil
 }
+
+// convertPayload converts the payload to the event type version pinned
+// by the callback and returns the converted payload and its version
+func (nmp *NotifMsgProcessor) convertPayload(ctx context.Context, notifMsg NotifMsg,
+	cb callback.Callback) (map[string]interface{}, int, error) {
+	if notifMsg.EventVersion == 0 || cb.EventVersion == 0 ||
+		cb.EventVersion == notifMsg.EventVersion {
+		return notifMsg.Payload, notifMsg.EventVersion, nil
+	}
+
+	versions, err := nmp.eventTypeRepo.ListVersions(ctx, notifMsg.CBType)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "list versions")
+	}
+
+	payload, err := eventtype.Convert(versions, notifMsg.Payload,
+		notifMsg.EventVersion, cb.EventVersion)
+	if err != nil {
+		// The pinned version doesn't exist
+		return nil, 0, &permanentError{errors.Wrap(err, "convert payload")}
+	}
+
+	return payload, cb.EventVersion, nil
+}
+
+// fail updates the message status to failed and returns the error
+func (nmp *NotifMsgProcessor) fail(ctx context.Context, notifMsg NotifMsg, err error) error {
+	err2 := UpdateMsgStatus(ctx, nmp.notifRepo, notifMsg, StatusFailed)
+	if err2 != nil {
+		return multierr.Append(err, err2)
+	}
+
+	return err
+}
+
+// UpdateStatus updates the status of the message
+func (nmp *NotifMsgProcessor) UpdateStatus(ctx context.Context, notifMsg NotifMsg, status Status) error {
+	return UpdateMsgStatus(ctx, nmp.notifRepo, notifMsg, status)
+}
+
+// RetryConfig returns the retry config of the callback,
+// it returns nil if the callback doesn't have one
+func (nmp *NotifMsgProcessor) RetryConfig(ctx context.Context, cbID callback.ID) (*callback.RetryConfig, error) {
+	cb, err := nmp.callbackRepo.GetCallback(ctx, cbID)
+	if err != nil {
+		return nil, err
+	}
+
+	return cb.RetryConfig, nil
+}
+
+// isBlocked reports whether an earlier notification with the
+// same ordering key is not done processing for the callback
+func (nmp *NotifMsgProcessor) isBlocked(ctx context.Context, notifID ID, cbID callback.ID) (bool, error) {
+	nf, err := nmp.notifRepo.GetNotif(ctx, notifID)
+	if err != nil {
+		return false, errors.Wrap(err, "get notif")
+	}
+
+	blocked, err := nmp.notifRepo.HasPendingPredecessor(ctx, *nf, cbID)
+	if err != nil {
+		return false, errors.Wrap(err, "has pending predecessor")
+	}
+
+	return blocked, nil
+}
+
+// checkBreaker returns how long the delivery must wait if the breaker of the
+// callback is open. Otherwise, it returns 0 and the delivery can proceed.
+func (nmp *NotifMsgProcessor) checkBreaker(ctx context.Context,
+	cbID callback.ID, breaker callback.Breaker) (time.Duration, error) {
+	if breaker.State != callback.BreakerOpen &&
+		breaker.State != callback.BreakerHalfOpen {
+		return 0, nil
+	}
+
+	now := time.Now()
+	var delay time.Duration
+	err := nmp.callbackRepo.UpdateBreaker(ctx, cbID, func(cb *callback.Callback) error {
+		if !cb.Breaker.Allow(now, nmp.breakerConfig) {
+			delay = cb.Breaker.NextProbeAt.Sub(now)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "update breaker")
+	}
+
+	return delay, nil
+}
+
+// park puts the delivery on hold until the given delay
+func (nmp *NotifMsgProcessor) park(ctx context.Context, notifMsg NotifMsg, delay time.Duration) error {
+	err := UpdateMsgStatus(ctx, nmp.notifRepo, notifMsg, StatusParked)
+	if err != nil {
+		return err
+	}
+
+	return &DeferError{Reason: "circuit breaker open", Delay: delay}
+}
+
+// recordBreaker updates the breaker of the callback with the delivery result.
+// Only the retryable delivery failures are counted since the other
+// responses mean that the endpoint is up. Failing to update the
+// breaker is only logged so that it doesn't affect the delivery.
+func (nmp *NotifMsgProcessor) recordBreaker(ctx context.Context,
+	cbID callback.ID, breaker callback.Breaker, sendErr error) {
+	var retryableErr retryableError
+	if sendErr != nil && !errors.As(sendErr, &retryableErr) {
+		return
+	}
+
+	failed := sendErr != nil && retryableErr.Retryable()
+	if !failed && breaker.Clean() {
+		return
+	}
+
+	now := time.Now()
+	err := nmp.callbackRepo.UpdateBreaker(ctx, cbID, func(cb *callback.Callback) error {
+		if !failed {
+			cb.Breaker.Succeed()
+			return nil
+		}
+
+		if cb.Breaker.Fail(now, nmp.breakerConfig) && cb.DisabledAt == nil {
+			cb.DisabledAt = &now
+			nmp.logger.Warn().Str("callback_id", string(cbID)).
+				Msg("callback disabled after outage")
+		}
+
+		return nil
+	})
+	if err != nil {
+		nmp.logger.Error().Err(err).
+			Str("callback_id", string(cbID)).
+			Msg("update breaker")
+	}
+}
+
+// destination returns where the callback delivers, the channel name
+// is used for the channels without urls e.g. inbox and stream
+func destination(cb callback.Callback) string {
+	if cb.URL != "" {
+		return cb.URL
+	}
+
+	if cb.Channel == "" {
+		return string(channel.Webhook)
+	}
+
+	return string(cb.Channel)
+}
+
+// recordAttempt saves the delivery attempt. Failing to save the
+// attempt is only logged so that it doesn't affect the delivery.
+func (nmp *NotifMsgProcessor) recordAttempt(ctx context.Context, notifMsg NotifMsg,
+	urlStr string, latency time.Duration, result *channel.Result, sendErr error) {
+	attempt := Attempt{
+		NotifID:    notifMsg.NotifID,
+		DeliveryID: notifMsg.DeliveryID,
+		AttemptNo:  notifMsg.RetryCount + 1,
+		URL:        urlStr,
+		Latency:    latency,
+	}
+
+	if result != nil {
+		attempt.ResponseStatus = result.StatusCode
+		attempt.ResponseBody = sanitizeText(string(result.Body))
+	}
+
+	if sendErr != nil {
+		attempt.Error = sanitizeText(sendErr.Error())
+	}
+
+	err := nmp.notifRepo.CreateAttempt(ctx, attempt)
+	if err != nil {
+		nmp.logger.Error().Err(err).
+			Str("notif_id", string(notifMsg.NotifID)).
+			Msg("create attempt")
+	}
+}
@@ -0,0 +1,27 @@
+package notif
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/channel"
+)
+
+func TestDestination(t *testing.T) {
+	tests := []struct {
+		cb   callback.Callback
+		want string
+	}{
+		{callback.Callback{URL: "https://example.com"}, "https://example.com"},
+		{callback.Callback{Channel: channel.Email, URL: "jane@example.com"}, "jane@example.com"},
+		{callback.Callback{Channel: channel.Inbox}, "inbox"},
+		{callback.Callback{Channel: channel.Stream}, "stream"},
+		{callback.Callback{}, "webhook"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, destination(tc.cb))
+	}
+}
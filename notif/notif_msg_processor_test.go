@@ -5,19 +5,26 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/jarcoal/httpmock"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/eventtype"
 	"github.com/stevenferrer/notifi/notif"
 	"github.com/stevenferrer/notifi/notifihttp"
 	"github.com/stevenferrer/notifi/postgres"
 	"github.com/stevenferrer/notifi/postgres/migration"
 	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/signature"
 	"github.com/stevenferrer/notifi/token"
 )
 
@@ -37,11 +44,12 @@ func TestNotifMsgProcessor(t *testing.T) {
 	notifRepo := postgres.NewNotifRepository(db)
 
 	idempRepo := postgres.NewIdempRepository(db)
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
 
 	requestSender := notifihttp.NewDefaultRequestSender()
 	notifMsgProc := notif.NewNotifMessageProcessor(
 		requestSender, callbackRepo, notifRepo,
-		tokenRepo, idempRepo)
+		tokenRepo, idempRepo, eventTypeRepo, zerolog.New(os.Stderr))
 
 	ctx := context.TODO()
 
@@ -51,6 +59,22 @@ func TestNotifMsgProcessor(t *testing.T) {
 
 	baseURL := "https://example.org"
 
+	// fanOut returns the message bodies of the deliveries
+	fanOut := func(t *testing.T, notifMsg notif.NotifMsg) [][]byte {
+		deliveryMsgs, err := notifMsgProc.FanOut(ctx, notifMsg)
+		require.NoError(t, err)
+
+		msgBodies := [][]byte{}
+		for _, deliveryMsg := range deliveryMsgs {
+			buf := &bytes.Buffer{}
+			err = json.NewEncoder(buf).Encode(deliveryMsg)
+			require.NoError(t, err)
+			msgBodies = append(msgBodies, buf.Bytes())
+		}
+
+		return msgBodies
+	}
+
 	t.Run("Failed send", func(t *testing.T) {
 		cbURL := baseURL + "/failed"
 		httpmock.RegisterResponder(
@@ -61,9 +85,8 @@ func TestNotifMsgProcessor(t *testing.T) {
 				if idempKey == "" {
 					return nil, errors.New("idemp key is empty")
 				}
-				cbToken := r.Header.Get("X-CALLBACK-TOKEN")
-				if cbToken == "" {
-					return nil, errors.New("callbak token empty")
+				if r.Header.Get(signature.SignatureHeader) == "" {
+					return nil, errors.New("signature is empty")
 				}
 
 				return httpmock.NewJsonResponse(http.StatusBadRequest, nil)
@@ -99,17 +122,33 @@ func TestNotifMsgProcessor(t *testing.T) {
 			CBType:      nf.CBType,
 			Payload:     nf.Payload,
 		}
-		buf := &bytes.Buffer{}
-		err = json.NewEncoder(buf).Encode(notifMsg)
+		msgBodies := fanOut(t, notifMsg)
+		require.Len(t, msgBodies, 1)
 
-		err = notifMsgProc.Process(ctx, buf.Bytes())
+		err = notifMsgProc.Process(ctx, msgBodies[0])
 		require.Error(t, err)
 
+		// bad request is a permanent failure
+		var deliveryErr *notifihttp.DeliveryError
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.Equal(t, http.StatusBadRequest, deliveryErr.StatusCode)
+		assert.False(t, deliveryErr.Retryable())
+
 		// very notif status
 		gotNf, err := notifRepo.GetNotif(ctx, nf.ID)
 		require.NoError(t, err)
 
 		assert.Equal(t, notif.StatusFailed, gotNf.Status)
+
+		// verify the attempt was recorded
+		attempts, err := notifRepo.ListAttempts(ctx, nf.ID)
+		require.NoError(t, err)
+		require.Len(t, attempts, 1)
+
+		assert.Equal(t, 1, attempts[0].AttemptNo)
+		assert.Equal(t, cbURL, attempts[0].URL)
+		assert.Equal(t, http.StatusBadRequest, attempts[0].ResponseStatus)
+		assert.NotEmpty(t, attempts[0].Error)
 	})
 
 	t.Run("Complete send", func(t *testing.T) {
@@ -121,9 +160,24 @@ func TestNotifMsgProcessor(t *testing.T) {
 				if idempKey == "" {
 					return nil, errors.New("idemp key is empty")
 				}
-				cbToken := r.Header.Get("X-CALLBACK-TOKEN")
-				if cbToken == "" {
-					return nil, errors.New("callbak token empty")
+				// verify the request signature
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					return nil, err
+				}
+
+				timestamp, err := strconv.ParseInt(r.Header.Get(signature.TimestampHeader), 10, 64)
+				if err != nil {
+					return nil, err
+				}
+
+				sigs := signature.Parse(r.Header.Get(signature.SignatureHeader))
+				if len(sigs) != 1 || sigs[0] != signature.Sign(tk.CBKey, timestamp, idempKey, body) {
+					return nil, errors.New("invalid signature")
+				}
+
+				if r.Header.Get("X-CALLBACK-TOKEN") != "" {
+					return nil, errors.New("callback token must not be sent")
 				}
 
 				return httpmock.NewJsonResponse(http.StatusOK, nil)
@@ -159,10 +213,10 @@ func TestNotifMsgProcessor(t *testing.T) {
 			CBType:      nf.CBType,
 			Payload:     nf.Payload,
 		}
-		buf := &bytes.Buffer{}
-		err = json.NewEncoder(buf).Encode(notifMsg)
+		msgBodies := fanOut(t, notifMsg)
+		require.Len(t, msgBodies, 1)
 
-		err = notifMsgProc.Process(ctx, buf.Bytes())
+		err = notifMsgProc.Process(ctx, msgBodies[0])
 		require.NoError(t, err)
 
 		// very notif status
@@ -170,5 +224,432 @@ func TestNotifMsgProcessor(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, notif.StatusComplete, gotNf.Status)
+
+		// verify the attempt was recorded
+		attempts, err := notifRepo.ListAttempts(ctx, nf.ID)
+		require.NoError(t, err)
+		require.Len(t, attempts, 1)
+
+		assert.Equal(t, http.StatusOK, attempts[0].ResponseStatus)
+		assert.Empty(t, attempts[0].Error)
+
+		// the duplicate messages of the complete delivery are not sent
+		err = notifMsgProc.Process(ctx, msgBodies[0])
+		require.NoError(t, err)
+
+		attempts, err = notifRepo.ListAttempts(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Len(t, attempts, 1)
+	})
+
+	t.Run("Open breaker", func(t *testing.T) {
+		// create callback with open breaker
+		cb := callback.Callback{
+			ID:      callback.NewID(),
+			TokenID: tk.ID,
+			CBType:  "INVOICE3",
+			URL:     baseURL + "/down",
+		}
+		err = callbackRepo.CreateCallback(ctx, cb)
+		require.NoError(t, err)
+
+		err = callbackRepo.UpdateBreaker(ctx, cb.ID, func(cb *callback.Callback) error {
+			cb.Breaker.Fail(time.Now(), callback.BreakerConfig{
+				FailureThreshold: 1,
+				ProbeInterval:    time.Minute,
+			})
+			return nil
+		})
+		require.NoError(t, err)
+
+		nf := notif.Notif{
+			ID:          notif.NewID(),
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      cb.CBType,
+			Status:      notif.StatusPending,
+			Payload: map[string]interface{}{
+				"message": "hello",
+			},
+		}
+		err = notifRepo.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		notifMsg := notif.NotifMsg{
+			NotifID:     nf.ID,
+			DestTokenID: nf.DestTokenID,
+			CBType:      nf.CBType,
+			Payload:     nf.Payload,
+		}
+		msgBodies := fanOut(t, notifMsg)
+		require.Len(t, msgBodies, 1)
+
+		// notification is parked until the next probe
+		err = notifMsgProc.Process(ctx, msgBodies[0])
+		var deferErr *notif.DeferError
+		require.ErrorAs(t, err, &deferErr)
+		assert.True(t, deferErr.Delay > 0 && deferErr.Delay <= time.Minute)
+
+		gotNf, err := notifRepo.GetNotif(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusParked, gotNf.Status)
+
+		// no delivery was attempted
+		attempts, err := notifRepo.ListAttempts(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Len(t, attempts, 0)
+
+		// disabled callback is a permanent failure
+		err = callbackRepo.UpdateBreaker(ctx, cb.ID, func(cb *callback.Callback) error {
+			now := time.Now()
+			cb.DisabledAt = &now
+			return nil
+		})
+		require.NoError(t, err)
+
+		err = notifMsgProc.Process(ctx, msgBodies[0])
+		require.ErrorIs(t, err, callback.ErrCallbackDisabled)
+
+		var retryableErr interface{ Retryable() bool }
+		require.ErrorAs(t, err, &retryableErr)
+		assert.False(t, retryableErr.Retryable())
+	})
+
+	t.Run("Ordered send", func(t *testing.T) {
+		cbURL := baseURL + "/ordered"
+		httpmock.RegisterResponder(http.MethodPost, cbURL,
+			httpmock.NewStringResponder(http.StatusOK, ""))
+
+		// create ordered callback
+		cb := callback.Callback{
+			ID:      callback.NewID(),
+			TokenID: tk.ID,
+			CBType:  "INVOICE4",
+			URL:     cbURL,
+			Ordered: true,
+		}
+		err = callbackRepo.CreateCallback(ctx, cb)
+		require.NoError(t, err)
+
+		msgBodies := [][]byte{}
+		for i := 0; i < 2; i++ {
+			nf := notif.Notif{
+				ID:          notif.NewID(),
+				SrcTokenID:  tk.ID,
+				DestTokenID: tk.ID,
+				CBType:      cb.CBType,
+				Status:      notif.StatusPending,
+				Payload:     map[string]interface{}{"seq": i},
+			}
+			err = notifRepo.CreateNotif(ctx, nf)
+			require.NoError(t, err)
+
+			msgBodies = append(msgBodies, fanOut(t, notif.NotifMsg{
+				NotifID:     nf.ID,
+				DestTokenID: nf.DestTokenID,
+				CBType:      nf.CBType,
+				Payload:     nf.Payload,
+			})...)
+		}
+
+		// second notification waits for the first one
+		err = notifMsgProc.Process(ctx, msgBodies[1])
+		var deferErr *notif.DeferError
+		require.ErrorAs(t, err, &deferErr)
+
+		err = notifMsgProc.Process(ctx, msgBodies[0])
+		require.NoError(t, err)
+
+		err = notifMsgProc.Process(ctx, msgBodies[1])
+		require.NoError(t, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		nf := notif.Notif{
+			ID:          notif.NewID(),
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      "INVOICE",
+			Status:      notif.StatusPending,
+			Payload:     map[string]interface{}{"otp": "1234"},
+		}
+		err = notifRepo.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		expiresAt := time.Now().Add(-time.Second)
+		msgBodies := fanOut(t, notif.NotifMsg{
+			NotifID:     nf.ID,
+			DestTokenID: nf.DestTokenID,
+			CBType:      nf.CBType,
+			Payload:     nf.Payload,
+			ExpiresAt:   &expiresAt,
+		})
+		assert.Empty(t, msgBodies)
+
+		gotNf, err := notifRepo.GetNotif(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusExpired, gotNf.Status)
+
+		// no delivery was attempted
+		attempts, err := notifRepo.ListAttempts(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Len(t, attempts, 0)
+	})
+
+	t.Run("Fan out", func(t *testing.T) {
+		okURL, failURL := baseURL+"/fan-out/ok", baseURL+"/fan-out/fail"
+		httpmock.RegisterResponder(http.MethodPost, okURL,
+			httpmock.NewStringResponder(http.StatusOK, ""))
+		httpmock.RegisterResponder(http.MethodPost, failURL,
+			httpmock.NewStringResponder(http.StatusBadRequest, ""))
+
+		// two endpoints for the same callback type
+		for _, cbURL := range []string{okURL, failURL} {
+			err = callbackRepo.CreateCallback(ctx, callback.Callback{
+				ID:      callback.NewID(),
+				TokenID: tk.ID,
+				CBType:  "INVOICE5",
+				URL:     cbURL,
+			})
+			require.NoError(t, err)
+		}
+
+		nf := notif.Notif{
+			ID:          notif.NewID(),
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      "INVOICE5",
+			Status:      notif.StatusPending,
+			Payload:     map[string]interface{}{"message": "hello"},
+		}
+		err = notifRepo.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		notifMsg := notif.NotifMsg{
+			NotifID:     nf.ID,
+			DestTokenID: nf.DestTokenID,
+			CBType:      nf.CBType,
+			Payload:     nf.Payload,
+		}
+		msgBodies := fanOut(t, notifMsg)
+		require.Len(t, msgBodies, 2)
+
+		for _, msgBody := range msgBodies {
+			_ = notifMsgProc.Process(ctx, msgBody)
+		}
+
+		deliveries, err := notifRepo.ListDeliveries(ctx, nf.ID)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+
+		// the failed delivery is retried on its own
+		gotNf, err := notifRepo.GetNotif(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusFailed, gotNf.Status)
+
+		// each delivery has its own attempt
+		attempts, err := notifRepo.ListAttempts(ctx, nf.ID)
+		require.NoError(t, err)
+		require.Len(t, attempts, 2)
+		assert.NotEqual(t, attempts[0].DeliveryID, attempts[1].DeliveryID)
+
+		// fanning out again skips the complete delivery
+		msgBodies = fanOut(t, notifMsg)
+		assert.Len(t, msgBodies, 1)
+
+		// no callbacks yet
+		nf.ID = notif.NewID()
+		nf.CBType = "NO_CALLBACK"
+		err = notifRepo.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		_, err = notifMsgProc.FanOut(ctx, notif.NotifMsg{
+			NotifID:     nf.ID,
+			DestTokenID: nf.DestTokenID,
+			CBType:      nf.CBType,
+			Payload:     nf.Payload,
+		})
+		require.ErrorIs(t, err, callback.ErrCallbackNotFound)
+
+		gotNf, err = notifRepo.GetNotif(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusFailed, gotNf.Status)
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		filterURL := baseURL + "/filter"
+		httpmock.RegisterResponder(http.MethodPost, filterURL,
+			httpmock.NewStringResponder(http.StatusOK, ""))
+
+		err = callbackRepo.CreateCallback(ctx, callback.Callback{
+			ID:      callback.NewID(),
+			TokenID: tk.ID,
+			CBType:  "INVOICE6",
+			URL:     filterURL,
+			Filter:  `payload.amount > 100 && payload.currency == "USD"`,
+		})
+		require.NoError(t, err)
+
+		newNotifMsg := func(payload map[string]interface{}) notif.NotifMsg {
+			nf := notif.Notif{
+				ID:          notif.NewID(),
+				SrcTokenID:  tk.ID,
+				DestTokenID: tk.ID,
+				CBType:      "INVOICE6",
+				Status:      notif.StatusPending,
+				Payload:     payload,
+			}
+			err := notifRepo.CreateNotif(ctx, nf)
+			require.NoError(t, err)
+
+			return notif.NotifMsg{
+				NotifID:     nf.ID,
+				DestTokenID: nf.DestTokenID,
+				CBType:      nf.CBType,
+				Payload:     nf.Payload,
+			}
+		}
+
+		// matching payload is delivered
+		notifMsg := newNotifMsg(map[string]interface{}{
+			"amount": 150, "currency": "USD"})
+		msgBodies := fanOut(t, notifMsg)
+		require.Len(t, msgBodies, 1)
+
+		// non-matching payload is skipped
+		notifMsg = newNotifMsg(map[string]interface{}{
+			"amount": 50, "currency": "USD"})
+		msgBodies = fanOut(t, notifMsg)
+		assert.Empty(t, msgBodies)
+
+		deliveries, err := notifRepo.ListDeliveries(ctx, notifMsg.NotifID)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, notif.StatusSkipped, deliveries[0].Status)
+
+		gotNf, err := notifRepo.GetNotif(ctx, notifMsg.NotifID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusSkipped, gotNf.Status)
+	})
+
+	t.Run("Template", func(t *testing.T) {
+		templateURL := baseURL + "/template"
+		var gotBody []byte
+		httpmock.RegisterResponder(http.MethodPost, templateURL,
+			func(req *http.Request) (*http.Response, error) {
+				var err error
+				gotBody, err = io.ReadAll(req.Body)
+				if err != nil {
+					return nil, err
+				}
+
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+
+		err = callbackRepo.CreateCallback(ctx, callback.Callback{
+			ID:       callback.NewID(),
+			TokenID:  tk.ID,
+			CBType:   "INVOICE7",
+			URL:      templateURL,
+			Template: `{"id": {{json .order_id}}, "source": "notifi"}`,
+		})
+		require.NoError(t, err)
+
+		nf := notif.Notif{
+			ID:          notif.NewID(),
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      "INVOICE7",
+			Status:      notif.StatusPending,
+			Payload:     map[string]interface{}{"order_id": "1234"},
+		}
+		err = notifRepo.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		msgBodies := fanOut(t, notif.NotifMsg{
+			NotifID:     nf.ID,
+			DestTokenID: nf.DestTokenID,
+			CBType:      nf.CBType,
+			Payload:     nf.Payload,
+		})
+		require.Len(t, msgBodies, 1)
+
+		err = notifMsgProc.Process(ctx, msgBodies[0])
+		require.NoError(t, err)
+
+		// the payload is reshaped by the template
+		assert.JSONEq(t, `{"id":"1234","source":"notifi"}`, string(gotBody))
+	})
+
+	t.Run("Event version", func(t *testing.T) {
+		versionURL := baseURL + "/version"
+		var (
+			gotBody    []byte
+			gotVersion string
+		)
+		httpmock.RegisterResponder(http.MethodPost, versionURL,
+			func(req *http.Request) (*http.Response, error) {
+				var err error
+				gotBody, err = io.ReadAll(req.Body)
+				if err != nil {
+					return nil, err
+				}
+				gotVersion = req.Header.Get("X-EVENT-VERSION")
+
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+
+		// version 2 renames the amount to total
+		err = eventTypeRepo.CreateEventType(ctx, eventtype.EventType{
+			Name:    "INVOICE8",
+			TokenID: tk.ID,
+		})
+		require.NoError(t, err)
+
+		err = eventTypeRepo.CreateVersion(ctx, eventtype.Version{
+			EventType: "INVOICE8",
+			Version:   2,
+			Upcast:    []eventtype.Op{{Op: eventtype.OpRename, From: "amount", Path: "total"}},
+			Downcast:  []eventtype.Op{{Op: eventtype.OpRename, From: "total", Path: "amount"}},
+		})
+		require.NoError(t, err)
+
+		// the receiver is pinned to version 1
+		err = callbackRepo.CreateCallback(ctx, callback.Callback{
+			ID:           callback.NewID(),
+			TokenID:      tk.ID,
+			CBType:       "INVOICE8",
+			URL:          versionURL,
+			EventVersion: 1,
+		})
+		require.NoError(t, err)
+
+		nf := notif.Notif{
+			ID:           notif.NewID(),
+			SrcTokenID:   tk.ID,
+			DestTokenID:  tk.ID,
+			CBType:       "INVOICE8",
+			Status:       notif.StatusPending,
+			Payload:      map[string]interface{}{"total": 100},
+			EventVersion: 2,
+		}
+		err = notifRepo.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		msgBodies := fanOut(t, notif.NotifMsg{
+			NotifID:      nf.ID,
+			DestTokenID:  nf.DestTokenID,
+			CBType:       nf.CBType,
+			Payload:      nf.Payload,
+			EventVersion: nf.EventVersion,
+		})
+		require.Len(t, msgBodies, 1)
+
+		err = notifMsgProc.Process(ctx, msgBodies[0])
+		require.NoError(t, err)
+
+		// the payload is downcasted to the pinned version
+		assert.JSONEq(t, `{"amount":100}`, string(gotBody))
+		assert.Equal(t, "1", gotVersion)
 	})
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"strconv"
+	"time"
 
 	"github.com/mitchellh/hashstructure/v2"
 	"github.com/pkg/errors"
@@ -18,12 +19,68 @@ type Sender interface {
 	Send(context.Context, NotifMsg) error
 }
 
+// NotifMsg is the queue message of a notification. Messages without
+// delivery id are fanned out to a message per delivery by the worker.
 type NotifMsg struct {
-	NotifID     ID                     `json:"notif_id"`
-	DestTokenID token.ID               `json:"dest_token_id"`
-	CBType      callback.CBType        `json:"cb_type"`
-	Payload     map[string]interface{} `json:"payload"`
-	RetryCount  int                    `json:"retry_count" hash:"ignore"`
+	NotifID      ID                     `json:"notif_id"`
+	DestTokenID  token.ID               `json:"dest_token_id"`
+	CBType       callback.CBType        `json:"cb_type"`
+	Payload      map[string]interface{} `json:"payload"`
+	DeliveryID   DeliveryID             `json:"delivery_id,omitempty"`
+	CallbackID   callback.ID            `json:"callback_id,omitempty"`
+	RetryCount   int                    `json:"retry_count" hash:"ignore"`
+	CreatedAt    time.Time              `json:"created_at" hash:"ignore"`
+	ExpiresAt    *time.Time             `json:"expires_at,omitempty" hash:"ignore"`
+	EventVersion int                    `json:"event_version,omitempty" hash:"ignore"`
+	Deferrals    int                    `json:"deferrals,omitempty" hash:"ignore"`
+}
+
+// newNotifMsg returns the queue message of the notification
+func newNotifMsg(nf Notif) NotifMsg {
+	return NotifMsg{
+		NotifID:      nf.ID,
+		DestTokenID:  nf.DestTokenID,
+		CBType:       nf.CBType,
+		Payload:      nf.Payload,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    nf.ExpiresAt,
+		EventVersion: nf.EventVersion,
+	}
+}
+
+// deliveryMsg returns the message of the delivery
+func (msg NotifMsg) deliveryMsg(delivery Delivery) NotifMsg {
+	msg.DeliveryID = delivery.ID
+	msg.CallbackID = delivery.CallbackID
+	msg.RetryCount = 0
+	msg.Deferrals = 0
+	return msg
+}
+
+// UpdateMsgStatus updates the status of the delivery of the message,
+// or the notification status if the message is not fanned out yet
+func UpdateMsgStatus(ctx context.Context, notifRepo Repository,
+	msg NotifMsg, status Status) error {
+	if msg.DeliveryID != NilDeliveryID {
+		err := notifRepo.UpdateDeliveryStatus(ctx, msg.DeliveryID, status)
+		if err != nil {
+			return errors.Wrap(err, "update delivery status")
+		}
+
+		return nil
+	}
+
+	err := notifRepo.UpdateStatus(ctx, msg.NotifID, status)
+	if err != nil {
+		return errors.Wrap(err, "update notif status")
+	}
+
+	return nil
+}
+
+// Expired reports whether the message is expired at the given time
+func (msg NotifMsg) Expired(now time.Time) bool {
+	return msg.ExpiresAt != nil && !now.Before(*msg.ExpiresAt)
 }
 
 func (msg NotifMsg) IdempKey() (string, error) {
@@ -43,6 +100,12 @@ const (
 	defaultExchange   = "notifs_exchange"
 	defaultQueue      = "notifs_queue"
 	defaultRoutingKey = "notifs_queue.default"
+
+	// DeadLetterQueue is the queue of the messages that couldn't be delivered
+	DeadLetterQueue      = "notifs_queue.dead"
+	deadLetterRoutingKey = "notifs_queue.dead"
+	// DeadLetterReasonHeader is the message header containing the dead letter reason
+	DeadLetterReasonHeader = "x-dead-letter-reason"
 )
 
 var _ Sender = (*NotifSender)(nil)
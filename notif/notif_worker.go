@@ -5,17 +5,35 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/streadway/amqp"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+const (
+	// DefaultConcurrency is the default max number of concurrent deliveries
+	DefaultConcurrency = 100
+	// DefaultDestConcurrency is the default max number
+	// of concurrent deliveries per destination
+	DefaultDestConcurrency = 10
+
+	// destBusyDelay is the delay of the messages whose destination is busy
+	destBusyDelay = time.Second
 )
 
 type NotifWorker struct {
 	ch           *amqp.Channel
 	doneChan     chan bool
 	msgProcessor *NotifMsgProcessor
+	retryPolicy  RetryPolicy
+	concurrency  int
+	destLimiter  *destLimiter
 	logger       zerolog.Logger
 }
 
@@ -63,15 +81,70 @@ func NewNotifWorker(
 		return nil, errors.Wrap(err, "queue bind")
 	}
 
+	// declare dead letter queue
+	_, err = ch.QueueDeclare(
+		DeadLetterQueue, // name,
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive,
+		false,           // no-wait
+		nil,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "declare dead letter queue")
+	}
+
+	// bind dead letter queue to default exchange
+	err = ch.QueueBind(
+		DeadLetterQueue,
+		deadLetterRoutingKey,
+		defaultExchange,
+		false,
+		nil,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "dead letter queue bind")
+	}
+
 	return &NotifWorker{
 		ch:           ch,
 		msgProcessor: msgProcessor,
 		doneChan:     make(chan bool),
+		retryPolicy:  NewBackoffRetryPolicy(DefaultRetryConfig),
+		concurrency:  DefaultConcurrency,
+		destLimiter:  newDestLimiter(DefaultDestConcurrency),
 		logger:       logger,
 	}, nil
 }
 
+// WithConcurrency overrides the max number of concurrent deliveries and
+// the max number of concurrent deliveries per destination. A destination
+// concurrency of 0 means the destinations are not limited.
+func (worker *NotifWorker) WithConcurrency(concurrency, destConcurrency int) *NotifWorker {
+	worker.concurrency = concurrency
+	worker.destLimiter = newDestLimiter(destConcurrency)
+	return worker
+}
+
+// WithRetryPolicy overrides the retry policy used for
+// callbacks that don't have their own retry config
+func (worker *NotifWorker) WithRetryPolicy(retryPolicy RetryPolicy) *NotifWorker {
+	worker.retryPolicy = retryPolicy
+	return worker
+}
+
 func (worker *NotifWorker) Start(ctx context.Context) error {
+	if worker.concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+
+	// Limit the unacknowledged messages so that the
+	// broker doesn't push more than what we can handle
+	err := worker.ch.Qos(worker.concurrency, 0, false)
+	if err != nil {
+		return errors.Wrap(err, "set qos")
+	}
+
 	msgs, err := worker.ch.Consume(
 		defaultQueue, // queue
 		"",           // consumer
@@ -85,31 +158,21 @@ func (worker *NotifWorker) Start(ctx context.Context) error {
 		return errors.Wrap(err, "consume messages")
 	}
 
-	// TODO: add semaphore
+	sem := make(chan struct{}, worker.concurrency)
 
 	var wg sync.WaitGroup
 	for {
 		select {
 		case msg := <-msgs:
+			sem <- struct{}{}
 			wg.Add(1)
 			go func() {
-				defer wg.Done()
-				// Process new messages
-				err = worker.msgProcessor.Process(ctx, msg.Body)
-				if err != nil {
-					worker.logger.Error().Err(err).Msg("process message")
-					// Retry
-					err = worker.retryMsg(ctx, msg)
-					if err != nil {
-						worker.logger.Error().Err(err).Msg("retrying message")
-					}
-				}
-
-				// Send ack whether success or not
-				err = msg.Ack(false)
-				if err != nil {
-					worker.logger.Error().Err(err).Msg("ack")
-				}
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				worker.handleMsg(ctx, msg)
 			}()
 
 		case <-worker.doneChan:
@@ -121,19 +184,196 @@ func (worker *NotifWorker) Start(ctx context.Context) error {
 	}
 }
 
+func (worker *NotifWorker) handleMsg(ctx context.Context, msg amqp.Delivery) {
+	var notifMsg NotifMsg
+	err := json.Unmarshal(msg.Body, &notifMsg)
+	if err == nil && notifMsg.DeliveryID == NilDeliveryID {
+		worker.fanOut(ctx, msg, notifMsg)
+		return
+	}
+
+	// Limit the concurrent deliveries per destination
+	// so that a slow receiver can't take all the slots
+	if err == nil {
+		key := destKey{callbackID: notifMsg.CallbackID}
+		if !worker.destLimiter.acquire(key) {
+			// Try again later, this doesn't count as a retry
+			err = worker.publishDelayed(notifMsg, destBusyDelay, 0)
+			if err != nil {
+				worker.logger.Error().Err(err).Msg("delay message")
+				worker.nack(msg)
+				return
+			}
+
+			worker.ack(msg)
+			return
+		}
+		defer worker.destLimiter.release(key)
+	}
+
+	// Process new messages
+	err = worker.msgProcessor.Process(ctx, msg.Body)
+	if err != nil {
+		var deferErr *DeferError
+		if errors.As(err, &deferErr) {
+			worker.logger.Debug().Err(err).Msg("defer message")
+		} else {
+			worker.logger.Error().Err(err).Msg("process message")
+		}
+		worker.retry(ctx, msg, err)
+		return
+	}
+
+	worker.ack(msg)
+}
+
+// fanOut publishes a message for each delivery of the notification
+func (worker *NotifWorker) fanOut(ctx context.Context, msg amqp.Delivery, notifMsg NotifMsg) {
+	deliveryMsgs, err := worker.msgProcessor.FanOut(ctx, notifMsg)
+	if err == nil {
+		for _, deliveryMsg := range deliveryMsgs {
+			err = worker.publish(deliveryMsg, defaultRoutingKey)
+			if err != nil {
+				// Retrying the fan out is safe since the
+				// deliveries that are done are skipped
+				err = errors.Wrap(err, "publish delivery message")
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		worker.logger.Error().Err(err).Msg("fan out message")
+		worker.retry(ctx, msg, err)
+		return
+	}
+
+	worker.ack(msg)
+}
+
+// retry schedules the retry of the message and acknowledges it
+func (worker *NotifWorker) retry(ctx context.Context, msg amqp.Delivery, procErr error) {
+	err := worker.retryMsg(ctx, msg, procErr)
+	if err != nil {
+		worker.logger.Error().Err(err).Msg("retrying message")
+
+		// Couldn't retry, move it to the dead letter queue
+		// so that the message doesn't get lost
+		err = worker.deadLetter(msg.Body, err.Error())
+		if err != nil {
+			worker.logger.Error().Err(err).Msg("dead letter message")
+
+			// Put the message back to the queue as the last resort
+			worker.nack(msg)
+			return
+		}
+	}
+
+	worker.ack(msg)
+}
+
+func (worker *NotifWorker) ack(msg amqp.Delivery) {
+	err := msg.Ack(false)
+	if err != nil {
+		worker.logger.Error().Err(err).Msg("ack")
+	}
+}
+
+// nack puts the message back to the queue
+func (worker *NotifWorker) nack(msg amqp.Delivery) {
+	err := msg.Nack(false, true)
+	if err != nil {
+		worker.logger.Error().Err(err).Msg("nack")
+	}
+}
+
 func (worker *NotifWorker) Stop() {
 	worker.doneChan <- true
 }
 
-func (worker *NotifWorker) retryMsg(ctx context.Context, msg amqp.Delivery) error {
+// retryableError is implemented by errors that know whether the delivery can be retried
+type retryableError interface {
+	Retryable() bool
+}
+
+// retryAfterError is implemented by errors that carry the delay requested by the receiver
+type retryAfterError interface {
+	RetryAfter() time.Duration
+}
+
+func (worker *NotifWorker) retryMsg(ctx context.Context, msg amqp.Delivery, procErr error) error {
 	var notifMsg NotifMsg
 	err := json.NewDecoder(bytes.NewBuffer(msg.Body)).Decode(&notifMsg)
 	if err != nil {
 		return errors.Wrap(err, "json decode message")
 	}
 
-	// compute delay based on retry count
-	delay := secondsToDelay(notifMsg.RetryCount)
+	// Deferred messages are not counted as retries
+	var deferErr *DeferError
+	if errors.As(procErr, &deferErr) {
+		if notifMsg.Expired(time.Now().Add(deferErr.Delay)) {
+			return worker.expire(ctx, notifMsg)
+		}
+
+		notifMsg.Deferrals += 1
+
+		return worker.publishDelayed(notifMsg, deferErr.Delay, 0)
+	}
+
+	// Permanent failures are not retried
+	var retryableErr retryableError
+	if errors.As(procErr, &retryableErr) && !retryableErr.Retryable() {
+		return worker.giveUp(ctx, msg, notifMsg, procErr.Error())
+	}
+
+	// compute delay based on retry policy
+	var age time.Duration
+	if !notifMsg.CreatedAt.IsZero() {
+		age = time.Since(notifMsg.CreatedAt)
+	}
+
+	retryPolicy := worker.getRetryPolicy(ctx, notifMsg)
+	retryDelay, ok := retryPolicy.NextDelay(notifMsg.RetryCount, age)
+	if !ok {
+		// Retry policy exhausted
+		return worker.giveUp(ctx, msg, notifMsg,
+			"retry policy exhausted: "+procErr.Error())
+	}
+
+	// The retry queue doesn't exceed the max delay of the policy
+	var maxDelay time.Duration
+	if p, ok := retryPolicy.(maxDelayPolicy); ok {
+		maxDelay = p.MaxDelay()
+	}
+
+	// Don't retry earlier than what the receiver asked for
+	var retryAfterErr retryAfterError
+	if errors.As(procErr, &retryAfterErr) && retryAfterErr.RetryAfter() > retryDelay {
+		retryDelay, maxDelay = retryAfterErr.RetryAfter(), 0
+	}
+
+	// Don't retry if the notification would expire by then
+	if notifMsg.Expired(time.Now().Add(retryDelay)) {
+		return worker.expire(ctx, notifMsg)
+	}
+
+	// Increase retry count
+	notifMsg.RetryCount += 1
+
+	return worker.publishDelayed(notifMsg, retryDelay, maxDelay)
+}
+
+// maxDelayPolicy is a retry policy with a max delay
+type maxDelayPolicy interface {
+	MaxDelay() time.Duration
+}
+
+// publishDelayed publishes the message to the retry queue of the
+// delay, the retry queue doesn't exceed the max delay if it's set
+func (worker *NotifWorker) publishDelayed(notifMsg NotifMsg,
+	retryDelay, maxDelay time.Duration) error {
+	delay := retryBucket(retryDelay, maxDelay)
+
 	// format retry queue name
 	routingKey := fmt.Sprintf("%s.%d", defaultQueue, delay)
 
@@ -154,11 +394,13 @@ func (worker *NotifWorker) retryMsg(ctx context.Context, msg amqp.Delivery) erro
 		return errors.Wrap(err, "bind retry queue to exchange")
 	}
 
-	// Increase retry count
-	notifMsg.RetryCount += 1
+	return worker.publish(notifMsg, routingKey)
+}
 
+// publish publishes the message to the routing key
+func (worker *NotifWorker) publish(notifMsg NotifMsg, routingKey string) error {
 	buf := &bytes.Buffer{}
-	err = json.NewEncoder(buf).Encode(notifMsg)
+	err := json.NewEncoder(buf).Encode(notifMsg)
 	if err != nil {
 		return errors.Wrap(err, "json encode message")
 	}
@@ -181,6 +423,59 @@ func (worker *NotifWorker) retryMsg(ctx context.Context, msg amqp.Delivery) erro
 	return nil
 }
 
+// retryBuckets are the delays in seconds of the retry queues. Delays are
+// rounded up to a bucket so that jittered delays share a few queues.
+var retryBuckets = []int{1, 2, 5, 10, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+// retryBucket returns the delay in seconds of the smallest retry queue that
+// isn't shorter than the delay. If that exceeds the max delay, it returns
+// the largest retry queue that doesn't exceed the max delay instead.
+func retryBucket(retryDelay, maxDelay time.Duration) int {
+	bucket := ceilBucket(int(math.Ceil(retryDelay.Seconds())))
+	if maxDelay <= 0 {
+		return bucket
+	}
+
+	maxBucket := floorBucket(int(maxDelay.Seconds()))
+	if bucket > maxBucket {
+		return maxBucket
+	}
+
+	return bucket
+}
+
+// ceilBucket rounds up the delay in seconds to a bucket
+func ceilBucket(delay int) int {
+	for _, bucket := range retryBuckets {
+		if delay <= bucket {
+			return bucket
+		}
+	}
+
+	// Longer delays are rounded up to the largest bucket
+	largest := retryBuckets[len(retryBuckets)-1]
+	return (delay + largest - 1) / largest * largest
+}
+
+// floorBucket rounds down the delay in seconds to a bucket,
+// the delays shorter than the first bucket use the first bucket
+func floorBucket(delay int) int {
+	largest := retryBuckets[len(retryBuckets)-1]
+	if delay >= largest {
+		return delay / largest * largest
+	}
+
+	floor := retryBuckets[0]
+	for _, bucket := range retryBuckets {
+		if bucket > delay {
+			break
+		}
+		floor = bucket
+	}
+
+	return floor
+}
+
 func (worker *NotifWorker) createRetryQueue(delay int) (string, error) {
 	queueName := fmt.Sprintf("%s.retry.%d", defaultQueue, delay)
 
@@ -205,7 +500,73 @@ func (worker *NotifWorker) createRetryQueue(delay int) (string, error) {
 	return q.Name, nil
 }
 
-func secondsToDelay(count int) int {
-	base := count + 1
-	return base * base
+// giveUp marks the notification as dead and moves it to the dead letter queue
+func (worker *NotifWorker) giveUp(ctx context.Context, msg amqp.Delivery,
+	notifMsg NotifMsg, reason string) error {
+	err := worker.deadLetter(msg.Body, reason)
+	if err != nil {
+		return errors.Wrap(err, "dead letter message")
+	}
+
+	err = worker.msgProcessor.UpdateStatus(ctx, notifMsg, StatusDead)
+	if err != nil {
+		// Not returning the error since the message is already dead lettered
+		worker.logger.Error().Err(err).Msg("update notif status")
+	}
+
+	return nil
+}
+
+// expire marks the notification as expired, the message is dropped
+func (worker *NotifWorker) expire(ctx context.Context, notifMsg NotifMsg) error {
+	err := worker.msgProcessor.UpdateStatus(ctx, notifMsg, StatusExpired)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deadLetter publishes the message body to the dead letter queue
+func (worker *NotifWorker) deadLetter(msgBody []byte, reason string) error {
+	err := worker.ch.Publish(
+		defaultExchange,      // exchange
+		deadLetterRoutingKey, // routing key
+		false,                // mandatory
+		false,                // immediate
+		amqp.Publishing{
+			Headers:      amqp.Table{DeadLetterReasonHeader: reason},
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Body:         msgBody,
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "publish message")
+	}
+
+	return nil
+}
+
+// getRetryPolicy returns the retry policy of the callback of the delivery
+func (worker *NotifWorker) getRetryPolicy(ctx context.Context, notifMsg NotifMsg) RetryPolicy {
+	// Fan out messages don't have a callback yet
+	if notifMsg.CallbackID == callback.NilID {
+		return worker.retryPolicy
+	}
+
+	retryConfig, err := worker.msgProcessor.RetryConfig(ctx, notifMsg.CallbackID)
+	if err != nil {
+		if err != callback.ErrCallbackNotFound {
+			worker.logger.Error().Err(err).Msg("get retry config")
+		}
+
+		return worker.retryPolicy
+	}
+
+	if retryConfig == nil {
+		return worker.retryPolicy
+	}
+
+	return NewBackoffRetryPolicy(*retryConfig)
 }
@@ -0,0 +1,49 @@
+package notif
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBucket(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  int
+	}{
+		{0, 1},
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{3 * time.Second, 5},
+		{11 * time.Second, 15},
+		{45 * time.Second, 60},
+		{time.Hour, 3600},
+		{90 * time.Minute, 7200},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, retryBucket(tc.delay, 0), tc.delay.String())
+	}
+
+	// the buckets don't exceed the max delay
+	maxTests := []struct {
+		delay    time.Duration
+		maxDelay time.Duration
+		want     int
+	}{
+		{601 * time.Second, 1200 * time.Second, 600},
+		{601 * time.Second, time.Hour, 1800},
+		{3601 * time.Second, time.Hour, 3600},
+		{3601 * time.Second, 90 * time.Minute, 3600},
+		{5 * time.Hour, 5 * time.Hour, 18000},
+		{500 * time.Millisecond, 500 * time.Millisecond, 1},
+		{45 * time.Second, 50 * time.Second, 30},
+	}
+
+	for _, tc := range maxTests {
+		assert.Equal(t, tc.want, retryBucket(tc.delay, tc.maxDelay),
+			tc.delay.String()+" max "+tc.maxDelay.String())
+	}
+}
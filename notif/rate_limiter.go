@@ -0,0 +1,84 @@
+package notif
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+// tokenBucket is a token bucket rate limiter
+type tokenBucket struct {
+	limit  callback.RateLimit
+	tokens float64
+	last   time.Time
+	// deferred is the number of requests that were told to come back later
+	deferred int
+}
+
+// take takes a token from the bucket. If the bucket is empty, it returns
+// the wait time until the request is allowed. The wait time includes the
+// requests that were deferred earlier so that they don't all come back
+// at the same time.
+func (tb *tokenBucket) take(now time.Time) time.Duration {
+	// refill the bucket
+	elapsed := now.Sub(tb.last).Seconds()
+	if elapsed > 0 {
+		tb.tokens += elapsed * tb.limit.PerSecond
+		if burst := float64(tb.limit.Burst); tb.tokens >= burst {
+			tb.tokens = burst
+			// the deferred requests didn't come back
+			tb.deferred = 0
+		}
+		tb.last = now
+	}
+
+	if tb.tokens >= 1 {
+		tb.tokens--
+		if tb.deferred > 0 {
+			tb.deferred--
+		}
+		return 0
+	}
+
+	missing := 1 - tb.tokens + float64(tb.deferred)
+	tb.deferred++
+	return time.Duration(missing / tb.limit.PerSecond * float64(time.Second))
+}
+
+// rateLimiter enforces the rate limits of the callbacks. The token
+// buckets are kept in memory, so each worker process enforces the
+// rate limits on its own.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[callback.ID]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[callback.ID]*tokenBucket)}
+}
+
+// reserve takes a token from the bucket of the callback. If the rate limit
+// is reached, it returns the wait time until the request is allowed.
+func (rl *rateLimiter) reserve(cbID callback.ID, limit *callback.RateLimit, now time.Time) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if limit == nil {
+		delete(rl.buckets, cbID)
+		return 0
+	}
+
+	bucket, ok := rl.buckets[cbID]
+	if !ok || bucket.limit != *limit {
+		// start with a full bucket whenever the limit changes
+		bucket = &tokenBucket{
+			limit:  *limit,
+			tokens: float64(limit.Burst),
+			last:   now,
+		}
+		rl.buckets[cbID] = bucket
+	}
+
+	return bucket.take(now)
+}
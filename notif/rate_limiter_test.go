@@ -0,0 +1,55 @@
+package notif
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter()
+
+	cbID := callback.ID("cb1")
+	limit := &callback.RateLimit{PerSecond: 2, Burst: 3}
+	now := time.Now()
+
+	// burst is allowed
+	for i := 0; i < limit.Burst; i++ {
+		assert.Zero(t, rl.reserve(cbID, limit, now))
+	}
+
+	// over the limit
+	assert.Equal(t, 500*time.Millisecond, rl.reserve(cbID, limit, now))
+
+	// bucket is refilled over time
+	now = now.Add(500 * time.Millisecond)
+	assert.Zero(t, rl.reserve(cbID, limit, now))
+	assert.Equal(t, 500*time.Millisecond, rl.reserve(cbID, limit, now))
+
+	// deferred requests are spread over time
+	assert.Equal(t, time.Second, rl.reserve(cbID, limit, now))
+	assert.Equal(t, 1500*time.Millisecond, rl.reserve(cbID, limit, now))
+
+	// deferred requests are forgotten once the bucket is full
+	now = now.Add(10 * time.Second)
+	for i := 0; i < limit.Burst; i++ {
+		assert.Zero(t, rl.reserve(cbID, limit, now))
+	}
+	assert.Equal(t, 500*time.Millisecond, rl.reserve(cbID, limit, now))
+
+	// other callbacks are not affected
+	assert.Zero(t, rl.reserve("cb2", limit, now))
+
+	// no limit
+	for i := 0; i < 10; i++ {
+		assert.Zero(t, rl.reserve(cbID, nil, now))
+	}
+
+	// changing the limit resets the bucket
+	limit = &callback.RateLimit{PerSecond: 1, Burst: 1}
+	assert.Zero(t, rl.reserve(cbID, limit, now))
+	assert.Equal(t, time.Second, rl.reserve(cbID, limit, now))
+}
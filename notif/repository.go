@@ -1,9 +1,39 @@
 package notif
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/stevenferrer/notifi/callback"
+)
 
 type Repository interface {
 	CreateNotif(context.Context, Notif) error
 	GetNotif(context.Context, ID) (*Notif, error)
+	// CreateEvent creates the event and the notifications of the subscribers
+	CreateEvent(context.Context, Event, []Notif) error
+	GetEvent(context.Context, EventID) (*Event, error)
+	ListNotifsByEventID(context.Context, EventID) ([]Notif, error)
 	UpdateStatus(context.Context, ID, Status) error
+	// HasPendingPredecessor reports whether an earlier notification with
+	// the same ordering key is not done processing for the callback
+	HasPendingPredecessor(context.Context, Notif, callback.ID) (bool, error)
+	// CreateDeliveries creates the missing deliveries of the notification,
+	// updates the aggregate status and returns the stored deliveries
+	CreateDeliveries(context.Context, ID, []Delivery) ([]Delivery, error)
+	ListDeliveries(context.Context, ID) ([]Delivery, error)
+	GetDelivery(context.Context, DeliveryID) (*Delivery, error)
+	// UpdateDeliveryStatus updates the delivery status
+	// and the aggregate status of the notification
+	UpdateDeliveryStatus(context.Context, DeliveryID, Status) error
+	// CancelScheduled cancels the notification if it's still scheduled
+	CancelScheduled(context.Context, ID) error
+	// DispatchScheduled marks the scheduled notifications that are due as
+	// pending and passes them to the dispatch func, the ones that failed to
+	// dispatch are scheduled again. It returns the number of dispatched
+	// notifications.
+	DispatchScheduled(ctx context.Context, now time.Time, limit int,
+		dispatch func(Notif) error) (int, error)
+	CreateAttempt(context.Context, Attempt) error
+	ListAttempts(context.Context, ID) ([]Attempt, error)
 }
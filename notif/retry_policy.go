@@ -0,0 +1,84 @@
+package notif
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/stevenferrer/notifi/callback"
+)
+
+// RetryPolicy decides when a failed notification is retried
+type RetryPolicy interface {
+	// NextDelay returns the delay before retrying a notification that has been
+	// retried retryCount times and was created age ago. It returns false
+	// when the policy is exhausted and the notification should not be retried.
+	NextDelay(retryCount int, age time.Duration) (time.Duration, bool)
+}
+
+// DefaultRetryConfig is the retry config used when the callback doesn't set one
+var DefaultRetryConfig = callback.RetryConfig{
+	MaxAttempts: 25,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Hour,
+	Backoff:     callback.BackoffQuadratic,
+}
+
+// BackoffRetryPolicy computes the retry delays from a retry config
+type BackoffRetryPolicy struct {
+	cfg    callback.RetryConfig
+	random func() float64
+}
+
+var _ RetryPolicy = (*BackoffRetryPolicy)(nil)
+
+// NewBackoffRetryPolicy returns a new BackoffRetryPolicy
+func NewBackoffRetryPolicy(cfg callback.RetryConfig) *BackoffRetryPolicy {
+	return &BackoffRetryPolicy{cfg: cfg, random: rand.Float64}
+}
+
+// MaxDelay returns the max retry delay, 0 if unlimited
+func (p *BackoffRetryPolicy) MaxDelay() time.Duration {
+	return p.cfg.MaxDelay
+}
+
+// NextDelay implements RetryPolicy
+func (p *BackoffRetryPolicy) NextDelay(retryCount int, age time.Duration) (time.Duration, bool) {
+	// retryCount+1 attempts have been made so far
+	if p.cfg.MaxAttempts > 0 && retryCount+1 >= p.cfg.MaxAttempts {
+		return 0, false
+	}
+
+	n := float64(retryCount)
+	var factor float64
+	switch p.cfg.Backoff {
+	case callback.BackoffConstant:
+		factor = 1
+	case callback.BackoffLinear:
+		factor = n + 1
+	case callback.BackoffExponential:
+		factor = math.Pow(2, n)
+	default:
+		factor = (n + 1) * (n + 1)
+	}
+
+	delay := float64(p.cfg.BaseDelay) * factor
+	if p.cfg.MaxDelay > 0 {
+		delay = math.Min(delay, float64(p.cfg.MaxDelay))
+	}
+
+	// spread the delay by +/- jitter
+	if p.cfg.Jitter > 0 {
+		delay += delay * p.cfg.Jitter * (2*p.random() - 1)
+	}
+
+	// avoid overflowing time.Duration
+	delay = math.Min(delay, math.MaxInt64)
+	nextDelay := time.Duration(delay)
+
+	if p.cfg.MaxAge > 0 && age+nextDelay > p.cfg.MaxAge {
+		return 0, false
+	}
+
+	return nextDelay, true
+}
@@ -0,0 +1,113 @@
+package notif_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/notif"
+)
+
+func TestBackoffRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff callback.Backoff
+		delays  []time.Duration
+	}{
+		{
+			name:    "constant",
+			backoff: callback.BackoffConstant,
+			delays:  []time.Duration{2, 2, 2, 2},
+		},
+		{
+			name:    "linear",
+			backoff: callback.BackoffLinear,
+			delays:  []time.Duration{2, 4, 6, 8},
+		},
+		{
+			name:    "quadratic",
+			backoff: callback.BackoffQuadratic,
+			delays:  []time.Duration{2, 8, 18, 20},
+		},
+		{
+			name:    "exponential",
+			backoff: callback.BackoffExponential,
+			delays:  []time.Duration{2, 4, 8, 16},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := notif.NewBackoffRetryPolicy(callback.RetryConfig{
+				BaseDelay: 2 * time.Second,
+				MaxDelay:  20 * time.Second,
+				Backoff:   tc.backoff,
+			})
+
+			for retryCount, want := range tc.delays {
+				delay, ok := policy.NextDelay(retryCount, 0)
+				assert.True(t, ok)
+				assert.Equal(t, want*time.Second, delay)
+			}
+		})
+	}
+
+	t.Run("max attempts", func(t *testing.T) {
+		policy := notif.NewBackoffRetryPolicy(callback.RetryConfig{
+			MaxAttempts: 3,
+			BaseDelay:   time.Second,
+			Backoff:     callback.BackoffConstant,
+		})
+
+		_, ok := policy.NextDelay(0, 0)
+		assert.True(t, ok)
+		_, ok = policy.NextDelay(1, 0)
+		assert.True(t, ok)
+
+		// third attempt has failed
+		_, ok = policy.NextDelay(2, 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		policy := notif.NewBackoffRetryPolicy(callback.RetryConfig{
+			MaxAge:    time.Minute,
+			BaseDelay: 10 * time.Second,
+			Backoff:   callback.BackoffConstant,
+		})
+
+		_, ok := policy.NextDelay(0, 30*time.Second)
+		assert.True(t, ok)
+
+		// next attempt would be past the max age
+		_, ok = policy.NextDelay(0, 55*time.Second)
+		assert.False(t, ok)
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		policy := notif.NewBackoffRetryPolicy(callback.RetryConfig{
+			BaseDelay: 10 * time.Second,
+			Jitter:    0.5,
+			Backoff:   callback.BackoffConstant,
+		})
+
+		for i := 0; i < 100; i++ {
+			delay, ok := policy.NextDelay(0, 0)
+			assert.True(t, ok)
+			assert.GreaterOrEqual(t, delay, 5*time.Second)
+			assert.LessOrEqual(t, delay, 15*time.Second)
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		assert.NoError(t, notif.DefaultRetryConfig.Validate())
+
+		// same as the previous (n+1)^2 seconds
+		policy := notif.NewBackoffRetryPolicy(notif.DefaultRetryConfig)
+		delay, ok := policy.NextDelay(2, 0)
+		assert.True(t, ok)
+		assert.Equal(t, 9*time.Second, delay)
+	})
+}
@@ -0,0 +1,84 @@
+package notif
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultSchedulerInterval is the default polling interval of the scheduler
+	DefaultSchedulerInterval = time.Second
+	// schedulerBatchSize is the max number of notifications dispatched per batch
+	schedulerBatchSize = 100
+)
+
+// Scheduler sends the scheduled notifications to the queue once they're due.
+// The schedule is kept in the repository so that it survives restarts.
+type Scheduler struct {
+	notifRepo Repository
+	sender    Sender
+	interval  time.Duration
+	doneChan  chan bool
+	logger    zerolog.Logger
+}
+
+func NewScheduler(notifRepo Repository, sender Sender, logger zerolog.Logger) *Scheduler {
+	return &Scheduler{
+		notifRepo: notifRepo,
+		sender:    sender,
+		interval:  DefaultSchedulerInterval,
+		doneChan:  make(chan bool),
+		logger:    logger,
+	}
+}
+
+// WithInterval overrides the default polling interval
+func (s *Scheduler) WithInterval(interval time.Duration) *Scheduler {
+	s.interval = interval
+	return s
+}
+
+func (s *Scheduler) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := s.DispatchDue(ctx, time.Now())
+			if err != nil {
+				s.logger.Error().Err(err).Msg("dispatch due notifications")
+			}
+
+		case <-s.doneChan:
+			close(s.doneChan)
+			return nil
+		}
+	}
+}
+
+func (s *Scheduler) Stop() {
+	s.doneChan <- true
+}
+
+// DispatchDue sends the notifications that are due at the given time
+// and returns the number of notifications sent
+func (s *Scheduler) DispatchDue(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for {
+		dispatched, err := s.notifRepo.DispatchScheduled(ctx, now,
+			schedulerBatchSize, func(nf Notif) error {
+				return s.sender.Send(ctx, newNotifMsg(nf))
+			})
+		total += dispatched
+		if err != nil {
+			return total, err
+		}
+
+		if dispatched < schedulerBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package notif_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/eventtype"
+	"github.com/stevenferrer/notifi/notif"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/token"
+)
+
+// recordingSender records the sent messages, it fails if err is set
+type recordingSender struct {
+	msgs []notif.NotifMsg
+	err  error
+}
+
+func (sender *recordingSender) Send(ctx context.Context, msg notif.NotifMsg) error {
+	if sender.err != nil {
+		return sender.err
+	}
+
+	sender.msgs = append(sender.msgs, msg)
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	tokenRepo := postgres.NewTokenRepository(db)
+	tokenSvc := token.NewTokenService(tokenRepo)
+
+	sender := &recordingSender{}
+	callbackRepo := postgres.NewCallbackRepository(db)
+	notifRepo := postgres.NewNotifRepository(db)
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
+	notifSvc := notif.NewNotifService(notifRepo, callbackRepo,
+		tokenRepo, eventTypeRepo, sender)
+	scheduler := notif.NewScheduler(notifRepo, sender, zerolog.New(os.Stderr))
+
+	ctx := context.TODO()
+
+	// create a token
+	tk, err := tokenSvc.CreateToken(ctx)
+	require.NoError(t, err)
+
+	err = eventTypeRepo.CreateEventType(ctx, eventtype.EventType{
+		Name:    "INVOICE",
+		TokenID: tk.ID,
+	})
+	require.NoError(t, err)
+
+	// schedule notifications
+	now := time.Now()
+	notifIDs := []notif.ID{}
+	for _, delay := range []time.Duration{time.Minute, 2 * time.Minute, time.Hour} {
+		deliverAt := now.Add(delay)
+		notifID, err := notifSvc.CreateNotif(ctx, notif.Notif{
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      "INVOICE",
+			Payload:     map[string]interface{}{"id": "1234"},
+			DeliverAt:   &deliverAt,
+		})
+		require.NoError(t, err)
+		notifIDs = append(notifIDs, notifID)
+	}
+
+	// cancelled notifications are not sent
+	err = notifSvc.CancelNotif(ctx, notifIDs[1])
+	require.NoError(t, err)
+
+	// nothing is due yet
+	dispatched, err := scheduler.DispatchDue(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, dispatched)
+	assert.Len(t, sender.msgs, 0)
+
+	dispatched, err = scheduler.DispatchDue(ctx, now.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, dispatched)
+	require.Len(t, sender.msgs, 1)
+	assert.Equal(t, notifIDs[0], sender.msgs[0].NotifID)
+
+	gotNf, err := notifSvc.GetNotif(ctx, notifIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, notif.StatusPending, gotNf.Status)
+
+	// dispatched notifications can't be cancelled
+	err = notifSvc.CancelNotif(ctx, notifIDs[0])
+	assert.ErrorIs(t, err, notif.ErrNotifNotScheduled)
+
+	// dispatched notifications are not sent twice
+	dispatched, err = scheduler.DispatchDue(ctx, now.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, dispatched)
+
+	gotNf, err = notifSvc.GetNotif(ctx, notifIDs[2])
+	require.NoError(t, err)
+	assert.Equal(t, notif.StatusScheduled, gotNf.Status)
+
+	// failed dispatches are scheduled again
+	sender.err = errors.New("queue is down")
+	dispatched, err = scheduler.DispatchDue(ctx, now.Add(2*time.Hour))
+	require.Error(t, err)
+	assert.Zero(t, dispatched)
+
+	gotNf, err = notifSvc.GetNotif(ctx, notifIDs[2])
+	require.NoError(t, err)
+	assert.Equal(t, notif.StatusScheduled, gotNf.Status)
+
+	sender.err = nil
+	dispatched, err = scheduler.DispatchDue(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, dispatched)
+	require.Len(t, sender.msgs, 2)
+	assert.Equal(t, notifIDs[2], sender.msgs[1].NotifID)
+}
@@ -2,57 +2,242 @@ package notif
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/eventtype"
+	"github.com/stevenferrer/notifi/token"
 )
 
 type Service interface {
 	CreateNotif(context.Context, Notif) (ID, error)
+	// PublishEvent broadcasts the notification to all the subscribers of the
+	// callback type that the sender can reach. It creates the event and a
+	// notification per subscriber, the destination of the notification is ignored.
+	PublishEvent(context.Context, Notif) (EventID, []ID, error)
+	// GetEvent returns the event and the notifications of the subscribers
+	GetEvent(context.Context, EventID) (*Event, []Notif, error)
 	GetNotif(context.Context, ID) (*Notif, error)
 	UpdateStatus(context.Context, ID, Status) error
 	ResendNotif(context.Context, ID) error
+	// CancelNotif cancels the scheduled notification
+	CancelNotif(context.Context, ID) error
+	ListAttempts(context.Context, ID) ([]Attempt, error)
+	// ListDeliveries lists the deliveries of the notification
+	ListDeliveries(context.Context, ID) ([]Delivery, error)
 }
 
 type NotifService struct {
-	notifRepo Repository
-	sender    Sender
+	notifRepo     Repository
+	callbackRepo  callback.Repository
+	tokenRepo     token.Repository
+	eventTypeRepo eventtype.Repository
+	sender        Sender
 }
 
 var _ Service = (*NotifService)(nil)
 
-func NewNotifService(notifRepo Repository, sender Sender) *NotifService {
-	return &NotifService{notifRepo: notifRepo, sender: sender}
+func NewNotifService(notifRepo Repository, callbackRepo callback.Repository,
+	tokenRepo token.Repository, eventTypeRepo eventtype.Repository,
+	sender Sender) *NotifService {
+	return &NotifService{
+		notifRepo:     notifRepo,
+		callbackRepo:  callbackRepo,
+		tokenRepo:     tokenRepo,
+		eventTypeRepo: eventTypeRepo,
+		sender:        sender,
+	}
 }
 
 func (ns *NotifService) CreateNotif(ctx context.Context, nf Notif) (ID, error) {
 	// TODO: Validate that both src and dest token id exists??
 
-	// Create notification record
-	notifID := NewID()
-	err := ns.notifRepo.CreateNotif(ctx, Notif{
-		ID:          notifID,
-		SrcTokenID:  nf.SrcTokenID,
-		DestTokenID: nf.DestTokenID,
-		CBType:      nf.CBType,
-		Status:      StatusPending,
-		Payload:     nf.Payload,
-	})
+	nf, err := newNotif(nf, time.Now())
+	if err != nil {
+		return NilID, err
+	}
+
+	nf.EventVersion, err = ns.validatePayload(ctx, nf)
+	if err != nil {
+		return NilID, err
+	}
+
+	err = ns.notifRepo.CreateNotif(ctx, nf)
 	if err != nil {
 		return NilID, errors.Wrap(err, "create notif")
 	}
 
-	//  Send the notification to queue
-	err = ns.sender.Send(ctx, NotifMsg{
-		NotifID:     notifID,
-		DestTokenID: nf.DestTokenID,
-		CBType:      nf.CBType,
-		Payload:     nf.Payload,
-	})
+	err = ns.send(ctx, nf)
+	if err != nil {
+		return NilID, err
+	}
+
+	return nf.ID, nil
+}
+
+// newNotif validates the notification and returns the notification record
+func newNotif(nf Notif, now time.Time) (Notif, error) {
+	// Patterns are for subscriptions only
+	if nf.CBType.IsPattern() {
+		return Notif{}, callback.ErrInvalidCBType
+	}
+
+	if nf.Expired(now) || (nf.ExpiresAt != nil && nf.DeliverAt != nil &&
+		!nf.DeliverAt.Before(*nf.ExpiresAt)) {
+		return Notif{}, ErrInvalidExpiry
+	}
+
+	// Notifications in the future are scheduled,
+	// the rest are delivered right away
+	status, deliverAt := StatusPending, nf.DeliverAt
+	if deliverAt != nil && deliverAt.After(now) {
+		status = StatusScheduled
+	} else {
+		deliverAt = nil
+	}
+
+	return Notif{
+		ID:           NewID(),
+		SrcTokenID:   nf.SrcTokenID,
+		DestTokenID:  nf.DestTokenID,
+		CBType:       nf.CBType,
+		Status:       status,
+		Payload:      nf.Payload,
+		OrderingKey:  nf.OrderingKey,
+		DeliverAt:    deliverAt,
+		ExpiresAt:    nf.ExpiresAt,
+		EventID:      nf.EventID,
+		EventVersion: nf.EventVersion,
+	}, nil
+}
+
+// validatePayload validates the payload against the schema of the event
+// type version of the notification and returns the version of the payload
+func (ns *NotifService) validatePayload(ctx context.Context, nf Notif) (int, error) {
+	et, err := ns.eventTypeRepo.GetEventType(ctx, nf.CBType)
+	if err != nil {
+		if err == eventtype.ErrEventTypeNotFound {
+			return 0, err
+		}
+
+		return 0, errors.Wrap(err, "get event type")
+	}
+
+	// Payloads are of the latest version unless told otherwise
+	if nf.EventVersion == 0 || nf.EventVersion == et.Version {
+		return et.Version, et.ValidatePayload(nf.Payload)
+	}
+
+	versions, err := ns.eventTypeRepo.ListVersions(ctx, nf.CBType)
+	if err != nil {
+		return 0, errors.Wrap(err, "list versions")
+	}
+
+	for _, v := range versions {
+		if v.Version == nf.EventVersion {
+			return v.Version, v.ValidatePayload(nf.Payload)
+		}
+	}
+
+	return 0, eventtype.ErrVersionNotFound
+}
+
+// send sends the notification to queue
+func (ns *NotifService) send(ctx context.Context, nf Notif) error {
+	// The scheduler sends the notification once it's due
+	if nf.Status == StatusScheduled {
+		return nil
+	}
+
+	err := ns.sender.Send(ctx, newNotifMsg(nf))
+	if err != nil {
+		return errors.Wrap(err, "send notif message to queue")
+	}
+
+	return nil
+}
+
+func (ns *NotifService) PublishEvent(ctx context.Context, nf Notif) (EventID, []ID, error) {
+	// validate before looking up the subscribers
+	_, err := newNotif(nf, time.Now())
+	if err != nil {
+		return NilEventID, nil, err
+	}
+
+	nf.EventVersion, err = ns.validatePayload(ctx, nf)
+	if err != nil {
+		return NilEventID, nil, err
+	}
+
+	// The publisher can reach its own subscriptions
+	// and the tokens that granted it permission
+	tokenIDs, err := ns.tokenRepo.ListGrantors(ctx, nf.SrcTokenID)
+	if err != nil {
+		return NilEventID, nil, errors.Wrap(err, "list grantors")
+	}
+	tokenIDs = append(tokenIDs, nf.SrcTokenID)
+
+	subscribers, err := ns.callbackRepo.ListSubscribers(ctx, tokenIDs, nf.CBType)
+	if err != nil {
+		return NilEventID, nil, errors.Wrap(err, "list subscribers")
+	}
+
+	event := Event{
+		ID:         NewEventID(),
+		SrcTokenID: nf.SrcTokenID,
+		CBType:     nf.CBType,
+		Payload:    nf.Payload,
+	}
+
+	now := time.Now()
+	nfs := make([]Notif, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		nf.DestTokenID = subscriber
+		nf.EventID = event.ID
+		subNf, err := newNotif(nf, now)
+		if err != nil {
+			return NilEventID, nil, err
+		}
+
+		nfs = append(nfs, subNf)
+	}
+
+	err = ns.notifRepo.CreateEvent(ctx, event, nfs)
 	if err != nil {
-		return NilID, errors.Wrap(err, "send notif message to queue")
+		return NilEventID, nil, errors.Wrap(err, "create event")
 	}
 
-	return notifID, nil
+	notifIDs := make([]ID, 0, len(nfs))
+	for _, subNf := range nfs {
+		err = ns.send(ctx, subNf)
+		if err != nil {
+			return NilEventID, nil, err
+		}
+
+		notifIDs = append(notifIDs, subNf.ID)
+	}
+
+	return event.ID, notifIDs, nil
+}
+
+func (ns *NotifService) GetEvent(ctx context.Context, eventID EventID) (*Event, []Notif, error) {
+	event, err := ns.notifRepo.GetEvent(ctx, eventID)
+	if err != nil {
+		if err == ErrEventNotFound {
+			return nil, nil, err
+		}
+
+		return nil, nil, errors.Wrap(err, "get event")
+	}
+
+	nfs, err := ns.notifRepo.ListNotifsByEventID(ctx, eventID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "list notifs by event id")
+	}
+
+	return event, nfs, nil
 }
 
 func (ns *NotifService) GetNotif(ctx context.Context, notifID ID) (*Notif, error) {
@@ -92,16 +277,82 @@ func (ns *NotifService) ResendNotif(ctx context.Context, notifID ID) error {
 		return nil
 	}
 
-	//  Send the notification to queue
-	err = ns.sender.Send(ctx, NotifMsg{
-		NotifID:     notifID,
-		DestTokenID: nf.DestTokenID,
-		CBType:      nf.CBType,
-		Payload:     nf.Payload,
-	})
+	deliveries, err := ns.notifRepo.ListDeliveries(ctx, notifID)
 	if err != nil {
-		return errors.Wrap(err, "resendsend notif message to queue")
+		return errors.Wrap(err, "list deliveries")
+	}
+
+	// Not fanned out yet, send the notification to queue
+	notifMsg := newNotifMsg(*nf)
+	if len(deliveries) == 0 {
+		err = ns.sender.Send(ctx, notifMsg)
+		if err != nil {
+			return errors.Wrap(err, "resendsend notif message to queue")
+		}
+
+		return nil
+	}
+
+	// Resend to all the callbacks that received the notification
+	for _, delivery := range deliveries {
+		// Skipped deliveries didn't pass the callback filter
+		if delivery.Status == StatusSkipped {
+			continue
+		}
+
+		err = ns.notifRepo.UpdateDeliveryStatus(ctx, delivery.ID, StatusPending)
+		if err != nil {
+			return errors.Wrap(err, "update delivery status")
+		}
+
+		err = ns.sender.Send(ctx, notifMsg.deliveryMsg(delivery))
+		if err != nil {
+			return errors.Wrap(err, "resend delivery message to queue")
+		}
+	}
+
+	return nil
+}
+
+func (ns *NotifService) CancelNotif(ctx context.Context, notifID ID) error {
+	err := ns.notifRepo.CancelScheduled(ctx, notifID)
+	if err != nil {
+		if err == ErrNotifNotFound || err == ErrNotifNotScheduled {
+			return err
+		}
+
+		return errors.Wrap(err, "cancel scheduled")
 	}
 
 	return nil
 }
+
+func (ns *NotifService) ListAttempts(ctx context.Context, notifID ID) ([]Attempt, error) {
+	// make sure notif exists
+	_, err := ns.GetNotif(ctx, notifID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := ns.notifRepo.ListAttempts(ctx, notifID)
+	if err != nil {
+		return nil, errors.Wrap(err, "list attempts")
+	}
+
+	return attempts, nil
+}
+
+func (ns *NotifService) ListDeliveries(ctx context.Context, notifID ID) ([]Delivery, error) {
+	// make sure notif exists
+	_, err := ns.GetNotif(ctx, notifID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := ns.notifRepo.ListDeliveries(ctx, notifID)
+	if err != nil {
+		return nil, errors.Wrap(err, "list deliveries")
+	}
+
+	return deliveries, nil
+}
@@ -2,10 +2,13 @@ package notif_test
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stevenferrer/notifi/callback"
 	callbacksvc "github.com/stevenferrer/notifi/callback/service"
+	"github.com/stevenferrer/notifi/eventtype"
 	"github.com/stevenferrer/notifi/notif"
 	"github.com/stevenferrer/notifi/notifihttp"
 	"github.com/stevenferrer/notifi/postgres"
@@ -26,12 +29,15 @@ func TestNotifServie(t *testing.T) {
 	tokenSvc := token.NewTokenService(tokenRepo)
 
 	callbackRepo := postgres.NewCallbackRepository(db)
+	eventTypeRepo := postgres.NewEventTypeRepository(db)
 	requestSender := notifihttp.NewDefaultRequestSender()
 	callbackSvc := callbacksvc.NewCallbackService(callbackRepo,
-		tokenRepo, requestSender)
+		tokenRepo, eventTypeRepo, requestSender)
 
 	notifRepo := postgres.NewNotifRepository(db)
-	notifSvc := notif.NewNotifService(notifRepo, &notif.NopSender{})
+	eventTypeSvc := eventtype.NewEventTypeService(eventTypeRepo)
+	notifSvc := notif.NewNotifService(notifRepo, callbackRepo,
+		tokenRepo, eventTypeRepo, &notif.NopSender{})
 
 	ctx := context.TODO()
 
@@ -48,6 +54,15 @@ func TestNotifServie(t *testing.T) {
 	_, err = callbackSvc.CreateCallback(ctx, cb)
 	require.NoError(t, err)
 
+	// register the event types
+	for _, name := range []callback.CBType{cb.CBType, "order.created", "refund.created"} {
+		err = eventTypeSvc.RegisterEventType(ctx, eventtype.EventType{
+			Name:    name,
+			TokenID: tk.ID,
+		})
+		require.NoError(t, err)
+	}
+
 	// create notification
 	nf := notif.Notif{
 		SrcTokenID:  tk.ID,
@@ -89,4 +104,301 @@ func TestNotifServie(t *testing.T) {
 	// update not found notif
 	err = notifSvc.UpdateStatus(ctx, notif.NewID(), notif.StatusComplete)
 	require.ErrorIs(t, err, notif.ErrNotifNotFound)
+
+	t.Run("scheduled notification", func(t *testing.T) {
+		deliverAt := time.Now().Add(time.Hour)
+		notifID, err := notifSvc.CreateNotif(ctx, notif.Notif{
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      cb.CBType,
+			Payload:     map[string]interface{}{"id": "1234"},
+			DeliverAt:   &deliverAt,
+		})
+		require.NoError(t, err)
+
+		gotNf, err := notifSvc.GetNotif(ctx, notifID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusScheduled, gotNf.Status)
+		require.NotNil(t, gotNf.DeliverAt)
+		assert.WithinDuration(t, deliverAt, *gotNf.DeliverAt, time.Millisecond)
+
+		// cancel scheduled notification
+		err = notifSvc.CancelNotif(ctx, notifID)
+		require.NoError(t, err)
+
+		gotNf, err = notifSvc.GetNotif(ctx, notifID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusCancelled, gotNf.Status)
+
+		// can only cancel scheduled notifications
+		err = notifSvc.CancelNotif(ctx, notifID)
+		require.ErrorIs(t, err, notif.ErrNotifNotScheduled)
+
+		err = notifSvc.CancelNotif(ctx, notif.NewID())
+		require.ErrorIs(t, err, notif.ErrNotifNotFound)
+
+		// past delivery time is delivered right away
+		deliverAt = time.Now().Add(-time.Hour)
+		notifID, err = notifSvc.CreateNotif(ctx, notif.Notif{
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      cb.CBType,
+			Payload:     map[string]interface{}{"id": "1234"},
+			DeliverAt:   &deliverAt,
+		})
+		require.NoError(t, err)
+
+		gotNf, err = notifSvc.GetNotif(ctx, notifID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusPending, gotNf.Status)
+		assert.Nil(t, gotNf.DeliverAt)
+	})
+
+	t.Run("notification expiry", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Minute)
+		notifID, err := notifSvc.CreateNotif(ctx, notif.Notif{
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      cb.CBType,
+			Payload:     map[string]interface{}{"otp": "1234"},
+			ExpiresAt:   &expiresAt,
+		})
+		require.NoError(t, err)
+
+		gotNf, err := notifSvc.GetNotif(ctx, notifID)
+		require.NoError(t, err)
+		require.NotNil(t, gotNf.ExpiresAt)
+		assert.WithinDuration(t, expiresAt, *gotNf.ExpiresAt, time.Millisecond)
+
+		// already expired
+		expiresAt = time.Now().Add(-time.Minute)
+		_, err = notifSvc.CreateNotif(ctx, notif.Notif{
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      cb.CBType,
+			ExpiresAt:   &expiresAt,
+		})
+		require.ErrorIs(t, err, notif.ErrInvalidExpiry)
+
+		// expires before delivery
+		expiresAt = time.Now().Add(time.Minute)
+		deliverAt := time.Now().Add(time.Hour)
+		_, err = notifSvc.CreateNotif(ctx, notif.Notif{
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      cb.CBType,
+			DeliverAt:   &deliverAt,
+			ExpiresAt:   &expiresAt,
+		})
+		require.ErrorIs(t, err, notif.ErrInvalidExpiry)
+	})
+
+	t.Run("pattern callback type", func(t *testing.T) {
+		// notifications must have a concrete callback type
+		_, err := notifSvc.CreateNotif(ctx, notif.Notif{
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      "invoice.*",
+		})
+		require.ErrorIs(t, err, callback.ErrInvalidCBType)
+	})
+
+	t.Run("event type", func(t *testing.T) {
+		err := eventTypeSvc.RegisterEventType(ctx, eventtype.EventType{
+			Name:    "payment.received",
+			TokenID: tk.ID,
+			Schema: json.RawMessage(`{"type": "object", "required": ["amount"],
+				"properties": {"amount": {"type": "number", "minimum": 0}}}`),
+		})
+		require.NoError(t, err)
+
+		newNotif := func(cbType callback.CBType, payload map[string]interface{}) notif.Notif {
+			return notif.Notif{
+				SrcTokenID:  tk.ID,
+				DestTokenID: tk.ID,
+				CBType:      cbType,
+				Payload:     payload,
+			}
+		}
+
+		_, err = notifSvc.CreateNotif(ctx, newNotif("payment.received",
+			map[string]interface{}{"amount": 100}))
+		require.NoError(t, err)
+
+		// unknown event type
+		_, err = notifSvc.CreateNotif(ctx, newNotif("payment.recieved",
+			map[string]interface{}{"amount": 100}))
+		require.ErrorIs(t, err, eventtype.ErrEventTypeNotFound)
+
+		// payload doesn't match the schema
+		_, err = notifSvc.CreateNotif(ctx, newNotif("payment.received",
+			map[string]interface{}{"amount": -1}))
+		require.ErrorIs(t, err, eventtype.ErrInvalidPayload)
+
+		var validationErr *eventtype.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, []string{"payload.amount: must be >= 0"}, validationErr.Errors)
+
+		_, _, err = notifSvc.PublishEvent(ctx, newNotif("payment.received",
+			map[string]interface{}{}))
+		require.ErrorIs(t, err, eventtype.ErrInvalidPayload)
+
+		// version 2 renames the amount to total
+		_, err = eventTypeSvc.AddVersion(ctx, tk.ID, eventtype.Version{
+			EventType: "payment.received",
+			Schema:    json.RawMessage(`{"type": "object", "required": ["total"]}`),
+			Upcast:    []eventtype.Op{{Op: eventtype.OpRename, From: "amount", Path: "total"}},
+		})
+		require.NoError(t, err)
+
+		// payloads are of the latest version by default
+		notifID, err := notifSvc.CreateNotif(ctx, newNotif("payment.received",
+			map[string]interface{}{"total": 100}))
+		require.NoError(t, err)
+
+		gotNf, err := notifSvc.GetNotif(ctx, notifID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, gotNf.EventVersion)
+
+		// older versions are validated against their own schema
+		nf := newNotif("payment.received", map[string]interface{}{"amount": 100})
+		nf.EventVersion = 1
+		notifID, err = notifSvc.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		gotNf, err = notifSvc.GetNotif(ctx, notifID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, gotNf.EventVersion)
+
+		nf.EventVersion = 3
+		_, err = notifSvc.CreateNotif(ctx, nf)
+		require.ErrorIs(t, err, eventtype.ErrVersionNotFound)
+	})
+
+	t.Run("resend", func(t *testing.T) {
+		cb2ID, err := callbackSvc.CreateCallback(ctx, callback.Callback{
+			TokenID: tk.ID,
+			CBType:  cb.CBType,
+			URL:     "https://example.com/skipped",
+		})
+		require.NoError(t, err)
+
+		nf := notif.Notif{
+			ID:          notif.NewID(),
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      cb.CBType,
+			Status:      notif.StatusComplete,
+			Payload:     map[string]interface{}{},
+		}
+		err = notifRepo.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		callbacks, err := callbackRepo.ListCbsByTokenIDnCbType(ctx, tk.ID, cb.CBType)
+		require.NoError(t, err)
+
+		deliveries := []notif.Delivery{}
+		for _, c := range callbacks {
+			status := notif.StatusComplete
+			if c.ID == cb2ID {
+				status = notif.StatusSkipped
+			}
+
+			deliveries = append(deliveries, notif.Delivery{
+				ID:         notif.NewDeliveryID(),
+				NotifID:    nf.ID,
+				CallbackID: c.ID,
+				Status:     status,
+			})
+		}
+		_, err = notifRepo.CreateDeliveries(ctx, nf.ID, deliveries)
+		require.NoError(t, err)
+
+		err = notifSvc.ResendNotif(ctx, nf.ID)
+		require.NoError(t, err)
+
+		// skipped deliveries are not resent
+		gotDeliveries, err := notifRepo.ListDeliveries(ctx, nf.ID)
+		require.NoError(t, err)
+		require.Len(t, gotDeliveries, len(deliveries))
+		for _, delivery := range gotDeliveries {
+			if delivery.CallbackID == cb2ID {
+				assert.Equal(t, notif.StatusSkipped, delivery.Status)
+			} else {
+				assert.Equal(t, notif.StatusPending, delivery.Status)
+			}
+		}
+	})
+
+	t.Run("broadcast", func(t *testing.T) {
+		// subscribers that granted the publisher, the other doesn't
+		newSubscriber := func(cbType callback.CBType, granted bool) token.ID {
+			sub, err := tokenSvc.CreateToken(ctx)
+			require.NoError(t, err)
+
+			_, err = callbackSvc.CreateCallback(ctx, callback.Callback{
+				TokenID: sub.ID,
+				CBType:  cbType,
+				URL:     "https://example.com/" + string(sub.ID),
+			})
+			require.NoError(t, err)
+
+			if granted {
+				_, err = tokenSvc.GrantPublisher(ctx, sub.ID, tk.ID)
+				require.NoError(t, err)
+			}
+
+			return sub.ID
+		}
+
+		sub1 := newSubscriber("order.created", true)
+		sub2 := newSubscriber("order.*", true)
+		_ = newSubscriber("order.created", false)
+		_ = newSubscriber("payment.created", true)
+
+		eventID, notifIDs, err := notifSvc.PublishEvent(ctx, notif.Notif{
+			SrcTokenID: tk.ID,
+			CBType:     "order.created",
+			Payload:    map[string]interface{}{"order_id": "1234"},
+		})
+		require.NoError(t, err)
+		require.Len(t, notifIDs, 2)
+
+		event, nfs, err := notifSvc.GetEvent(ctx, eventID)
+		require.NoError(t, err)
+		assert.Equal(t, tk.ID, event.SrcTokenID)
+		assert.Equal(t, callback.CBType("order.created"), event.CBType)
+		require.Len(t, nfs, 2)
+
+		destTokenIDs := []token.ID{}
+		for _, nf := range nfs {
+			assert.Equal(t, eventID, nf.EventID)
+			assert.Equal(t, notif.StatusPending, nf.Status)
+			destTokenIDs = append(destTokenIDs, nf.DestTokenID)
+		}
+		assert.ElementsMatch(t, []token.ID{sub1, sub2}, destTokenIDs)
+
+		// no subscribers
+		eventID, notifIDs, err = notifSvc.PublishEvent(ctx, notif.Notif{
+			SrcTokenID: tk.ID,
+			CBType:     "refund.created",
+			Payload:    map[string]interface{}{},
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, eventID)
+		assert.Empty(t, notifIDs)
+
+		_, _, err = notifSvc.GetEvent(ctx, notif.NewEventID())
+		assert.ErrorIs(t, err, notif.ErrEventNotFound)
+
+		// the grants only limit the broadcasts, the direct
+		// sends to the other tokens work as before
+		_, err = notifSvc.CreateNotif(ctx, notif.Notif{
+			SrcTokenID:  tk.ID,
+			DestTokenID: newSubscriber("order.created", false),
+			CBType:      "order.created",
+			Payload:     map[string]interface{}{"order_id": "1234"},
+		})
+		require.NoError(t, err)
+	})
 }
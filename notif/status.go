@@ -7,4 +7,33 @@ const (
 	StatusPending  Status = "PENDING"
 	StatusComplete Status = "COMPLETE"
 	StatusFailed   Status = "FAILED"
+	// StatusDead means the notification won't be retried anymore
+	StatusDead Status = "DEAD"
+	// StatusParked means the delivery is on hold until the endpoint recovers
+	StatusParked Status = "PARKED"
+	// StatusScheduled means the notification is waiting for its delivery time
+	StatusScheduled Status = "SCHEDULED"
+	// StatusCancelled means the scheduled notification was cancelled
+	StatusCancelled Status = "CANCELLED"
+	// StatusExpired means the notification expired before it was delivered
+	StatusExpired Status = "EXPIRED"
+	// StatusPartial means only some of the deliveries are complete
+	StatusPartial Status = "PARTIAL"
+	// StatusSkipped means the notification didn't pass the callback filter
+	StatusSkipped Status = "SKIPPED"
 )
+
+// FinalStatuses are the statuses of the notifications that are done processing
+var FinalStatuses = []Status{StatusComplete, StatusDead,
+	StatusCancelled, StatusExpired, StatusPartial, StatusSkipped}
+
+// Final reports whether the notification is done processing
+func (s Status) Final() bool {
+	for _, status := range FinalStatuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,24 @@
+package notifihttp
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// NewAdminMw only allows the requests with the admin key.
+// All requests are rejected if the admin key is empty.
+func NewAdminMw(adminKey string) StdMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-ADMIN-KEY")
+			if adminKey == "" || key == "" ||
+				subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+				status := http.StatusUnauthorized
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
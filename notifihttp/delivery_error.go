@@ -0,0 +1,73 @@
+package notifihttp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeliveryError is returned when the request could not be delivered to the receiver
+type DeliveryError struct {
+	// StatusCode is the response status code, 0 if there was no response
+	StatusCode int
+	// Header is the response header, nil if there was no response
+	Header http.Header
+	// Err is the underlying error if there was no response
+	Err error
+}
+
+func (e *DeliveryError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("unsuccessful response status %d", e.StatusCode)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the delivery can be retried. Client errors,
+// except for request timeout and too many requests, are permanent.
+func (e *DeliveryError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+
+	return e.StatusCode < 400 || e.StatusCode >= 500
+}
+
+// RetryAfter returns the delay requested by the receiver
+// through the Retry-After header, 0 if not requested
+func (e *DeliveryError) RetryAfter() time.Duration {
+	if e.StatusCode != http.StatusTooManyRequests &&
+		e.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	return parseRetryAfter(e.Header.Get("Retry-After"), time.Now())
+}
+
+// parseRetryAfter parses the Retry-After header which
+// is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,65 @@
+package notifihttp
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryError(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		retryable  bool
+	}{
+		{statusCode: 0, retryable: true},
+		{statusCode: http.StatusBadRequest, retryable: false},
+		{statusCode: http.StatusNotFound, retryable: false},
+		{statusCode: http.StatusGone, retryable: false},
+		{statusCode: http.StatusRequestTimeout, retryable: true},
+		{statusCode: http.StatusTooManyRequests, retryable: true},
+		{statusCode: http.StatusInternalServerError, retryable: true},
+		{statusCode: http.StatusServiceUnavailable, retryable: true},
+	}
+
+	for _, tc := range tests {
+		err := &DeliveryError{StatusCode: tc.statusCode}
+		assert.Equal(t, tc.retryable, err.Retryable(), tc.statusCode)
+	}
+
+	// retry after is honored for 429 and 503 only
+	header := http.Header{}
+	header.Set("Retry-After", "120")
+
+	err := &DeliveryError{StatusCode: http.StatusTooManyRequests, Header: header}
+	assert.Equal(t, 2*time.Minute, err.RetryAfter())
+
+	err = &DeliveryError{StatusCode: http.StatusServiceUnavailable, Header: header}
+	assert.Equal(t, 2*time.Minute, err.RetryAfter())
+
+	err = &DeliveryError{StatusCode: http.StatusInternalServerError, Header: header}
+	assert.Zero(t, err.RetryAfter())
+
+	// can be unwrapped from wrapped errors
+	var deliveryErr *DeliveryError
+	assert.True(t, errors.As(errors.Wrap(err, "send request"), &deliveryErr))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("-1", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+
+	date := now.Add(time.Minute).UTC().Format(http.TimeFormat)
+	delay := parseRetryAfter(date, now)
+	assert.InDelta(t, float64(time.Minute), float64(delay), float64(time.Second))
+
+	// date in the past
+	date = now.Add(-time.Minute).UTC().Format(http.TimeFormat)
+	assert.Zero(t, parseRetryAfter(date, now))
+}
@@ -10,6 +10,8 @@ type Error struct {
 	Err     error  `json:"-"`
 	Status  int    `json:"-"`
 	Message string `json:"message"`
+	// Errors are the validation errors of the request
+	Errors []string `json:"errors,omitempty"`
 }
 
 func (e *Error) Error() string {
@@ -25,6 +27,13 @@ func NewBadRequestError(err error) *Error {
 	}
 }
 
+// NewValidationError returns a bad request error with the validation errors
+func NewValidationError(err error, errs []string) *Error {
+	apiErr := NewBadRequestError(err)
+	apiErr.Errors = errs
+	return apiErr
+}
+
 func NewNotFoundError(err error) *Error {
 	status := http.StatusNotFound
 	return &Error{
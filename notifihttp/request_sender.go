@@ -8,9 +8,49 @@ import (
 	"github.com/pkg/errors"
 )
 
+// MaxResponseBodySize is the max number of bytes read from the response body
+const MaxResponseBodySize = 1024
+
 type RequestSender interface {
-	SendRequest(ctx context.Context, urlStr string,
-		body io.Reader, headers map[string]string) error
+	SendRequest(ctx context.Context, req Request) (*Response, error)
+}
+
+// Request is the HTTP request to send
+type Request struct {
+	// URL is the request url
+	URL string
+	// Body is the request body
+	Body io.Reader
+	// Headers are the additional request headers
+	Headers map[string]string
+	// AcceptedStatuses are the response statuses considered
+	// successful, any 2xx status is accepted if empty
+	AcceptedStatuses []int
+}
+
+// accepts reports whether the response status is successful
+func (req Request) accepts(status int) bool {
+	if len(req.AcceptedStatuses) == 0 {
+		return status >= 200 && status < 300
+	}
+
+	for _, accepted := range req.AcceptedStatuses {
+		if status == accepted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Response is the response of the HTTP request
+type Response struct {
+	// StatusCode is the response status code
+	StatusCode int
+	// Header is the response header
+	Header http.Header
+	// Body is the response body truncated to MaxResponseBodySize
+	Body []byte
 }
 
 // DefaultRequestSender is the default HTTP request sender
@@ -33,29 +73,45 @@ func (rs *DefaultRequestSender) WithHTTPClient(httpClient *http.Client) *Default
 	return rs
 }
 
-// SendRequest builds and sends the HTTP request
-func (rs *DefaultRequestSender) SendRequest(ctx context.Context,
-	urlStr string, body io.Reader, headers map[string]string) error {
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, urlStr, body)
+// SendRequest builds and sends the HTTP request. The response is returned
+// even if the response status is not successful. Delivery failures are
+// returned as *DeliveryError.
+func (rs *DefaultRequestSender) SendRequest(ctx context.Context, req Request) (*Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, req.Body)
 	if err != nil {
-		return errors.Wrap(err, "new http request")
+		return nil, errors.Wrap(err, "new http request")
 	}
 	httpReq.Header.Add("content-type", "application/json")
 
 	// Additional headers
-	for key, value := range headers {
+	for key, value := range req.Headers {
 		httpReq.Header.Add(key, value)
 	}
 
 	var httpResp *http.Response
 	httpResp, err = rs.httpClient.Do(httpReq)
 	if err != nil {
-		return errors.Wrap(err, "send http request")
+		return nil, &DeliveryError{Err: errors.Wrap(err, "send http request")}
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(httpResp.Body, MaxResponseBodySize))
+	if err != nil {
+		return nil, errors.Wrap(err, "read response body")
+	}
+
+	resp := &Response{
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Body:       respBody,
 	}
 
-	if httpResp.StatusCode != http.StatusOK {
-		return errors.Errorf("expecting status 200 but got %v", httpResp.StatusCode)
+	if !req.accepts(httpResp.StatusCode) {
+		return resp, &DeliveryError{
+			StatusCode: httpResp.StatusCode,
+			Header:     httpResp.Header,
+		}
 	}
 
-	return nil
+	return resp, nil
 }
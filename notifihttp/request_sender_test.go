@@ -1,22 +1,132 @@
 package notifihttp_test
 
-// import (
-// 	"bytes"
-// 	"context"
-// 	"net/http"
-// 	"testing"
-
-// 	"github.com/stevenferrer/notifi/notifihttp"
-// 	"github.com/stretchr/testify/assert"
-// )
-
-// func TestRequestSender(t *testing.T) {
-// 	rs := notifihttp.NewDefaultRequestSender().
-// 		WithHTTPClient(http.DefaultClient)
-
-// 	buf := &bytes.Buffer{}
-// 	buf.Write([]byte("hello"))
-// 	urlStr := "https://webhook.site/3d597059-4092-4cc3-8c00-b988a6e7bf83"
-// 	err := rs.SendRequest(context.Background(), urlStr, buf)
-// 	assert.NoError(t, err)
-// }
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/notifihttp"
+)
+
+func TestRequestSender(t *testing.T) {
+	// receiver responds with the status in the path
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("content-type"))
+		assert.Equal(t, "1234", r.Header.Get("X-IDEMPOTENT-KEY"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"message":"hello"}`, string(body))
+
+		switch r.URL.Path {
+		case "/200":
+			w.WriteHeader(http.StatusOK)
+		case "/201":
+			w.WriteHeader(http.StatusCreated)
+		case "/202":
+			w.WriteHeader(http.StatusAccepted)
+		case "/204":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "/409":
+			w.WriteHeader(http.StatusConflict)
+		case "/429":
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, _ = w.Write([]byte(strings.Repeat("x", 2*notifihttp.MaxResponseBodySize)))
+	}))
+	defer srv.Close()
+
+	rs := notifihttp.NewDefaultRequestSender().
+		WithHTTPClient(srv.Client())
+
+	ctx := context.TODO()
+	newRequest := func(path string, accepted ...int) notifihttp.Request {
+		return notifihttp.Request{
+			URL:              srv.URL + path,
+			Body:             strings.NewReader(`{"message":"hello"}`),
+			Headers:          map[string]string{"X-IDEMPOTENT-KEY": "1234"},
+			AcceptedStatuses: accepted,
+		}
+	}
+
+	t.Run("2xx is accepted by default", func(t *testing.T) {
+		for _, status := range []int{200, 201, 202, 204} {
+			resp, err := rs.SendRequest(ctx, newRequest("/"+strconv.Itoa(status)))
+			require.NoError(t, err, status)
+			assert.Equal(t, status, resp.StatusCode)
+		}
+	})
+
+	t.Run("Response body is truncated", func(t *testing.T) {
+		resp, err := rs.SendRequest(ctx, newRequest("/200"))
+		require.NoError(t, err)
+		assert.Len(t, resp.Body, notifihttp.MaxResponseBodySize)
+	})
+
+	t.Run("Non 2xx is not accepted by default", func(t *testing.T) {
+		resp, err := rs.SendRequest(ctx, newRequest("/500"))
+		var deliveryErr *notifihttp.DeliveryError
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.Equal(t, http.StatusInternalServerError, deliveryErr.StatusCode)
+		assert.True(t, deliveryErr.Retryable())
+
+		// response is still returned
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+		_, err = rs.SendRequest(ctx, newRequest("/409"))
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.Equal(t, http.StatusConflict, deliveryErr.StatusCode)
+		assert.False(t, deliveryErr.Retryable())
+	})
+
+	t.Run("Accepted statuses override", func(t *testing.T) {
+		// 202 only
+		_, err := rs.SendRequest(ctx, newRequest("/202", http.StatusAccepted))
+		require.NoError(t, err)
+
+		_, err = rs.SendRequest(ctx, newRequest("/200", http.StatusAccepted))
+		var deliveryErr *notifihttp.DeliveryError
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.Equal(t, http.StatusOK, deliveryErr.StatusCode)
+
+		// non 2xx can be accepted too
+		_, err = rs.SendRequest(ctx, newRequest("/409", http.StatusOK, http.StatusConflict))
+		require.NoError(t, err)
+	})
+
+	t.Run("Retry after", func(t *testing.T) {
+		_, err := rs.SendRequest(ctx, newRequest("/429"))
+		var deliveryErr *notifihttp.DeliveryError
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.True(t, deliveryErr.Retryable())
+		assert.Equal(t, "30", deliveryErr.Header.Get("Retry-After"))
+	})
+
+	t.Run("Receiver is down", func(t *testing.T) {
+		downSrv := httptest.NewServer(http.NotFoundHandler())
+		downSrv.Close()
+
+		_, err := rs.SendRequest(ctx, notifihttp.Request{
+			URL:  downSrv.URL,
+			Body: strings.NewReader(`{}`),
+		})
+		var deliveryErr *notifihttp.DeliveryError
+		require.ErrorAs(t, err, &deliveryErr)
+		assert.Zero(t, deliveryErr.StatusCode)
+		assert.True(t, deliveryErr.Retryable())
+	})
+}
@@ -3,7 +3,9 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 
 	"github.com/stevenferrer/notifi/callback"
@@ -18,34 +20,99 @@ func NewCallbackRepository(db *sql.DB) *CallbackRepository {
 	return &CallbackRepository{db: db}
 }
 
+// cbColumns are the columns scanned by scanCallback
+const cbColumns = `id, token_id, cb_type, cb_url, retry_config, 
+		accepted_statuses, rate_limit, ordered, filter, template, 
+		event_version, channel, channel_config, breaker_state, 
+		breaker_failures, breaker_failing_since, breaker_next_probe_at, 
+		disabled_at`
+
 func (repo *CallbackRepository) CreateCallback(ctx context.Context,
 	cb callback.Callback) error {
-	// check of callback type already exists for token (user)
-	exists, err := repo.checkCbExists(ctx, cb.TokenID, cb.CBType)
+	retryConfig, err := marshalNullable(cb.RetryConfig)
+	if err != nil {
+		return errors.Wrap(err, "marshal retry config")
+	}
+
+	acceptedStatuses, err := marshalNullable(cb.AcceptedStatuses)
+	if err != nil {
+		return errors.Wrap(err, "marshal accepted statuses")
+	}
+
+	rateLimit, err := marshalNullable(cb.RateLimit)
+	if err != nil {
+		return errors.Wrap(err, "marshal rate limit")
+	}
+
+	stmnt := `insert into callbacks (id, token_id, cb_type, cb_url, 
+			retry_config, accepted_statuses, rate_limit, ordered, filter, 
+			template, event_version, channel, channel_config)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+	_, err = repo.db.ExecContext(ctx, stmnt, cb.ID, cb.TokenID, cb.CBType,
+		cb.URL, retryConfig, acceptedStatuses, rateLimit, cb.Ordered,
+		cb.Filter, cb.Template, cb.EventVersion, cb.Channel,
+		nullableJSON(cb.ChannelConfig))
+	if err != nil {
+		// the endpoint is already subscribed to the callback type
+		if isUniqueViolation(err) {
+			return callback.ErrCallbackExists
+		}
+
+		return errors.Wrap(err, "exec context")
+	}
+
+	return nil
+}
+
+func (repo *CallbackRepository) UpdateCallback(ctx context.Context,
+	cb callback.Callback) error {
+	retryConfig, err := marshalNullable(cb.RetryConfig)
+	if err != nil {
+		return errors.Wrap(err, "marshal retry config")
+	}
+
+	acceptedStatuses, err := marshalNullable(cb.AcceptedStatuses)
 	if err != nil {
-		return errors.Wrap(err, "check callback exists")
+		return errors.Wrap(err, "marshal accepted statuses")
 	}
 
-	// callback exists
-	if exists {
-		return callback.ErrCallbackExists
+	rateLimit, err := marshalNullable(cb.RateLimit)
+	if err != nil {
+		return errors.Wrap(err, "marshal rate limit")
 	}
 
-	stmnt := `insert into callbacks (id, token_id, cb_type, cb_url)
-		values ($1, $2, $3, $4)`
-	_, err = repo.db.ExecContext(ctx, stmnt, cb.ID, cb.TokenID, cb.CBType, cb.URL)
+	stmnt := `update callbacks set cb_url=$2, retry_config=$3, 
+			accepted_statuses=$4, rate_limit=$5, ordered=$6, filter=$7, 
+			template=$8, event_version=$9, channel=$10, channel_config=$11, 
+			updated_at=NOW()
+		where id=$1`
+	result, err := repo.db.ExecContext(ctx, stmnt, cb.ID, cb.URL, retryConfig,
+		acceptedStatuses, rateLimit, cb.Ordered, cb.Filter, cb.Template,
+		cb.EventVersion, cb.Channel, nullableJSON(cb.ChannelConfig))
 	if err != nil {
+		// the new endpoint is already subscribed to the callback type
+		if isUniqueViolation(err) {
+			return callback.ErrCallbackExists
+		}
+
 		return errors.Wrap(err, "exec context")
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+
+	if affected == 0 {
+		return callback.ErrCallbackNotFound
+	}
+
 	return nil
 }
 
 func (repo *CallbackRepository) GetCallback(ctx context.Context, cbID callback.ID) (*callback.Callback, error) {
-	stmnt := `select id, token_id, cb_type, cb_url from callbacks where id=$1`
-	var cb callback.Callback
-	err := repo.db.QueryRowContext(ctx, stmnt, cbID).
-		Scan(&cb.ID, &cb.TokenID, &cb.CBType, &cb.URL)
+	stmnt := `select ` + cbColumns + ` from callbacks where id=$1`
+	cb, err := scanCallback(repo.db.QueryRowContext(ctx, stmnt, cbID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, callback.ErrCallbackNotFound
@@ -53,36 +120,173 @@ func (repo *CallbackRepository) GetCallback(ctx context.Context, cbID callback.I
 		return nil, errors.Wrap(err, "query row context")
 	}
 
-	return &cb, nil
+	return cb, nil
 }
 
-func (repo *CallbackRepository) GetCbByTokenIDnCbType(ctx context.Context,
-	tokenID token.ID, cbType callback.CBType) (*callback.Callback, error) {
-	stmnt := `select id, token_id, cb_type, cb_url from callbacks 
-		where token_id=$1 and cb_type=$2`
-	var cb callback.Callback
-	err := repo.db.QueryRowContext(ctx, stmnt, tokenID, cbType).
-		Scan(&cb.ID, &cb.TokenID, &cb.CBType, &cb.URL)
+func (repo *CallbackRepository) ListCbsByTokenIDnCbType(ctx context.Context,
+	tokenID token.ID, cbType callback.CBType) ([]callback.Callback, error) {
+	// the patterns are matched after fetching
+	stmnt := `select ` + cbColumns + ` from callbacks 
+		where token_id=$1 and (cb_type=$2 or cb_type ~ '(^|\.)[*#](\.|$)') 
+		order by created_at, id`
+	rows, err := repo.db.QueryContext(ctx, stmnt, tokenID, cbType)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	callbacks := []callback.Callback{}
+	for rows.Next() {
+		cb, err := scanCallback(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		if cb.CBType.Matches(cbType) {
+			callbacks = append(callbacks, *cb)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return callbacks, nil
+}
+
+func (repo *CallbackRepository) ListSubscribers(ctx context.Context,
+	tokenIDs []token.ID, cbType callback.CBType) ([]token.ID, error) {
+	ids := make([]string, 0, len(tokenIDs))
+	for _, tokenID := range tokenIDs {
+		ids = append(ids, string(tokenID))
+	}
+
+	// the patterns are matched after fetching
+	stmnt := `select distinct token_id, cb_type from callbacks 
+		where token_id = any($1) and (cb_type=$2 or cb_type ~ '(^|\.)[*#](\.|$)') 
+		order by token_id`
+	rows, err := repo.db.QueryContext(ctx, stmnt, pq.Array(ids), cbType)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	subscribers := []token.ID{}
+	seen := map[token.ID]bool{}
+	for rows.Next() {
+		var (
+			tokenID token.ID
+			subType callback.CBType
+		)
+		err = rows.Scan(&tokenID, &subType)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		if seen[tokenID] || !subType.Matches(cbType) {
+			continue
+		}
+
+		seen[tokenID] = true
+		subscribers = append(subscribers, tokenID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return subscribers, nil
+}
+
+func (repo *CallbackRepository) UpdateBreaker(ctx context.Context,
+	cbID callback.ID, update func(*callback.Callback) error) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	stmnt := `select ` + cbColumns + ` from callbacks where id=$1 for update`
+	cb, err := scanCallback(tx.QueryRowContext(ctx, stmnt, cbID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, callback.ErrCallbackNotFound
+			return callback.ErrCallbackNotFound
 		}
-		return nil, errors.Wrap(err, "query row context")
+		return errors.Wrap(err, "query row context")
 	}
 
-	return &cb, nil
+	err = update(cb)
+	if err != nil {
+		return err
+	}
+
+	stmnt = `update callbacks set breaker_state=$2, breaker_failures=$3, 
+			breaker_failing_since=$4, breaker_next_probe_at=$5, disabled_at=$6
+		where id=$1`
+	_, err = tx.ExecContext(ctx, stmnt, cbID, cb.Breaker.State,
+		cb.Breaker.Failures, cb.Breaker.FailingSince,
+		cb.Breaker.NextProbeAt, cb.DisabledAt)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit tx")
+	}
+
+	return nil
+}
+
+// scanner is implemented by sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (repo *CallbackRepository) checkCbExists(ctx context.Context,
-	tokenID token.ID, cbType callback.CBType) (bool, error) {
-	stmnt := `select exists(select 1 from callbacks 
-		where token_id=$1 and cb_type=$2)`
-	var exists bool
-	err := repo.db.QueryRowContext(ctx, stmnt,
-		tokenID, cbType).Scan(&exists)
-	if err != nil && err != sql.ErrNoRows {
-		return false, errors.Wrap(err, "query row context")
+func scanCallback(row scanner) (*callback.Callback, error) {
+	var (
+		cb               callback.Callback
+		retryConfig      []byte
+		acceptedStatuses []byte
+		rateLimit        []byte
+		channelConfig    []byte
+	)
+	err := row.Scan(&cb.ID, &cb.TokenID, &cb.CBType, &cb.URL,
+		&retryConfig, &acceptedStatuses, &rateLimit, &cb.Ordered, &cb.Filter,
+		&cb.Template, &cb.EventVersion, &cb.Channel, &channelConfig,
+		&cb.Breaker.State,
+		&cb.Breaker.Failures, &cb.Breaker.FailingSince,
+		&cb.Breaker.NextProbeAt, &cb.DisabledAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if retryConfig != nil {
+		cb.RetryConfig = &callback.RetryConfig{}
+		err = json.Unmarshal(retryConfig, cb.RetryConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshal retry config")
+		}
+	}
+
+	if acceptedStatuses != nil {
+		err = json.Unmarshal(acceptedStatuses, &cb.AcceptedStatuses)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshal accepted statuses")
+		}
 	}
 
-	return exists, nil
+	if rateLimit != nil {
+		cb.RateLimit = &callback.RateLimit{}
+		err = json.Unmarshal(rateLimit, cb.RateLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshal rate limit")
+		}
+	}
+
+	if channelConfig != nil {
+		cb.ChannelConfig = channelConfig
+	}
+
+	return &cb, nil
 }
@@ -2,7 +2,9 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,6 +49,12 @@ func TestCallbackRepository(t *testing.T) {
 	err = callbackRepo.CreateCallback(ctx, cb)
 	require.ErrorIs(t, err, callback.ErrCallbackExists)
 
+	// same endpoint with a different id should give an error
+	cbDup := cb
+	cbDup.ID = callback.NewID()
+	err = callbackRepo.CreateCallback(ctx, cbDup)
+	require.ErrorIs(t, err, callback.ErrCallbackExists)
+
 	// get callback
 	gotCb, err := callbackRepo.GetCallback(ctx, cb.ID)
 	require.NoError(t, err)
@@ -56,19 +64,132 @@ func TestCallbackRepository(t *testing.T) {
 	assert.Equal(t, cb.CBType, gotCb.CBType)
 	assert.Equal(t, cb.URL, gotCb.URL)
 
-	// get callback by token id and cb type
-	gotCb, err = callbackRepo.GetCbByTokenIDnCbType(ctx, tk.ID, cb.CBType)
+	// another endpoint for the same callback type
+	cbOther := cb
+	cbOther.ID = callback.NewID()
+	cbOther.URL = "https://example.org"
+	err = callbackRepo.CreateCallback(ctx, cbOther)
 	require.NoError(t, err)
 
-	assert.Equal(t, cb.ID, gotCb.ID)
-	assert.Equal(t, cb.TokenID, gotCb.TokenID)
-	assert.Equal(t, cb.CBType, gotCb.CBType)
-	assert.Equal(t, cb.URL, gotCb.URL)
+	// list callbacks by token id and cb type
+	gotCbs, err := callbackRepo.ListCbsByTokenIDnCbType(ctx, tk.ID, cb.CBType)
+	require.NoError(t, err)
+	require.Len(t, gotCbs, 2)
+
+	assert.ElementsMatch(t, []callback.ID{cb.ID, cbOther.ID},
+		[]callback.ID{gotCbs[0].ID, gotCbs[1].ID})
 
 	// callback not exist
 	_, err = callbackRepo.GetCallback(ctx, callback.NewID())
 	assert.ErrorIs(t, err, callback.ErrCallbackNotFound)
 
-	_, err = callbackRepo.GetCbByTokenIDnCbType(ctx, token.NewID(), cb.CBType)
-	require.ErrorIs(t, err, callback.ErrCallbackNotFound)
+	gotCbs, err = callbackRepo.ListCbsByTokenIDnCbType(ctx, token.NewID(), cb.CBType)
+	require.NoError(t, err)
+	assert.Empty(t, gotCbs)
+
+	// wildcard subscriptions
+	for _, cbType := range []callback.CBType{"invoice.*", "#", "payment.*"} {
+		err = callbackRepo.CreateCallback(ctx, callback.Callback{
+			ID:      callback.NewID(),
+			TokenID: tk.ID,
+			CBType:  cbType,
+			URL:     "https://example.com/" + string(cbType),
+		})
+		require.NoError(t, err)
+	}
+
+	gotCbs, err = callbackRepo.ListCbsByTokenIDnCbType(ctx, tk.ID, "invoice.paid")
+	require.NoError(t, err)
+	require.Len(t, gotCbs, 2)
+	assert.Equal(t, callback.CBType("invoice.*"), gotCbs[0].CBType)
+	assert.Equal(t, callback.CBType("#"), gotCbs[1].CBType)
+
+	// catch-all receives the exact subscriptions too
+	gotCbs, err = callbackRepo.ListCbsByTokenIDnCbType(ctx, tk.ID, cb.CBType)
+	require.NoError(t, err)
+	assert.Len(t, gotCbs, 3)
+
+	// retry config and accepted statuses are optional
+	assert.Nil(t, gotCb.RetryConfig)
+	assert.Nil(t, gotCb.AcceptedStatuses)
+
+	// callback with retry config
+	cb2 := callback.Callback{
+		ID:      callback.NewID(),
+		TokenID: tk.ID,
+		CBType:  "PAYMENT",
+		URL:     "https://example.com",
+		RetryConfig: &callback.RetryConfig{
+			MaxAttempts: 5,
+			MaxAge:      time.Hour,
+			BaseDelay:   time.Second,
+			MaxDelay:    time.Minute,
+			Jitter:      0.2,
+			Backoff:     callback.BackoffExponential,
+		},
+		AcceptedStatuses: []int{200, 202},
+	}
+	err = callbackRepo.CreateCallback(ctx, cb2)
+	require.NoError(t, err)
+
+	gotCb, err = callbackRepo.GetCallback(ctx, cb2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, cb2.RetryConfig, gotCb.RetryConfig)
+	assert.Equal(t, cb2.AcceptedStatuses, gotCb.AcceptedStatuses)
+
+	// update callback
+	cb2.URL = "https://example.org"
+	cb2.RetryConfig = nil
+	cb2.RateLimit = &callback.RateLimit{PerSecond: 10, Burst: 20}
+	err = callbackRepo.UpdateCallback(ctx, cb2)
+	require.NoError(t, err)
+
+	gotCb, err = callbackRepo.GetCallback(ctx, cb2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, cb2.URL, gotCb.URL)
+	assert.Nil(t, gotCb.RetryConfig)
+	assert.Equal(t, cb2.AcceptedStatuses, gotCb.AcceptedStatuses)
+	assert.Equal(t, cb2.RateLimit, gotCb.RateLimit)
+
+	err = callbackRepo.UpdateCallback(ctx, callback.Callback{ID: callback.NewID()})
+	assert.ErrorIs(t, err, callback.ErrCallbackNotFound)
+
+	// breaker is closed by default
+	assert.Equal(t, callback.BreakerClosed, gotCb.Breaker.State)
+	assert.Zero(t, gotCb.Breaker.Failures)
+	assert.Nil(t, gotCb.DisabledAt)
+
+	// open the breaker and disable the callback
+	now := time.Now().Truncate(time.Microsecond)
+	err = callbackRepo.UpdateBreaker(ctx, cb2.ID, func(cb *callback.Callback) error {
+		cb.Breaker.Fail(now, callback.BreakerConfig{
+			FailureThreshold: 1,
+			ProbeInterval:    time.Minute,
+		})
+		cb.DisabledAt = &now
+		return nil
+	})
+	require.NoError(t, err)
+
+	gotCb, err = callbackRepo.GetCallback(ctx, cb2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, callback.BreakerOpen, gotCb.Breaker.State)
+	assert.Equal(t, 1, gotCb.Breaker.Failures)
+	require.NotNil(t, gotCb.Breaker.FailingSince)
+	assert.True(t, now.Equal(*gotCb.Breaker.FailingSince))
+	require.NotNil(t, gotCb.Breaker.NextProbeAt)
+	assert.True(t, now.Add(time.Minute).Equal(*gotCb.Breaker.NextProbeAt))
+	require.NotNil(t, gotCb.DisabledAt)
+
+	// update errors are returned
+	errUpdate := errors.New("update error")
+	err = callbackRepo.UpdateBreaker(ctx, cb2.ID, func(cb *callback.Callback) error {
+		return errUpdate
+	})
+	assert.Equal(t, errUpdate, err)
+
+	err = callbackRepo.UpdateBreaker(ctx, callback.NewID(), func(cb *callback.Callback) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, callback.ErrCallbackNotFound)
 }
@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/deadletter"
+)
+
+type DeadLetterRepository struct{ db *sql.DB }
+
+var _ deadletter.Repository = (*DeadLetterRepository)(nil)
+
+func NewDeadLetterRepository(db *sql.DB) *DeadLetterRepository {
+	return &DeadLetterRepository{db: db}
+}
+
+func (repo *DeadLetterRepository) CreateDeadLetter(ctx context.Context, dl deadletter.DeadLetter) error {
+	stmnt := `insert into dead_letters (id, notif_id, dest_token_id, 
+			cb_type, reason, body)
+		values ($1, $2, $3, $4, $5, $6)`
+	_, err := repo.db.ExecContext(ctx, stmnt, dl.ID, dl.NotifID,
+		dl.DestTokenID, dl.CBType, dl.Reason, dl.Body)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	return nil
+}
+
+func (repo *DeadLetterRepository) GetDeadLetter(ctx context.Context,
+	dlID deadletter.ID) (*deadletter.DeadLetter, error) {
+	stmnt := `select id, notif_id, dest_token_id, cb_type, reason, 
+		body, created_at from dead_letters where id=$1`
+	var dl deadletter.DeadLetter
+	err := repo.db.QueryRowContext(ctx, stmnt, dlID).
+		Scan(&dl.ID, &dl.NotifID, &dl.DestTokenID, &dl.CBType,
+			&dl.Reason, &dl.Body, &dl.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, deadletter.ErrDeadLetterNotFound
+		}
+
+		return nil, errors.Wrap(err, "query row context")
+	}
+
+	return &dl, nil
+}
+
+func (repo *DeadLetterRepository) ListDeadLetters(ctx context.Context,
+	filter deadletter.Filter) ([]deadletter.DeadLetter, error) {
+	where, args := deadLetterWhere(filter)
+	stmnt := `select id, notif_id, dest_token_id, cb_type, reason, 
+		body, created_at from dead_letters ` + where + ` order by created_at, id`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		stmnt += fmt.Sprintf(" limit $%d", len(args))
+	}
+
+	rows, err := repo.db.QueryContext(ctx, stmnt, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	deadLetters := []deadletter.DeadLetter{}
+	for rows.Next() {
+		var dl deadletter.DeadLetter
+		err = rows.Scan(&dl.ID, &dl.NotifID, &dl.DestTokenID, &dl.CBType,
+			&dl.Reason, &dl.Body, &dl.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		deadLetters = append(deadLetters, dl)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return deadLetters, nil
+}
+
+func (repo *DeadLetterRepository) DeleteDeadLetter(ctx context.Context, dlID deadletter.ID) error {
+	stmnt := `delete from dead_letters where id=$1`
+	result, err := repo.db.ExecContext(ctx, stmnt, dlID)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+
+	if affected == 0 {
+		return deadletter.ErrDeadLetterNotFound
+	}
+
+	return nil
+}
+
+func (repo *DeadLetterRepository) DeleteDeadLetters(ctx context.Context,
+	filter deadletter.Filter) (int, error) {
+	where, args := deadLetterWhere(filter)
+	stmnt := `delete from dead_letters ` + where
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		stmnt = fmt.Sprintf(`delete from dead_letters where id in (
+			select id from dead_letters %s order by created_at, id limit $%d)`,
+			where, len(args))
+	}
+
+	result, err := repo.db.ExecContext(ctx, stmnt, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "exec context")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "rows affected")
+	}
+
+	return int(affected), nil
+}
+
+// deadLetterWhere builds the where clause of the filter
+func deadLetterWhere(filter deadletter.Filter) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	addCond := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.DestTokenID != "" {
+		addCond("dest_token_id=$%d", filter.DestTokenID)
+	}
+
+	if filter.CBType != "" {
+		addCond("cb_type=$%d", filter.CBType)
+	}
+
+	if filter.From != nil {
+		addCond("created_at>=$%d", *filter.From)
+	}
+
+	if filter.To != nil {
+		addCond("created_at<$%d", *filter.To)
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+
+	return "where " + strings.Join(conds, " and "), args
+}
@@ -0,0 +1,124 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/deadletter"
+	"github.com/stevenferrer/notifi/notif"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/token"
+)
+
+func TestDeadLetterRepository(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	deadLetterRepo := postgres.NewDeadLetterRepository(db)
+
+	ctx := context.TODO()
+
+	tokenID := token.NewID()
+	deadLetters := []deadletter.DeadLetter{
+		{
+			ID:          deadletter.NewID(),
+			NotifID:     notif.NewID(),
+			DestTokenID: tokenID,
+			CBType:      "INVOICE",
+			Reason:      "retry policy exhausted",
+			Body:        []byte(`{"notif_id":"1"}`),
+		},
+		{
+			ID:          deadletter.NewID(),
+			NotifID:     notif.NewID(),
+			DestTokenID: tokenID,
+			CBType:      "PAYMENT",
+			Reason:      "expecting 2xx but got 404",
+			Body:        []byte(`{"notif_id":"2"}`),
+		},
+		{
+			// undecodable message
+			ID:     deadletter.NewID(),
+			Reason: "json decode message",
+			Body:   []byte(`garbage`),
+		},
+	}
+
+	for _, dl := range deadLetters {
+		err := deadLetterRepo.CreateDeadLetter(ctx, dl)
+		require.NoError(t, err)
+	}
+
+	t.Run("get dead letter", func(t *testing.T) {
+		dl := deadLetters[0]
+		gotDl, err := deadLetterRepo.GetDeadLetter(ctx, dl.ID)
+		require.NoError(t, err)
+
+		assert.Equal(t, dl.ID, gotDl.ID)
+		assert.Equal(t, dl.NotifID, gotDl.NotifID)
+		assert.Equal(t, dl.DestTokenID, gotDl.DestTokenID)
+		assert.Equal(t, dl.CBType, gotDl.CBType)
+		assert.Equal(t, dl.Reason, gotDl.Reason)
+		assert.Equal(t, dl.Body, gotDl.Body)
+		assert.NotZero(t, gotDl.CreatedAt)
+
+		_, err = deadLetterRepo.GetDeadLetter(ctx, deadletter.NewID())
+		assert.Equal(t, deadletter.ErrDeadLetterNotFound, err)
+	})
+
+	t.Run("list dead letters", func(t *testing.T) {
+		gotDls, err := deadLetterRepo.ListDeadLetters(ctx, deadletter.Filter{})
+		require.NoError(t, err)
+		assert.Len(t, gotDls, 3)
+
+		gotDls, err = deadLetterRepo.ListDeadLetters(ctx, deadletter.Filter{
+			DestTokenID: tokenID,
+		})
+		require.NoError(t, err)
+		assert.Len(t, gotDls, 2)
+
+		gotDls, err = deadLetterRepo.ListDeadLetters(ctx, deadletter.Filter{
+			DestTokenID: tokenID,
+			CBType:      "PAYMENT",
+		})
+		require.NoError(t, err)
+		require.Len(t, gotDls, 1)
+		assert.Equal(t, deadLetters[1].ID, gotDls[0].ID)
+
+		gotDls, err = deadLetterRepo.ListDeadLetters(ctx, deadletter.Filter{Limit: 1})
+		require.NoError(t, err)
+		assert.Len(t, gotDls, 1)
+
+		to := time.Now().Add(-time.Hour)
+		gotDls, err = deadLetterRepo.ListDeadLetters(ctx, deadletter.Filter{To: &to})
+		require.NoError(t, err)
+		assert.Len(t, gotDls, 0)
+	})
+
+	t.Run("delete dead letters", func(t *testing.T) {
+		err := deadLetterRepo.DeleteDeadLetter(ctx, deadLetters[2].ID)
+		require.NoError(t, err)
+
+		err = deadLetterRepo.DeleteDeadLetter(ctx, deadLetters[2].ID)
+		assert.Equal(t, deadletter.ErrDeadLetterNotFound, err)
+
+		deleted, err := deadLetterRepo.DeleteDeadLetters(ctx, deadletter.Filter{
+			DestTokenID: tokenID,
+			Limit:       1,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+
+		deleted, err = deadLetterRepo.DeleteDeadLetters(ctx, deadletter.Filter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+	})
+}
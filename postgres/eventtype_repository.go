@@ -0,0 +1,246 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/eventtype"
+)
+
+type EventTypeRepository struct{ db *sql.DB }
+
+var _ eventtype.Repository = (*EventTypeRepository)(nil)
+
+func NewEventTypeRepository(db *sql.DB) *EventTypeRepository {
+	return &EventTypeRepository{db: db}
+}
+
+func (repo *EventTypeRepository) CreateEventType(ctx context.Context,
+	et eventtype.EventType) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	stmnt := `insert into event_types (name, token_id, description, version, schema) 
+		values ($1, $2, $3, 1, $4) on conflict (name) do nothing`
+	result, err := tx.ExecContext(ctx, stmnt, et.Name,
+		et.TokenID, et.Description, nullableJSON(et.Schema))
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+
+	if affected == 0 {
+		return eventtype.ErrEventTypeExists
+	}
+
+	// the registered schema is the first version
+	err = createVersion(ctx, tx, eventtype.Version{
+		EventType: et.Name,
+		Version:   1,
+		Schema:    et.Schema,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit tx")
+	}
+
+	return nil
+}
+
+func (repo *EventTypeRepository) GetEventType(ctx context.Context,
+	name callback.CBType) (*eventtype.EventType, error) {
+	stmnt := `select name, token_id, description, version, schema, created_at 
+		from event_types where name=$1`
+	et, err := scanEventType(repo.db.QueryRowContext(ctx, stmnt, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, eventtype.ErrEventTypeNotFound
+		}
+
+		return nil, errors.Wrap(err, "query row context")
+	}
+
+	return et, nil
+}
+
+func (repo *EventTypeRepository) ListEventTypes(ctx context.Context) ([]eventtype.EventType, error) {
+	stmnt := `select name, token_id, description, version, schema, created_at 
+		from event_types order by name`
+	rows, err := repo.db.QueryContext(ctx, stmnt)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	eventTypes := []eventtype.EventType{}
+	for rows.Next() {
+		et, err := scanEventType(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		eventTypes = append(eventTypes, *et)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return eventTypes, nil
+}
+
+func scanEventType(row scanner) (*eventtype.EventType, error) {
+	var (
+		et          eventtype.EventType
+		eventSchema []byte
+	)
+	err := row.Scan(&et.Name, &et.TokenID, &et.Description,
+		&et.Version, &eventSchema, &et.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if eventSchema != nil {
+		et.Schema = eventSchema
+	}
+
+	return &et, nil
+}
+
+func (repo *EventTypeRepository) CreateVersion(ctx context.Context,
+	v eventtype.Version) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	err = createVersion(ctx, tx, v)
+	if err != nil {
+		return err
+	}
+
+	// the new version must follow the latest version
+	stmnt := `update event_types set version=$2, schema=$3 
+		where name=$1 and version=$2-1`
+	result, err := tx.ExecContext(ctx, stmnt, v.EventType,
+		v.Version, nullableJSON(v.Schema))
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+
+	if affected == 0 {
+		return eventtype.ErrVersionExists
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit tx")
+	}
+
+	return nil
+}
+
+func createVersion(ctx context.Context, tx *sql.Tx, v eventtype.Version) error {
+	upcast, err := marshalNullable(v.Upcast)
+	if err != nil {
+		return errors.Wrap(err, "marshal upcast")
+	}
+
+	downcast, err := marshalNullable(v.Downcast)
+	if err != nil {
+		return errors.Wrap(err, "marshal downcast")
+	}
+
+	stmnt := `insert into event_type_versions (event_type, version, 
+			schema, upcast, downcast) 
+		values ($1, $2, $3, $4, $5) on conflict (event_type, version) do nothing`
+	result, err := tx.ExecContext(ctx, stmnt, v.EventType, v.Version,
+		nullableJSON(v.Schema), upcast, downcast)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+
+	if affected == 0 {
+		return eventtype.ErrVersionExists
+	}
+
+	return nil
+}
+
+func (repo *EventTypeRepository) ListVersions(ctx context.Context,
+	name callback.CBType) ([]eventtype.Version, error) {
+	stmnt := `select event_type, version, schema, upcast, downcast, created_at 
+		from event_type_versions where event_type=$1 order by version`
+	rows, err := repo.db.QueryContext(ctx, stmnt, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	versions := []eventtype.Version{}
+	for rows.Next() {
+		var (
+			v           eventtype.Version
+			eventSchema []byte
+			upcast      []byte
+			downcast    []byte
+		)
+		err = rows.Scan(&v.EventType, &v.Version, &eventSchema,
+			&upcast, &downcast, &v.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		if eventSchema != nil {
+			v.Schema = eventSchema
+		}
+
+		if upcast != nil {
+			err = json.Unmarshal(upcast, &v.Upcast)
+			if err != nil {
+				return nil, errors.Wrap(err, "unmarshal upcast")
+			}
+		}
+
+		if downcast != nil {
+			err = json.Unmarshal(downcast, &v.Downcast)
+			if err != nil {
+				return nil, errors.Wrap(err, "unmarshal downcast")
+			}
+		}
+
+		versions = append(versions, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return versions, nil
+}
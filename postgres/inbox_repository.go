@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/inbox"
+	"github.com/stevenferrer/notifi/token"
+)
+
+type InboxRepository struct{ db *sql.DB }
+
+var _ inbox.Repository = (*InboxRepository)(nil)
+
+func NewInboxRepository(db *sql.DB) *InboxRepository {
+	return &InboxRepository{db: db}
+}
+
+func (repo *InboxRepository) CreateItem(ctx context.Context, item inbox.Item) error {
+	headers, err := marshalNullable(item.Headers)
+	if err != nil {
+		return errors.Wrap(err, "marshal headers")
+	}
+
+	stmnt := `insert into inbox_items (id, token_id, delivery_id, cb_type, 
+			channel, body, headers)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (token_id, delivery_id) do nothing`
+	_, err = repo.db.ExecContext(ctx, stmnt, item.ID, item.TokenID,
+		item.DeliveryID, item.CBType, item.Channel, item.Body, headers)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	return nil
+}
+
+func (repo *InboxRepository) ReceiveItems(ctx context.Context, tokenID token.ID,
+	opts inbox.ReceiveOptions, now time.Time) ([]inbox.Item, error) {
+	// The received items are locked so that the
+	// concurrent receives don't get the same items. The
+	// redelivered items are received whatever the cursor is.
+	stmnt := `with received as (
+			select id from inbox_items 
+			where token_id=$1 and channel=$2 and visible_at <= $3 
+				and (seq > $4 or receives > 0) 
+				and ($5::varchar = '' or cb_type=$5::varchar)
+			order by seq limit $6
+			for update skip locked
+		)
+		update inbox_items i set visible_at=$7, receives=i.receives+1
+		from received where i.id=received.id
+		returning i.id, i.seq, i.token_id, i.delivery_id, i.cb_type, i.channel, 
+			i.body, i.headers, i.receives, i.visible_at, i.created_at`
+	rows, err := repo.db.QueryContext(ctx, stmnt, tokenID, opts.Channel, now,
+		opts.After, opts.CBType, opts.Limit, now.Add(opts.VisibilityTimeout))
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	items := []inbox.Item{}
+	for rows.Next() {
+		var (
+			item    inbox.Item
+			headers []byte
+		)
+		err = rows.Scan(&item.ID, &item.Seq, &item.TokenID, &item.DeliveryID,
+			&item.CBType, &item.Channel, &item.Body, &headers, &item.Receives, &item.VisibleAt,
+			&item.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		if headers != nil {
+			err = json.Unmarshal(headers, &item.Headers)
+			if err != nil {
+				return nil, errors.Wrap(err, "unmarshal headers")
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	// The updated rows are returned in no particular order
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Seq < items[j].Seq
+	})
+
+	return items, nil
+}
+
+func (repo *InboxRepository) DeleteItems(ctx context.Context,
+	tokenID token.ID, itemIDs []inbox.ID) (int, error) {
+	ids := make([]string, 0, len(itemIDs))
+	for _, itemID := range itemIDs {
+		ids = append(ids, string(itemID))
+	}
+
+	stmnt := `delete from inbox_items where token_id=$1 and id = any($2)`
+	result, err := repo.db.ExecContext(ctx, stmnt, tokenID, pq.Array(ids))
+	if err != nil {
+		return 0, errors.Wrap(err, "exec context")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "rows affected")
+	}
+
+	return int(affected), nil
+}
@@ -0,0 +1,152 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/channel"
+	"github.com/stevenferrer/notifi/inbox"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/token"
+)
+
+func TestInboxRepository(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	tokenRepo := postgres.NewTokenRepository(db)
+	tokenSvc := token.NewTokenService(tokenRepo)
+	inboxRepo := postgres.NewInboxRepository(db)
+
+	ctx := context.TODO()
+
+	tk, err := tokenSvc.CreateToken(ctx)
+	require.NoError(t, err)
+
+	items := []inbox.Item{}
+	for _, cbType := range []callback.CBType{"INVOICE", "PAYMENT", "INVOICE"} {
+		item := inbox.Item{
+			ID:         inbox.NewID(),
+			TokenID:    tk.ID,
+			DeliveryID: string(inbox.NewID()),
+			CBType:     cbType,
+			Channel:    channel.Inbox,
+			Body:       []byte("{\"id\": \"1234\"}\n"),
+			Headers:    map[string]string{"X-IDEMPOTENT-KEY": "1234"},
+		}
+		err = inboxRepo.CreateItem(ctx, item)
+		require.NoError(t, err)
+		items = append(items, item)
+	}
+
+	// the same delivery is stored once
+	dupItem := items[0]
+	dupItem.ID = inbox.NewID()
+	err = inboxRepo.CreateItem(ctx, dupItem)
+	require.NoError(t, err)
+
+	// the inbox doesn't receive the stream items
+	streamItem := items[0]
+	streamItem.ID = inbox.NewID()
+	streamItem.DeliveryID = string(inbox.NewID())
+	streamItem.Channel = channel.Stream
+	err = inboxRepo.CreateItem(ctx, streamItem)
+	require.NoError(t, err)
+
+	now := time.Now()
+	timeout := time.Minute
+	opts := inbox.ReceiveOptions{
+		Channel:           channel.Inbox,
+		Limit:             2,
+		VisibilityTimeout: timeout,
+	}
+
+	t.Run("receive items", func(t *testing.T) {
+		gotItems, err := inboxRepo.ReceiveItems(ctx, tk.ID, opts, now)
+		require.NoError(t, err)
+		require.Len(t, gotItems, 2)
+
+		assert.Equal(t, items[0].ID, gotItems[0].ID)
+		assert.Equal(t, items[1].ID, gotItems[1].ID)
+		assert.Equal(t, items[0].CBType, gotItems[0].CBType)
+		assert.Equal(t, channel.Inbox, gotItems[0].Channel)
+		// the body is stored as is
+		assert.Equal(t, items[0].Body, gotItems[0].Body)
+		assert.Equal(t, items[0].Headers, gotItems[0].Headers)
+		assert.Equal(t, 1, gotItems[0].Receives)
+		assert.WithinDuration(t, now.Add(timeout), gotItems[0].VisibleAt, time.Millisecond)
+
+		// next page
+		nextOpts := opts
+		nextOpts.After = gotItems[1].Seq
+		gotItems, err = inboxRepo.ReceiveItems(ctx, tk.ID, nextOpts, now)
+		require.NoError(t, err)
+		require.Len(t, gotItems, 1)
+		assert.Equal(t, items[2].ID, gotItems[0].ID)
+
+		// the received items are hidden
+		gotItems, err = inboxRepo.ReceiveItems(ctx, tk.ID, opts, now)
+		require.NoError(t, err)
+		assert.Empty(t, gotItems)
+
+		// the other tokens don't see the items
+		gotItems, err = inboxRepo.ReceiveItems(ctx, token.NewID(), opts, now.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, gotItems)
+	})
+
+	t.Run("redeliver unacked items", func(t *testing.T) {
+		acked, err := inboxRepo.DeleteItems(ctx, tk.ID, []inbox.ID{items[0].ID})
+		require.NoError(t, err)
+		assert.Equal(t, 1, acked)
+
+		// the other tokens can't ack the items
+		acked, err = inboxRepo.DeleteItems(ctx, token.NewID(), []inbox.ID{items[1].ID})
+		require.NoError(t, err)
+		assert.Zero(t, acked)
+
+		later := now.Add(timeout)
+		gotItems, err := inboxRepo.ReceiveItems(ctx, tk.ID, opts, later)
+		require.NoError(t, err)
+		require.Len(t, gotItems, 2)
+		assert.Equal(t, items[1].ID, gotItems[0].ID)
+		assert.Equal(t, items[2].ID, gotItems[1].ID)
+		assert.Equal(t, 2, gotItems[0].Receives)
+
+		// filter by callback type
+		filterOpts := opts
+		filterOpts.CBType = "PAYMENT"
+		gotItems, err = inboxRepo.ReceiveItems(ctx, tk.ID, filterOpts, later.Add(timeout))
+		require.NoError(t, err)
+		require.Len(t, gotItems, 1)
+		assert.Equal(t, items[1].ID, gotItems[0].ID)
+
+		// the redelivered items are received whatever the cursor is
+		afterOpts := opts
+		afterOpts.After = gotItems[0].Seq + 100
+		gotItems, err = inboxRepo.ReceiveItems(ctx, tk.ID, afterOpts, later.Add(3*timeout))
+		require.NoError(t, err)
+		require.Len(t, gotItems, 2)
+		assert.Equal(t, items[1].ID, gotItems[0].ID)
+		assert.Equal(t, items[2].ID, gotItems[1].ID)
+	})
+
+	t.Run("receive stream items", func(t *testing.T) {
+		streamOpts := opts
+		streamOpts.Channel = channel.Stream
+		gotItems, err := inboxRepo.ReceiveItems(ctx, tk.ID, streamOpts, now)
+		require.NoError(t, err)
+		require.Len(t, gotItems, 1)
+		assert.Equal(t, streamItem.ID, gotItems[0].ID)
+		assert.Equal(t, channel.Stream, gotItems[0].Channel)
+	})
+}
@@ -71,6 +71,455 @@ var migrations = migrator.Migrations(
 				return err
 			}
 
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Create cb_keys table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `CREATE TABLE IF NOT EXISTS "cb_keys" (
+				token_id varchar NOT NULL REFERENCES tokens (id),
+				cb_key varchar NOT NULL,
+				expires_at timestamptz,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (token_id, cb_key)
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			// existing tokens' keys
+			stmnt = `INSERT INTO "cb_keys" (token_id, cb_key, created_at)
+				SELECT id, cb_key, created_at FROM "tokens"`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Create notif_attempts table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `CREATE TABLE IF NOT EXISTS "notif_attempts" (
+				id bigserial PRIMARY KEY,
+				notif_id varchar NOT NULL REFERENCES notifications (id),
+				attempt_no int NOT NULL,
+				url varchar NOT NULL,
+				response_status int NOT NULL,
+				latency_ms bigint NOT NULL,
+				response_body text NOT NULL,
+				error text NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE INDEX IF NOT EXISTS notif_attempts_notif_id_idx 
+				ON "notif_attempts" (notif_id)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Convert timestamp columns to timestamptz",
+		Func: func(tx *sql.Tx) error {
+			// The attempts use timestamptz, the baseline
+			// tables are converted so that they match
+			stmnts := []string{
+				`ALTER TABLE "tokens" 
+					ALTER COLUMN created_at TYPE timestamptz`,
+				`ALTER TABLE "callbacks" 
+					ALTER COLUMN updated_at TYPE timestamptz,
+					ALTER COLUMN created_at TYPE timestamptz`,
+				`ALTER TABLE "notifications" 
+					ALTER COLUMN updated_at TYPE timestamptz,
+					ALTER COLUMN created_at TYPE timestamptz`,
+				`ALTER TABLE "idemp_keys" 
+					ALTER COLUMN created_at TYPE timestamptz`,
+			}
+			for _, stmnt := range stmnts {
+				if _, err := tx.Exec(stmnt); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add retry_config to callbacks table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "callbacks" ADD COLUMN IF NOT EXISTS retry_config jsonb`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add accepted_statuses to callbacks table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "callbacks" ADD COLUMN IF NOT EXISTS accepted_statuses jsonb`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Create dead_letters table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `CREATE TABLE IF NOT EXISTS "dead_letters" (
+				id varchar PRIMARY KEY,
+				notif_id varchar NOT NULL,
+				dest_token_id varchar NOT NULL,
+				cb_type varchar NOT NULL,
+				reason text NOT NULL,
+				body bytea NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE INDEX IF NOT EXISTS dead_letters_created_at_idx 
+				ON "dead_letters" (created_at)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add breaker columns to callbacks table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "callbacks" 
+				ADD COLUMN IF NOT EXISTS breaker_state varchar NOT NULL DEFAULT 'CLOSED',
+				ADD COLUMN IF NOT EXISTS breaker_failures int NOT NULL DEFAULT 0,
+				ADD COLUMN IF NOT EXISTS breaker_failing_since timestamptz,
+				ADD COLUMN IF NOT EXISTS breaker_next_probe_at timestamptz,
+				ADD COLUMN IF NOT EXISTS disabled_at timestamptz`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add rate_limit to callbacks table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "callbacks" ADD COLUMN IF NOT EXISTS rate_limit jsonb`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add ordering columns to notifications table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "notifications" 
+				ADD COLUMN IF NOT EXISTS ordering_key varchar NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS seq bigserial`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE INDEX IF NOT EXISTS notifications_ordering_idx 
+				ON "notifications" (dest_token_id, ordering_key, cb_type, seq)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `ALTER TABLE "callbacks" 
+				ADD COLUMN IF NOT EXISTS ordered boolean NOT NULL DEFAULT false`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add deliver_at to notifications table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "notifications" 
+				ADD COLUMN IF NOT EXISTS deliver_at timestamptz`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE INDEX IF NOT EXISTS notifications_scheduled_idx 
+				ON "notifications" (deliver_at) WHERE status = 'SCHEDULED'`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add expires_at to notifications table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "notifications" 
+				ADD COLUMN IF NOT EXISTS expires_at timestamptz`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Create deliveries table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `CREATE TABLE IF NOT EXISTS "deliveries" (
+				id varchar PRIMARY KEY,
+				notif_id varchar NOT NULL REFERENCES notifications (id),
+				callback_id varchar NOT NULL REFERENCES callbacks (id),
+				status varchar NOT NULL,
+				updated_at timestamptz,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				UNIQUE (notif_id, callback_id)
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `ALTER TABLE "notif_attempts" 
+				ADD COLUMN IF NOT EXISTS delivery_id varchar REFERENCES deliveries (id)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Create token_grants and events tables",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `CREATE TABLE IF NOT EXISTS "token_grants" (
+				token_id varchar NOT NULL REFERENCES tokens (id),
+				publisher_id varchar NOT NULL REFERENCES tokens (id),
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (token_id, publisher_id)
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE INDEX IF NOT EXISTS token_grants_publisher_idx 
+				ON "token_grants" (publisher_id)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE TABLE IF NOT EXISTS "events" (
+				id varchar PRIMARY KEY,
+				src_token_id varchar NOT NULL REFERENCES tokens (id),
+				cb_type varchar NOT NULL,
+				payload jsonb NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `ALTER TABLE "notifications" 
+				ADD COLUMN IF NOT EXISTS event_id varchar REFERENCES events (id)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE INDEX IF NOT EXISTS notifications_event_idx 
+				ON "notifications" (event_id) WHERE event_id IS NOT NULL`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add filter to callbacks table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "callbacks" 
+				ADD COLUMN IF NOT EXISTS filter varchar NOT NULL DEFAULT ''`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add template to callbacks table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "callbacks" 
+				ADD COLUMN IF NOT EXISTS template text NOT NULL DEFAULT ''`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Create event types table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `CREATE TABLE IF NOT EXISTS "event_types" (
+				name varchar PRIMARY KEY,
+				token_id varchar NOT NULL REFERENCES tokens(id),
+				description text NOT NULL DEFAULT '',
+				schema jsonb,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Create event type versions table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "event_types" 
+				ADD COLUMN IF NOT EXISTS version int NOT NULL DEFAULT 1`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE TABLE IF NOT EXISTS "event_type_versions" (
+				event_type varchar NOT NULL REFERENCES event_types(name),
+				version int NOT NULL,
+				schema jsonb,
+				upcast jsonb,
+				downcast jsonb,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (event_type, version)
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			// the registered schemas are the first versions
+			stmnt = `INSERT INTO "event_type_versions" (event_type, version, schema) 
+				SELECT name, 1, schema FROM "event_types" 
+				ON CONFLICT DO NOTHING`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `ALTER TABLE "notifications" 
+				ADD COLUMN IF NOT EXISTS event_version int NOT NULL DEFAULT 0`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `ALTER TABLE "callbacks" 
+				ADD COLUMN IF NOT EXISTS event_version int NOT NULL DEFAULT 0`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+
+	&migrator.Migration{
+		Name: "Add delivery channel to callbacks table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `ALTER TABLE "callbacks" 
+				ADD COLUMN IF NOT EXISTS channel varchar NOT NULL DEFAULT 'webhook'`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `ALTER TABLE "callbacks" 
+				ADD COLUMN IF NOT EXISTS channel_config jsonb`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+
+	&migrator.Migration{
+		Name: "Create inbox items table",
+		Func: func(tx *sql.Tx) error {
+			// The body is stored as is, jsonb would
+			// normalize it and break the signatures
+			stmnt := `CREATE TABLE IF NOT EXISTS "inbox_items" (
+				id varchar PRIMARY KEY,
+				seq bigserial NOT NULL UNIQUE,
+				token_id varchar NOT NULL REFERENCES tokens (id),
+				delivery_id varchar NOT NULL,
+				cb_type varchar NOT NULL,
+				channel varchar NOT NULL,
+				body bytea NOT NULL,
+				headers jsonb,
+				receives int NOT NULL DEFAULT 0,
+				visible_at timestamptz NOT NULL DEFAULT NOW(),
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				UNIQUE (token_id, delivery_id)
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE INDEX IF NOT EXISTS inbox_items_token_id_channel_seq_idx 
+				ON "inbox_items" (token_id, channel, seq)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Create stream tickets table",
+		Func: func(tx *sql.Tx) error {
+			stmnt := `CREATE TABLE IF NOT EXISTS "stream_tickets" (
+				id varchar PRIMARY KEY,
+				token_id varchar NOT NULL REFERENCES tokens (id),
+				expires_at timestamptz NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			stmnt = `CREATE INDEX IF NOT EXISTS stream_tickets_token_id_idx 
+				ON "stream_tickets" (token_id)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
+			return nil
+		},
+	},
+	&migrator.Migration{
+		Name: "Add unique index to callbacks table",
+		Func: func(tx *sql.Tx) error {
+			// An endpoint subscribes to a callback type once
+			stmnt := `CREATE UNIQUE INDEX IF NOT EXISTS callbacks_endpoint_key
+				ON "callbacks" (token_id, cb_type, channel, cb_url)`
+			if _, err := tx.Exec(stmnt); err != nil {
+				return err
+			}
+
 			return nil
 		},
 	},
@@ -4,8 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/callback"
 	"github.com/stevenferrer/notifi/notif"
 )
 
@@ -17,17 +21,28 @@ func NewNotifRepository(db *sql.DB) *NotifRepository {
 	return &NotifRepository{db: db}
 }
 
+// notifColumns are the columns scanned by scanNotif
+const notifColumns = `id, src_token_id, dest_token_id, cb_type, 
+	status, payload, ordering_key, seq, deliver_at, expires_at, 
+	coalesce(event_id, ''), event_version`
+
 func (repo *NotifRepository) CreateNotif(ctx context.Context, nf notif.Notif) error {
+	return createNotif(ctx, repo.db, nf)
+}
+
+func createNotif(ctx context.Context, db execer, nf notif.Notif) error {
 	payload, err := json.Marshal(nf.Payload)
 	if err != nil {
 		return errors.Wrap(err, "marshal payload")
 	}
 
-	stmnt := `insert into notifications (id, src_token_id, 
-			dest_token_id, cb_type, status, payload)
-		values ($1, $2, $3, $4, $5, $6)`
-	_, err = repo.db.ExecContext(ctx, stmnt, nf.ID, nf.SrcTokenID,
-		nf.DestTokenID, nf.CBType, nf.Status, payload)
+	stmnt := `insert into notifications (id, src_token_id, dest_token_id, 
+			cb_type, status, payload, ordering_key, deliver_at, expires_at, 
+			event_id, event_version)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, nullif($10, ''), $11)`
+	_, err = db.ExecContext(ctx, stmnt, nf.ID, nf.SrcTokenID,
+		nf.DestTokenID, nf.CBType, nf.Status, payload, nf.OrderingKey,
+		nf.DeliverAt, nf.ExpiresAt, nf.EventID, nf.EventVersion)
 	if err != nil {
 		return errors.Wrap(err, "exec context")
 	}
@@ -35,16 +50,98 @@ func (repo *NotifRepository) CreateNotif(ctx context.Context, nf notif.Notif) er
 	return nil
 }
 
-func (repo *NotifRepository) GetNotif(ctx context.Context, notifID notif.ID) (*notif.Notif, error) {
-	stmnt := `select id, src_token_id, dest_token_id, cb_type, 
-		status, payload from notifications where id=$1`
+func (repo *NotifRepository) CreateEvent(ctx context.Context,
+	event notif.Event, nfs []notif.Notif) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return errors.Wrap(err, "marshal payload")
+	}
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	stmnt := `insert into events (id, src_token_id, cb_type, payload) 
+		values ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, stmnt, event.ID, event.SrcTokenID,
+		event.CBType, payload)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	for _, nf := range nfs {
+		err = createNotif(ctx, tx, nf)
+		if err != nil {
+			return errors.Wrap(err, "create notif")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit tx")
+	}
+
+	return nil
+}
+
+func (repo *NotifRepository) GetEvent(ctx context.Context,
+	eventID notif.EventID) (*notif.Event, error) {
+	stmnt := `select id, src_token_id, cb_type, payload, created_at 
+		from events where id=$1`
 	var (
-		nf      notif.Notif
+		event   notif.Event
 		payload []byte
 	)
-	err := repo.db.QueryRowContext(ctx, stmnt, notifID).
-		Scan(&nf.ID, &nf.SrcTokenID, &nf.DestTokenID,
-			&nf.CBType, &nf.Status, &payload)
+	err := repo.db.QueryRowContext(ctx, stmnt, eventID).Scan(&event.ID,
+		&event.SrcTokenID, &event.CBType, &payload, &event.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notif.ErrEventNotFound
+		}
+
+		return nil, errors.Wrap(err, "query row context")
+	}
+
+	err = json.Unmarshal(payload, &event.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal payload")
+	}
+
+	return &event, nil
+}
+
+func (repo *NotifRepository) ListNotifsByEventID(ctx context.Context,
+	eventID notif.EventID) ([]notif.Notif, error) {
+	stmnt := `select ` + notifColumns + ` from notifications 
+		where event_id=$1 order by seq`
+	rows, err := repo.db.QueryContext(ctx, stmnt, eventID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	nfs := []notif.Notif{}
+	for rows.Next() {
+		nf, err := scanNotif(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		nfs = append(nfs, *nf)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return nfs, nil
+}
+
+func (repo *NotifRepository) GetNotif(ctx context.Context, notifID notif.ID) (*notif.Notif, error) {
+	stmnt := `select ` + notifColumns + ` from notifications where id=$1`
+	nf, err := scanNotif(repo.db.QueryRowContext(ctx, stmnt, notifID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, notif.ErrNotifNotFound
@@ -53,6 +150,21 @@ func (repo *NotifRepository) GetNotif(ctx context.Context, notifID notif.ID) (*n
 		return nil, errors.Wrap(err, "query row context")
 	}
 
+	return nf, nil
+}
+
+func scanNotif(row scanner) (*notif.Notif, error) {
+	var (
+		nf      notif.Notif
+		payload []byte
+	)
+	err := row.Scan(&nf.ID, &nf.SrcTokenID, &nf.DestTokenID,
+		&nf.CBType, &nf.Status, &payload, &nf.OrderingKey,
+		&nf.Seq, &nf.DeliverAt, &nf.ExpiresAt, &nf.EventID, &nf.EventVersion)
+	if err != nil {
+		return nil, err
+	}
+
 	err = json.Unmarshal(payload, &nf.Payload)
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshal payload")
@@ -77,12 +189,398 @@ func (repo *NotifRepository) UpdateStatus(ctx context.Context,
 		return nil
 	}
 
-	stmnt := `update notifications set status=$1, 
-		updated_at=NOW() where id=$2`
-	_, err = repo.db.ExecContext(ctx, stmnt, status, notifID)
+	// Final statuses can only be reset to pending when resending
+	stmnt := `update notifications set status=$1, updated_at=NOW() 
+		where id=$2 and (status <> all($3) or $1=$4)`
+	_, err = repo.db.ExecContext(ctx, stmnt, status, notifID,
+		pq.Array(finalStatuses()), notif.StatusPending)
 	if err != nil {
 		return errors.Wrap(err, "exec context")
 	}
 
 	return nil
 }
+
+func (repo *NotifRepository) HasPendingPredecessor(ctx context.Context,
+	nf notif.Notif, cbID callback.ID) (bool, error) {
+	// notifications with ordering key are ordered across callback types.
+	// The earlier notifications that are not fanned out yet block all the
+	// callbacks, otherwise only the delivery to the callback is waited for.
+	// The scheduled notifications that are not due yet don't block.
+	stmnt := `select exists(select 1 from notifications n 
+		where n.dest_token_id=$1 and n.ordering_key=$2 and n.seq<$3 
+			and n.status <> all($4) and ($2<>'' or n.cb_type=$5) 
+			and not (n.status=$7 and n.deliver_at > NOW()) 
+			and (not exists(select 1 from deliveries d where d.notif_id=n.id) 
+				or exists(select 1 from deliveries d where d.notif_id=n.id 
+					and d.callback_id=$6 and d.status <> all($4))))`
+	var exists bool
+	err := repo.db.QueryRowContext(ctx, stmnt, nf.DestTokenID, nf.OrderingKey,
+		nf.Seq, pq.Array(finalStatuses()), nf.CBType, cbID,
+		notif.StatusScheduled).Scan(&exists)
+	if err != nil {
+		return false, errors.Wrap(err, "query row context")
+	}
+
+	return exists, nil
+}
+
+// finalStatuses returns the final statuses for use in queries
+func finalStatuses() []string {
+	statuses := make([]string, 0, len(notif.FinalStatuses))
+	for _, status := range notif.FinalStatuses {
+		statuses = append(statuses, string(status))
+	}
+
+	return statuses
+}
+
+func (repo *NotifRepository) CreateDeliveries(ctx context.Context,
+	notifID notif.ID, deliveries []notif.Delivery) ([]notif.Delivery, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	// the deliveries already exist if the fan out is retried
+	stmnt := `insert into deliveries (id, notif_id, callback_id, status) 
+		values ($1, $2, $3, $4) on conflict (notif_id, callback_id) do nothing`
+	cbIDs := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		_, err = tx.ExecContext(ctx, stmnt, delivery.ID,
+			notifID, delivery.CallbackID, delivery.Status)
+		if err != nil {
+			return nil, errors.Wrap(err, "exec context")
+		}
+
+		cbIDs = append(cbIDs, string(delivery.CallbackID))
+	}
+
+	stmnt = `select ` + deliveryColumns + ` from deliveries 
+		where notif_id=$1 and callback_id = any($2) order by created_at, id`
+	rows, err := tx.QueryContext(ctx, stmnt, notifID, pq.Array(cbIDs))
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+
+	deliveries, err = scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// all the deliveries might be skipped
+	err = updateAggregateStatus(ctx, tx, notifID)
+	if err != nil {
+		return nil, errors.Wrap(err, "update aggregate status")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "commit tx")
+	}
+
+	return deliveries, nil
+}
+
+func (repo *NotifRepository) ListDeliveries(ctx context.Context,
+	notifID notif.ID) ([]notif.Delivery, error) {
+	stmnt := `select ` + deliveryColumns + ` from deliveries 
+		where notif_id=$1 order by created_at, id`
+	rows, err := repo.db.QueryContext(ctx, stmnt, notifID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+
+	return scanDeliveries(rows)
+}
+
+func (repo *NotifRepository) GetDelivery(ctx context.Context,
+	deliveryID notif.DeliveryID) (*notif.Delivery, error) {
+	stmnt := `select ` + deliveryColumns + ` from deliveries where id=$1`
+	var delivery notif.Delivery
+	err := repo.db.QueryRowContext(ctx, stmnt, deliveryID).Scan(&delivery.ID,
+		&delivery.NotifID, &delivery.CallbackID, &delivery.Status, &delivery.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notif.ErrDeliveryNotFound
+		}
+
+		return nil, errors.Wrap(err, "query row context")
+	}
+
+	return &delivery, nil
+}
+
+// deliveryColumns are the columns scanned by scanDeliveries
+const deliveryColumns = `id, notif_id, callback_id, status, created_at`
+
+func scanDeliveries(rows *sql.Rows) ([]notif.Delivery, error) {
+	defer rows.Close()
+
+	deliveries := []notif.Delivery{}
+	for rows.Next() {
+		var delivery notif.Delivery
+		err := rows.Scan(&delivery.ID, &delivery.NotifID,
+			&delivery.CallbackID, &delivery.Status, &delivery.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return deliveries, nil
+}
+
+func (repo *NotifRepository) UpdateDeliveryStatus(ctx context.Context,
+	deliveryID notif.DeliveryID, status notif.Status) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	// Final statuses can only be reset to pending when resending
+	var notifID notif.ID
+	stmnt := `update deliveries set status=$1, updated_at=NOW() 
+		where id=$2 and (status <> all($3) or $1=$4) returning notif_id`
+	err = tx.QueryRowContext(ctx, stmnt, status, deliveryID,
+		pq.Array(finalStatuses()), notif.StatusPending).Scan(&notifID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return errors.Wrap(err, "query row context")
+		}
+
+		// either the delivery doesn't exist or it's already final
+		var exists bool
+		stmnt = `select exists(select 1 from deliveries where id=$1)`
+		err = tx.QueryRowContext(ctx, stmnt, deliveryID).Scan(&exists)
+		if err != nil {
+			return errors.Wrap(err, "query row context")
+		}
+
+		if !exists {
+			return notif.ErrDeliveryNotFound
+		}
+
+		return nil
+	}
+
+	err = updateAggregateStatus(ctx, tx, notifID)
+	if err != nil {
+		return errors.Wrap(err, "update aggregate status")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit tx")
+	}
+
+	return nil
+}
+
+// updateAggregateStatus updates the notification status to the aggregate of
+// the delivery statuses, the notification is locked so that the concurrent
+// deliveries don't overwrite each other's aggregate
+func updateAggregateStatus(ctx context.Context, tx *sql.Tx, notifID notif.ID) error {
+	stmnt := `select id from notifications where id=$1 for update`
+	_, err := tx.ExecContext(ctx, stmnt, notifID)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	stmnt = `select status from deliveries where notif_id=$1`
+	rows, err := tx.QueryContext(ctx, stmnt, notifID)
+	if err != nil {
+		return errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	statuses := []notif.Status{}
+	for rows.Next() {
+		var status notif.Status
+		err = rows.Scan(&status)
+		if err != nil {
+			return errors.Wrap(err, "scan")
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	if err = rows.Err(); err != nil {
+		return errors.Wrap(err, "rows err")
+	}
+
+	stmnt = `update notifications set status=$1, updated_at=NOW() 
+		where id=$2 and status<>$1`
+	_, err = tx.ExecContext(ctx, stmnt, notif.AggregateStatus(statuses), notifID)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	return nil
+}
+
+func (repo *NotifRepository) CancelScheduled(ctx context.Context, notifID notif.ID) error {
+	stmnt := `update notifications set status=$1, updated_at=NOW() 
+		where id=$2 and status=$3`
+	result, err := repo.db.ExecContext(ctx, stmnt, notif.StatusCancelled,
+		notifID, notif.StatusScheduled)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+
+	if affected == 0 {
+		// either the notification doesn't exist or it's not scheduled
+		_, err = repo.GetNotif(ctx, notifID)
+		if err != nil {
+			if err == notif.ErrNotifNotFound {
+				return err
+			}
+
+			return errors.Wrap(err, "get notif")
+		}
+
+		return notif.ErrNotifNotScheduled
+	}
+
+	return nil
+}
+
+func (repo *NotifRepository) DispatchScheduled(ctx context.Context, now time.Time,
+	limit int, dispatch func(notif.Notif) error) (int, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	// lock the due notifications so that they can't be cancelled
+	// or dispatched by the other schedulers in the meantime
+	stmnt := `select ` + notifColumns + ` from notifications 
+		where status=$1 and deliver_at<=$2 
+		order by deliver_at, seq limit $3 
+		for update skip locked`
+	rows, err := tx.QueryContext(ctx, stmnt, notif.StatusScheduled, now, limit)
+	if err != nil {
+		return 0, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	notifs := []notif.Notif{}
+	for rows.Next() {
+		nf, err := scanNotif(rows)
+		if err != nil {
+			return 0, errors.Wrap(err, "scan")
+		}
+
+		notifs = append(notifs, *nf)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, errors.Wrap(err, "rows err")
+	}
+
+	if len(notifs) == 0 {
+		return 0, nil
+	}
+
+	// The notifications are marked as pending before they're dispatched
+	// so that a failed commit can't dispatch them again on the next tick
+	notifIDs := make([]string, 0, len(notifs))
+	for _, nf := range notifs {
+		notifIDs = append(notifIDs, string(nf.ID))
+	}
+
+	stmnt = `update notifications set status=$1, updated_at=NOW() 
+		where id = any($2)`
+	_, err = tx.ExecContext(ctx, stmnt, notif.StatusPending, pq.Array(notifIDs))
+	if err != nil {
+		return 0, errors.Wrap(err, "exec context")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrap(err, "commit tx")
+	}
+
+	// dispatch until the first error, the rest are scheduled again
+	for i, nf := range notifs {
+		dispatchErr := dispatch(nf)
+		if dispatchErr == nil {
+			continue
+		}
+
+		stmnt = `update notifications set status=$1, updated_at=NOW() 
+			where id = any($2) and status=$3`
+		_, err = repo.db.ExecContext(ctx, stmnt, notif.StatusScheduled,
+			pq.Array(notifIDs[i:]), notif.StatusPending)
+		if err != nil {
+			return i, errors.Wrap(err, "exec context")
+		}
+
+		return i, errors.Wrap(dispatchErr, "dispatch")
+	}
+
+	return len(notifs), nil
+}
+
+func (repo *NotifRepository) CreateAttempt(ctx context.Context, attempt notif.Attempt) error {
+	stmnt := `insert into notif_attempts (notif_id, delivery_id, attempt_no, 
+			url, response_status, latency_ms, response_body, error)
+		values ($1, nullif($2, ''), $3, $4, $5, $6, $7, $8)`
+	_, err := repo.db.ExecContext(ctx, stmnt, attempt.NotifID, attempt.DeliveryID,
+		attempt.AttemptNo, attempt.URL, attempt.ResponseStatus, attempt.Latency.Milliseconds(),
+		attempt.ResponseBody, attempt.Error)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	return nil
+}
+
+func (repo *NotifRepository) ListAttempts(ctx context.Context,
+	notifID notif.ID) ([]notif.Attempt, error) {
+	stmnt := `select notif_id, coalesce(delivery_id, ''), attempt_no, url, 
+			response_status, latency_ms, response_body, error, created_at 
+		from notif_attempts where notif_id=$1 order by id`
+	rows, err := repo.db.QueryContext(ctx, stmnt, notifID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	attempts := []notif.Attempt{}
+	for rows.Next() {
+		var (
+			attempt   notif.Attempt
+			latencyMs int64
+		)
+		err = rows.Scan(&attempt.NotifID, &attempt.DeliveryID,
+			&attempt.AttemptNo, &attempt.URL,
+			&attempt.ResponseStatus, &latencyMs, &attempt.ResponseBody,
+			&attempt.Error, &attempt.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		attempt.Latency = time.Duration(latencyMs) * time.Millisecond
+		attempts = append(attempts, attempt)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return attempts, nil
+}
@@ -3,6 +3,7 @@ package postgres_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -80,4 +81,252 @@ func TestNotifRepository(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, notif.StatusFailed, gotNf.Status)
+
+	// create attempts
+	attempts := []notif.Attempt{
+		{
+			NotifID:        nf.ID,
+			AttemptNo:      1,
+			URL:            cb.URL,
+			ResponseStatus: 500,
+			Latency:        120 * time.Millisecond,
+			ResponseBody:   "internal server error",
+			Error:          "expecting status 200 but got 500",
+		},
+		{
+			NotifID:        nf.ID,
+			AttemptNo:      2,
+			URL:            cb.URL,
+			ResponseStatus: 200,
+			Latency:        80 * time.Millisecond,
+		},
+	}
+	for _, attempt := range attempts {
+		err = notifRepo.CreateAttempt(ctx, attempt)
+		require.NoError(t, err)
+	}
+
+	// list attempts
+	gotAttempts, err := notifRepo.ListAttempts(ctx, nf.ID)
+	require.NoError(t, err)
+	require.Len(t, gotAttempts, len(attempts))
+
+	for i, attempt := range attempts {
+		assert.Equal(t, attempt.NotifID, gotAttempts[i].NotifID)
+		assert.Equal(t, attempt.AttemptNo, gotAttempts[i].AttemptNo)
+		assert.Equal(t, attempt.URL, gotAttempts[i].URL)
+		assert.Equal(t, attempt.ResponseStatus, gotAttempts[i].ResponseStatus)
+		assert.Equal(t, attempt.Latency, gotAttempts[i].Latency)
+		assert.Equal(t, attempt.ResponseBody, gotAttempts[i].ResponseBody)
+		assert.Equal(t, attempt.Error, gotAttempts[i].Error)
+		assert.NotZero(t, gotAttempts[i].CreatedAt)
+	}
+
+	t.Run("ordering", func(t *testing.T) {
+		newNotif := func(cbType callback.CBType, orderingKey string) notif.Notif {
+			nf := notif.Notif{
+				ID:          notif.NewID(),
+				SrcTokenID:  tk.ID,
+				DestTokenID: tk.ID,
+				CBType:      cbType,
+				Status:      notif.StatusPending,
+				Payload:     map[string]interface{}{},
+				OrderingKey: orderingKey,
+			}
+			err := notifRepo.CreateNotif(ctx, nf)
+			require.NoError(t, err)
+
+			gotNf, err := notifRepo.GetNotif(ctx, nf.ID)
+			require.NoError(t, err)
+			assert.Equal(t, orderingKey, gotNf.OrderingKey)
+			assert.NotZero(t, gotNf.Seq)
+
+			return *gotNf
+		}
+
+		nf1 := newNotif("ORDERED", "")
+		nf2 := newNotif("ORDERED", "")
+		nf3 := newNotif("OTHER", "")
+
+		blocked, err := notifRepo.HasPendingPredecessor(ctx, nf1, cb.ID)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+
+		blocked, err = notifRepo.HasPendingPredecessor(ctx, nf2, cb.ID)
+		require.NoError(t, err)
+		assert.True(t, blocked)
+
+		// other callback types are not affected
+		blocked, err = notifRepo.HasPendingPredecessor(ctx, nf3, cb.ID)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+
+		// done processing
+		err = notifRepo.UpdateStatus(ctx, nf1.ID, notif.StatusDead)
+		require.NoError(t, err)
+
+		blocked, err = notifRepo.HasPendingPredecessor(ctx, nf2, cb.ID)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+
+		// ordering key spans callback types
+		nf4 := newNotif("CREATED", "invoice-1")
+		nf5 := newNotif("PAID", "invoice-1")
+		nf6 := newNotif("PAID", "invoice-2")
+
+		blocked, err = notifRepo.HasPendingPredecessor(ctx, nf5, cb.ID)
+		require.NoError(t, err)
+		assert.True(t, blocked)
+
+		blocked, err = notifRepo.HasPendingPredecessor(ctx, nf6, cb.ID)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+
+		err = notifRepo.UpdateStatus(ctx, nf4.ID, notif.StatusComplete)
+		require.NoError(t, err)
+
+		blocked, err = notifRepo.HasPendingPredecessor(ctx, nf5, cb.ID)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+
+		// scheduled notifications that are not due yet don't block
+		deliverAt := time.Now().Add(time.Hour)
+		err = notifRepo.CreateNotif(ctx, notif.Notif{
+			ID:          notif.NewID(),
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      "CREATED",
+			Status:      notif.StatusScheduled,
+			Payload:     map[string]interface{}{},
+			OrderingKey: "invoice-3",
+			DeliverAt:   &deliverAt,
+		})
+		require.NoError(t, err)
+
+		nf7 := newNotif("PAID", "invoice-3")
+		blocked, err = notifRepo.HasPendingPredecessor(ctx, nf7, cb.ID)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+	})
+
+	t.Run("deliveries", func(t *testing.T) {
+		cb2 := callback.Callback{
+			ID:      callback.NewID(),
+			TokenID: tk.ID,
+			CBType:  cb.CBType,
+			URL:     "https://example.org",
+		}
+		err := callbackRepo.CreateCallback(ctx, cb2)
+		require.NoError(t, err)
+
+		nf := notif.Notif{
+			ID:          notif.NewID(),
+			SrcTokenID:  tk.ID,
+			DestTokenID: tk.ID,
+			CBType:      cb.CBType,
+			Status:      notif.StatusPending,
+			Payload:     map[string]interface{}{},
+			OrderingKey: "fan-out",
+		}
+		err = notifRepo.CreateNotif(ctx, nf)
+		require.NoError(t, err)
+
+		newDeliveries := func() []notif.Delivery {
+			return []notif.Delivery{
+				{ID: notif.NewDeliveryID(), CallbackID: cb.ID, Status: notif.StatusPending},
+				{ID: notif.NewDeliveryID(), CallbackID: cb2.ID, Status: notif.StatusPending},
+			}
+		}
+
+		deliveries, err := notifRepo.CreateDeliveries(ctx, nf.ID, newDeliveries())
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+
+		// creating the deliveries again returns the existing ones
+		gotDeliveries, err := notifRepo.CreateDeliveries(ctx, nf.ID, newDeliveries())
+		require.NoError(t, err)
+		assert.Equal(t, deliveries, gotDeliveries)
+
+		gotDeliveries, err = notifRepo.ListDeliveries(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, deliveries, gotDeliveries)
+
+		// later notification with the same ordering key
+		nf2 := nf
+		nf2.ID = notif.NewID()
+		err = notifRepo.CreateNotif(ctx, nf2)
+		require.NoError(t, err)
+
+		gotNf2, err := notifRepo.GetNotif(ctx, nf2.ID)
+		require.NoError(t, err)
+
+		// notification status is the aggregate of the delivery statuses
+		var cb1Delivery, cb2Delivery notif.Delivery
+		for _, delivery := range deliveries {
+			assert.Equal(t, notif.StatusPending, delivery.Status)
+			if delivery.CallbackID == cb.ID {
+				cb1Delivery = delivery
+			} else {
+				cb2Delivery = delivery
+			}
+		}
+
+		err = notifRepo.UpdateDeliveryStatus(ctx, cb1Delivery.ID, notif.StatusComplete)
+		require.NoError(t, err)
+
+		gotNf, err := notifRepo.GetNotif(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusPending, gotNf.Status)
+
+		// only the pending callback is blocked
+		blocked, err := notifRepo.HasPendingPredecessor(ctx, *gotNf2, cb.ID)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+
+		blocked, err = notifRepo.HasPendingPredecessor(ctx, *gotNf2, cb2.ID)
+		require.NoError(t, err)
+		assert.True(t, blocked)
+
+		err = notifRepo.UpdateDeliveryStatus(ctx, cb2Delivery.ID, notif.StatusDead)
+		require.NoError(t, err)
+
+		gotNf, err = notifRepo.GetNotif(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusPartial, gotNf.Status)
+
+		// final statuses are not overwritten
+		err = notifRepo.UpdateDeliveryStatus(ctx, cb1Delivery.ID, notif.StatusExpired)
+		require.NoError(t, err)
+
+		gotNf, err = notifRepo.GetNotif(ctx, nf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusPartial, gotNf.Status)
+
+		err = notifRepo.UpdateDeliveryStatus(ctx, notif.NewDeliveryID(), notif.StatusComplete)
+		assert.ErrorIs(t, err, notif.ErrDeliveryNotFound)
+
+		gotDelivery, err := notifRepo.GetDelivery(ctx, cb1Delivery.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusComplete, gotDelivery.Status)
+
+		_, err = notifRepo.GetDelivery(ctx, notif.NewDeliveryID())
+		assert.ErrorIs(t, err, notif.ErrDeliveryNotFound)
+
+		// notification is skipped if all the deliveries are skipped
+		nf3 := nf
+		nf3.ID = notif.NewID()
+		nf3.OrderingKey = ""
+		err = notifRepo.CreateNotif(ctx, nf3)
+		require.NoError(t, err)
+
+		_, err = notifRepo.CreateDeliveries(ctx, nf3.ID, []notif.Delivery{
+			{ID: notif.NewDeliveryID(), CallbackID: cb.ID, Status: notif.StatusSkipped},
+			{ID: notif.NewDeliveryID(), CallbackID: cb2.ID, Status: notif.StatusSkipped},
+		})
+		require.NoError(t, err)
+
+		gotNf, err = notifRepo.GetNotif(ctx, nf3.ID)
+		require.NoError(t, err)
+		assert.Equal(t, notif.StatusSkipped, gotNf.Status)
+	})
 }
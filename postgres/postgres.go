@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the error code of the unique constraint violations
+const uniqueViolation = "23505"
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// marshalNullable marshals v into json, nil and empty values are marshaled into sql null
+func marshalNullable(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+	case reflect.Slice, reflect.Map:
+		if rv.Len() == 0 {
+			return nil, nil
+		}
+	}
+
+	return json.Marshal(v)
+}
+
+// nullableJSON returns the raw json as jsonb, empty values are sql null
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	return []byte(raw)
+}
+
+// isUniqueViolation reports whether the error is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == uniqueViolation
+}
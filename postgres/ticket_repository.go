@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/stream"
+	"github.com/stevenferrer/notifi/token"
+)
+
+type TicketRepository struct{ db *sql.DB }
+
+var _ stream.TicketRepository = (*TicketRepository)(nil)
+
+func NewTicketRepository(db *sql.DB) *TicketRepository {
+	return &TicketRepository{db: db}
+}
+
+func (repo *TicketRepository) CreateTicket(ctx context.Context, ticket stream.Ticket) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	// The unused tickets of the token are removed once they expire
+	stmnt := `delete from stream_tickets where token_id=$1 and expires_at <= NOW()`
+	_, err = tx.ExecContext(ctx, stmnt, ticket.TokenID)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	stmnt = `insert into stream_tickets (id, token_id, expires_at) 
+		values ($1, $2, $3)`
+	_, err = tx.ExecContext(ctx, stmnt, ticket.ID, ticket.TokenID, ticket.ExpiresAt)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	return errors.Wrap(tx.Commit(), "commit tx")
+}
+
+func (repo *TicketRepository) RedeemTicket(ctx context.Context,
+	ticketID stream.TicketID, now time.Time) (token.ID, error) {
+	// The ticket is deleted so that it can't be used again
+	stmnt := `delete from stream_tickets where id=$1 
+		returning token_id, expires_at`
+	var (
+		tokenID   token.ID
+		expiresAt time.Time
+	)
+	err := repo.db.QueryRowContext(ctx, stmnt, ticketID).Scan(&tokenID, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", stream.ErrTicketNotFound
+		}
+
+		return "", errors.Wrap(err, "query row context")
+	}
+
+	if !now.Before(expiresAt) {
+		return "", stream.ErrTicketNotFound
+	}
+
+	return tokenID, nil
+}
@@ -0,0 +1,66 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/stream"
+	"github.com/stevenferrer/notifi/token"
+)
+
+func TestTicketRepository(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	tokenRepo := postgres.NewTokenRepository(db)
+	tokenSvc := token.NewTokenService(tokenRepo)
+	ticketRepo := postgres.NewTicketRepository(db)
+
+	ctx := context.TODO()
+
+	tk, err := tokenSvc.CreateToken(ctx)
+	require.NoError(t, err)
+
+	now := time.Now()
+	newTicket := func() stream.Ticket {
+		ticket := stream.Ticket{
+			ID:        stream.NewTicketID(),
+			TokenID:   tk.ID,
+			ExpiresAt: now.Add(stream.TicketTTL),
+		}
+		err := ticketRepo.CreateTicket(ctx, ticket)
+		require.NoError(t, err)
+		return ticket
+	}
+
+	t.Run("redeem ticket", func(t *testing.T) {
+		ticket := newTicket()
+		tokenID, err := ticketRepo.RedeemTicket(ctx, ticket.ID, now)
+		require.NoError(t, err)
+		assert.Equal(t, tk.ID, tokenID)
+
+		// the tickets can only be redeemed once
+		_, err = ticketRepo.RedeemTicket(ctx, ticket.ID, now)
+		assert.ErrorIs(t, err, stream.ErrTicketNotFound)
+	})
+
+	t.Run("expired ticket", func(t *testing.T) {
+		ticket := newTicket()
+		_, err := ticketRepo.RedeemTicket(ctx, ticket.ID, ticket.ExpiresAt)
+		assert.ErrorIs(t, err, stream.ErrTicketNotFound)
+	})
+
+	t.Run("unknown ticket", func(t *testing.T) {
+		_, err := ticketRepo.RedeemTicket(ctx, stream.NewTicketID(), now)
+		assert.ErrorIs(t, err, stream.ErrTicketNotFound)
+	})
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -20,13 +21,25 @@ func NewTokenRepository(db *sql.DB) *TokenRepository {
 }
 
 func (repo *TokenRepository) CreateToken(ctx context.Context, tk token.Token) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
 	stmnt := `insert into tokens (id, cb_key) values ($1, $2)`
-	_, err := repo.db.ExecContext(ctx, stmnt, tk.ID, tk.CBKey)
+	_, err = tx.ExecContext(ctx, stmnt, tk.ID, tk.CBKey)
 	if err != nil {
 		return errors.Wrap(err, "exec context")
 	}
 
-	return nil
+	stmnt = `insert into cb_keys (token_id, cb_key) values ($1, $2)`
+	_, err = tx.ExecContext(ctx, stmnt, tk.ID, tk.CBKey)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	return errors.Wrap(tx.Commit(), "commit tx")
 }
 
 func (repo *TokenRepository) GetToken(ctx context.Context, tokenID token.ID) (*token.Token, error) {
@@ -42,3 +55,152 @@ func (repo *TokenRepository) GetToken(ctx context.Context, tokenID token.ID) (*t
 
 	return &tk, nil
 }
+
+func (repo *TokenRepository) RotateCBKey(ctx context.Context, tokenID token.ID,
+	cbKey token.CBKey, expiresAt time.Time) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin tx")
+	}
+	defer tx.Rollback()
+
+	// expire the old keys, keys that expire earlier are left as is
+	stmnt := `update cb_keys set expires_at=$2 where token_id=$1 
+		and (expires_at is null or expires_at > $2)`
+	_, err = tx.ExecContext(ctx, stmnt, tokenID, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	stmnt = `insert into cb_keys (token_id, cb_key) values ($1, $2)`
+	_, err = tx.ExecContext(ctx, stmnt, tokenID, cbKey)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	stmnt = `update tokens set cb_key=$2 where id=$1`
+	_, err = tx.ExecContext(ctx, stmnt, tokenID, cbKey)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	return errors.Wrap(tx.Commit(), "commit tx")
+}
+
+func (repo *TokenRepository) GetActiveCBKeys(ctx context.Context,
+	tokenID token.ID) ([]token.Key, error) {
+	stmnt := `select cb_key, created_at, expires_at from cb_keys 
+		where token_id=$1 and (expires_at is null or expires_at > NOW())
+		order by expires_at desc nulls first, created_at desc`
+	rows, err := repo.db.QueryContext(ctx, stmnt, tokenID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	keys := []token.Key{}
+	for rows.Next() {
+		var key token.Key
+		err = rows.Scan(&key.CBKey, &key.CreatedAt, &key.ExpiresAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return keys, nil
+}
+
+func (repo *TokenRepository) CreateGrant(ctx context.Context, grant token.Grant) error {
+	// granting twice is a no-op
+	stmnt := `insert into token_grants (token_id, publisher_id, created_at) 
+		values ($1, $2, $3) on conflict (token_id, publisher_id) do nothing`
+	_, err := repo.db.ExecContext(ctx, stmnt, grant.TokenID,
+		grant.PublisherID, grant.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	return nil
+}
+
+func (repo *TokenRepository) DeleteGrant(ctx context.Context,
+	tokenID, publisherID token.ID) error {
+	stmnt := `delete from token_grants where token_id=$1 and publisher_id=$2`
+	result, err := repo.db.ExecContext(ctx, stmnt, tokenID, publisherID)
+	if err != nil {
+		return errors.Wrap(err, "exec context")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+
+	if affected == 0 {
+		return token.ErrGrantNotFound
+	}
+
+	return nil
+}
+
+func (repo *TokenRepository) ListGrants(ctx context.Context,
+	tokenID token.ID) ([]token.Grant, error) {
+	stmnt := `select token_id, publisher_id, created_at from token_grants 
+		where token_id=$1 order by created_at, publisher_id`
+	rows, err := repo.db.QueryContext(ctx, stmnt, tokenID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	grants := []token.Grant{}
+	for rows.Next() {
+		var grant token.Grant
+		err = rows.Scan(&grant.TokenID, &grant.PublisherID, &grant.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		grants = append(grants, grant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return grants, nil
+}
+
+func (repo *TokenRepository) ListGrantors(ctx context.Context,
+	publisherID token.ID) ([]token.ID, error) {
+	stmnt := `select token_id from token_grants 
+		where publisher_id=$1 order by token_id`
+	rows, err := repo.db.QueryContext(ctx, stmnt, publisherID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query context")
+	}
+	defer rows.Close()
+
+	tokenIDs := []token.ID{}
+	for rows.Next() {
+		var tokenID token.ID
+		err = rows.Scan(&tokenID)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		tokenIDs = append(tokenIDs, tokenID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows err")
+	}
+
+	return tokenIDs, nil
+}
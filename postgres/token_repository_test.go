@@ -3,6 +3,7 @@ package postgres_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -35,4 +36,33 @@ func TestTokenRepository(t *testing.T) {
 
 	assert.Equal(t, tk.ID, gotTk.ID)
 	assert.Equal(t, tk.CBKey, gotTk.CBKey)
+
+	// new token has a single active key
+	keys, err := tokenRepo.GetActiveCBKeys(ctx, tk.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, tk.CBKey, keys[0].CBKey)
+	assert.Nil(t, keys[0].ExpiresAt)
+
+	// rotate key, old key remains active until expiry
+	newCBKey := token.NewCBKey()
+	err = tokenRepo.RotateCBKey(ctx, tk.ID, newCBKey, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	gotTk, err = tokenRepo.GetToken(ctx, tk.ID)
+	require.NoError(t, err)
+	assert.Equal(t, newCBKey, gotTk.CBKey)
+
+	keys, err = tokenRepo.GetActiveCBKeys(ctx, tk.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []token.CBKey{newCBKey, tk.CBKey}, token.CBKeys(keys))
+
+	// rotate and expire the old keys, only the newest key is active
+	newestCBKey := token.NewCBKey()
+	err = tokenRepo.RotateCBKey(ctx, tk.ID, newestCBKey, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	keys, err = tokenRepo.GetActiveCBKeys(ctx, tk.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []token.CBKey{newestCBKey}, token.CBKeys(keys))
 }
@@ -0,0 +1,403 @@
+// Package schema implements a subset of JSON Schema for validating the
+// notification payloads.
+//
+// The supported keywords are type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum and exclusiveMaximum. The
+// boolean schemas true and false are supported. The annotations $schema,
+// title and description are ignored and the other keywords are rejected.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Schema is a parsed json schema
+type Schema struct {
+	// never is set for the false schema
+	never bool
+
+	types                []string
+	enum                 []interface{}
+	constant             interface{}
+	hasConst             bool
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	items                *Schema
+	minItems             *int
+	maxItems             *int
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+}
+
+// rawSchema is the json representation of the schema
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              *string                    `json:"pattern"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+}
+
+// keywords are the keywords allowed in a schema
+var keywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "properties": true,
+	"required": true, "additionalProperties": true, "items": true,
+	"minItems": true, "maxItems": true, "minLength": true, "maxLength": true,
+	"pattern": true, "minimum": true, "maximum": true,
+	"exclusiveMinimum": true, "exclusiveMaximum": true,
+
+	// annotations
+	"$schema": true, "title": true, "description": true,
+}
+
+var validTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+// Parse parses the json schema
+func Parse(b []byte) (*Schema, error) {
+	return parse(b, "#")
+}
+
+func parse(b []byte, path string) (*Schema, error) {
+	// boolean schemas accept or reject everything
+	switch strings.TrimSpace(string(b)) {
+	case "true":
+		return &Schema{}, nil
+	case "false":
+		return &Schema{never: true}, nil
+	}
+
+	// reject the keywords that would be silently ignored
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(b, &fields)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", path)
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !keywords[name] {
+			return nil, errors.Errorf("%s/%s: unsupported keyword", path, name)
+		}
+	}
+
+	var raw rawSchema
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", path)
+	}
+
+	s := &Schema{
+		enum:      raw.Enum,
+		required:  raw.Required,
+		minItems:  raw.MinItems,
+		maxItems:  raw.MaxItems,
+		minLength: raw.MinLength,
+		maxLength: raw.MaxLength,
+		minimum:   raw.Minimum,
+		maximum:   raw.Maximum,
+
+		exclusiveMinimum: raw.ExclusiveMinimum,
+		exclusiveMaximum: raw.ExclusiveMaximum,
+	}
+
+	if raw.Type != nil {
+		s.types, err = parseTypes(raw.Type)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s/type", path)
+		}
+	}
+
+	if raw.Const != nil {
+		s.hasConst = true
+		err = json.Unmarshal(raw.Const, &s.constant)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s/const", path)
+		}
+	}
+
+	if raw.Properties != nil {
+		s.properties = make(map[string]*Schema, len(raw.Properties))
+		for name, b := range raw.Properties {
+			s.properties[name], err = parse(b, path+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if raw.AdditionalProperties != nil {
+		s.additionalProperties, err = parse(raw.AdditionalProperties,
+			path+"/additionalProperties")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if raw.Items != nil {
+		s.items, err = parse(raw.Items, path+"/items")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if raw.Pattern != nil {
+		s.pattern, err = regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s/pattern", path)
+		}
+	}
+
+	return s, nil
+}
+
+func parseTypes(b json.RawMessage) ([]string, error) {
+	var types []string
+	if err := json.Unmarshal(b, &types); err != nil {
+		var typ string
+		if err := json.Unmarshal(b, &typ); err != nil {
+			return nil, errors.New("must be a string or an array of strings")
+		}
+		types = []string{typ}
+	}
+
+	for _, typ := range types {
+		if !validTypes[typ] {
+			return nil, errors.Errorf("unknown type %q", typ)
+		}
+	}
+
+	return types, nil
+}
+
+// Validate validates the value against the schema and returns the
+// validation errors, the value is valid if there are no errors
+func (s *Schema) Validate(v interface{}) []string {
+	return s.validate(normalize(v), "payload", nil)
+}
+
+func (s *Schema) validate(v interface{}, path string, errs []string) []string {
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.never {
+		fail("not allowed")
+		return errs
+	}
+
+	if len(s.types) > 0 && !hasType(s.types, v) {
+		fail("expected %s, got %s", strings.Join(s.types, " or "), typeOf(v))
+		// the other keywords are meaningless for the wrong type
+		return errs
+	}
+
+	if s.enum != nil && !contains(s.enum, v) {
+		fail("must be one of %s", mustJSON(s.enum))
+	}
+
+	if s.hasConst && !reflect.DeepEqual(normalize(s.constant), v) {
+		fail("must be %s", mustJSON(s.constant))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		errs = s.validateObject(v, path, errs)
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+
+		if s.items != nil {
+			for i, item := range v {
+				errs = s.items.validate(item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			fail("must be at least %d characters", *s.minLength)
+		}
+
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("must be at most %d characters", *s.maxLength)
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %q", s.pattern.String())
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+
+		if s.maximum != nil && v > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			fail("must be > %v", *s.exclusiveMinimum)
+		}
+
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			fail("must be < %v", *s.exclusiveMaximum)
+		}
+	}
+
+	return errs
+}
+
+func (s *Schema) validateObject(obj map[string]interface{}, path string, errs []string) []string {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			errs = append(errs, fmt.Sprintf("%s.%s: is required", path, name))
+		}
+	}
+
+	// sort the names so that the errors are in a stable order
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propSchema, ok := s.properties[name]
+		if !ok {
+			propSchema = s.additionalProperties
+		}
+
+		if propSchema != nil {
+			errs = propSchema.validate(obj[name], path+"."+name, errs)
+		}
+	}
+
+	return errs
+}
+
+func hasType(types []string, v interface{}) bool {
+	for _, typ := range types {
+		switch typ {
+		case "integer":
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		default:
+			if typ == typeOf(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return reflect.TypeOf(v).String()
+}
+
+func contains(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(normalize(value), v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalize converts the value into its json decoded form
+// so that the payloads built in code are validated the same
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil, bool, string, float64:
+		return v
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(t))
+		for name, value := range t {
+			normalized[name] = normalize(value)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(t))
+		for i, value := range t {
+			normalized[i] = normalize(value)
+		}
+		return normalized
+	}
+
+	// round trip the other types e.g. ints and structs
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return v
+	}
+
+	return decoded
+}
+
+func mustJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
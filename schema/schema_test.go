@@ -0,0 +1,147 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/schema"
+)
+
+func TestSchema(t *testing.T) {
+	s, err := schema.Parse([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": "object",
+		"required": ["invoice_id", "amount"],
+		"properties": {
+			"invoice_id": {"type": "string", "pattern": "^INV-[0-9]+$"},
+			"amount": {"type": "number", "exclusiveMinimum": 0},
+			"quantity": {"type": "integer", "minimum": 1, "maximum": 10},
+			"currency": {"enum": ["USD", "EUR"]},
+			"kind": {"const": "invoice"},
+			"note": {"type": ["string", "null"], "maxLength": 5},
+			"tags": {"type": "array", "items": {"type": "string", "minLength": 1}, "maxItems": 2}
+		},
+		"additionalProperties": false
+	}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		payload string
+		want    []string
+	}{
+		{
+			name:    "valid",
+			payload: `{"invoice_id": "INV-1", "amount": 10.5, "quantity": 2, "currency": "USD", "kind": "invoice", "note": null, "tags": ["a"]}`,
+		},
+		{
+			name:    "missing required",
+			payload: `{}`,
+			want:    []string{"payload.invoice_id: is required", "payload.amount: is required"},
+		},
+		{
+			name:    "wrong types",
+			payload: `{"invoice_id": 1, "amount": "10", "quantity": 1.5}`,
+			want: []string{
+				"payload.amount: expected number, got string",
+				"payload.invoice_id: expected string, got number",
+				"payload.quantity: expected integer, got number",
+			},
+		},
+		{
+			name:    "constraints",
+			payload: `{"invoice_id": "X-1", "amount": 0, "quantity": 11, "currency": "JPY", "kind": "bill", "note": "too long", "tags": ["", "b", "c"]}`,
+			want: []string{
+				"payload.amount: must be > 0",
+				`payload.currency: must be one of ["USD","EUR"]`,
+				`payload.invoice_id: must match "^INV-[0-9]+$"`,
+				`payload.kind: must be "invoice"`,
+				"payload.note: must be at most 5 characters",
+				"payload.quantity: must be <= 10",
+				"payload.tags: must have at most 2 items",
+				"payload.tags[0]: must be at least 1 characters",
+			},
+		},
+		{
+			name:    "additional property",
+			payload: `{"invoice_id": "INV-1", "amount": 1, "extra": true}`,
+			want:    []string{"payload.extra: not allowed"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			err := json.Unmarshal([]byte(tc.payload), &payload)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, s.Validate(payload))
+		})
+	}
+
+	t.Run("payload built in code", func(t *testing.T) {
+		errs := s.Validate(map[string]interface{}{
+			"invoice_id": "INV-1",
+			"amount":     10,
+			"quantity":   int64(3),
+			"tags":       []string{"a"},
+		})
+		assert.Empty(t, errs)
+	})
+
+	t.Run("empty schema accepts anything", func(t *testing.T) {
+		s, err := schema.Parse([]byte(`{}`))
+		require.NoError(t, err)
+		assert.Empty(t, s.Validate(map[string]interface{}{"a": 1}))
+
+		s, err = schema.Parse([]byte(`true`))
+		require.NoError(t, err)
+		assert.Empty(t, s.Validate(nil))
+	})
+
+	t.Run("invalid schema", func(t *testing.T) {
+		for _, raw := range []string{
+			`[]`,
+			`{"type": "decimal"}`,
+			`{"type": 1}`,
+			`{"properties": {"a": {"pattern": "("}}}`,
+			`{"minLength": "1"}`,
+			`{"items": 1}`,
+		} {
+			_, err := schema.Parse([]byte(raw))
+			assert.Error(t, err, raw)
+		}
+	})
+
+	t.Run("unsupported keyword", func(t *testing.T) {
+		tests := []struct {
+			raw  string
+			want string
+		}{
+			{
+				raw:  `{"type": "string", "format": "email"}`,
+				want: "#/format: unsupported keyword",
+			},
+			{
+				raw:  `{"properties": {"a": {"oneOf": [{"type": "string"}]}}}`,
+				want: "#/properties/a/oneOf: unsupported keyword",
+			},
+			{
+				raw:  `{"type": "array", "items": {"$ref": "#/definitions/item"}}`,
+				want: "#/items/$ref: unsupported keyword",
+			},
+		}
+
+		for _, tc := range tests {
+			_, err := schema.Parse([]byte(tc.raw))
+			assert.EqualError(t, err, tc.want, tc.raw)
+		}
+
+		// annotations are allowed
+		_, err := schema.Parse([]byte(`{"title": "Invoice", "description": "An invoice"}`))
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,70 @@
+// Package signature signs the callback requests
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevenferrer/notifi/token"
+)
+
+const (
+	// TimestampHeader is the header for the unix timestamp of the request
+	TimestampHeader = "X-CALLBACK-TIMESTAMP"
+	// SignatureHeader is the header for the request signatures
+	SignatureHeader = "X-CALLBACK-SIGNATURE"
+	// IdempKeyHeader is the header for the idempotent key of the request
+	IdempKeyHeader = "X-IDEMPOTENT-KEY"
+
+	// version is the signature scheme version
+	version = "v1"
+)
+
+// Sign computes the HMAC-SHA256 signature of the timestamp, idempotent key
+// and body using the callback key. The idempotent key is signed so that the
+// replayed requests can't pass the dedupe of the receivers with a new key.
+func Sign(cbKey token.CBKey, timestamp int64, idempKey string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(cbKey))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(idempKey))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Headers returns the timestamp, idempotent key and signature headers for
+// the body. A signature is added for each of the callback keys.
+func Headers(now time.Time, idempKey string, body []byte, cbKeys ...token.CBKey) map[string]string {
+	timestamp := now.Unix()
+
+	sigs := make([]string, 0, len(cbKeys))
+	for _, cbKey := range cbKeys {
+		sigs = append(sigs, version+"="+Sign(cbKey, timestamp, idempKey, body))
+	}
+
+	return map[string]string{
+		TimestampHeader: strconv.FormatInt(timestamp, 10),
+		SignatureHeader: strings.Join(sigs, ","),
+		IdempKeyHeader:  idempKey,
+	}
+}
+
+// Parse returns the signatures in the signature header
+func Parse(header string) []string {
+	sigs := []string{}
+	for _, part := range strings.Split(header, ",") {
+		v, sig, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || v != version || sig == "" {
+			continue
+		}
+
+		sigs = append(sigs, sig)
+	}
+
+	return sigs
+}
@@ -0,0 +1,49 @@
+package signature_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/signature"
+	"github.com/stevenferrer/notifi/token"
+)
+
+func TestSignature(t *testing.T) {
+	cbKey := token.NewCBKey()
+	body := []byte(`{"message":"hello"}`)
+	now := time.Now()
+
+	headers := signature.Headers(now, "1234", body, cbKey)
+	assert.Equal(t, "1234", headers[signature.IdempKeyHeader])
+
+	timestamp, err := strconv.ParseInt(headers[signature.TimestampHeader], 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, now.Unix(), timestamp)
+
+	sigs := signature.Parse(headers[signature.SignatureHeader])
+	require.Len(t, sigs, 1)
+	assert.Equal(t, signature.Sign(cbKey, timestamp, "1234", body), sigs[0])
+
+	// raw callback key must not be sent
+	assert.NotContains(t, headers[signature.SignatureHeader], string(cbKey))
+
+	// tampered body should produce a different signature
+	assert.NotEqual(t, sigs[0], signature.Sign(cbKey, timestamp, "1234", []byte(`{}`)))
+
+	// different timestamp should produce a different signature
+	assert.NotEqual(t, sigs[0], signature.Sign(cbKey, timestamp+1, "1234", body))
+
+	// different idempotent key should produce a different signature
+	assert.NotEqual(t, sigs[0], signature.Sign(cbKey, timestamp, "5678", body))
+
+	// multiple keys
+	headers = signature.Headers(now, "1234", body, cbKey, token.NewCBKey())
+	assert.Len(t, signature.Parse(headers[signature.SignatureHeader]), 2)
+
+	// unknown versions are ignored
+	assert.Empty(t, signature.Parse("v0=abc, v1="))
+}
@@ -0,0 +1,7 @@
+package stream
+
+import "errors"
+
+var (
+	ErrTicketNotFound = errors.New("ticket not found")
+)
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unrolled/render"
+
+	"github.com/stevenferrer/notifi/channel"
+	"github.com/stevenferrer/notifi/inbox"
+	inboxh "github.com/stevenferrer/notifi/inbox/handler"
+	"github.com/stevenferrer/notifi/notifihttp"
+	"github.com/stevenferrer/notifi/stream"
+	"github.com/stevenferrer/notifi/token"
+)
+
+// DefaultPollInterval is how often the streams check the inbox for the
+// redelivered items and the items stored by the other instances
+const DefaultPollInterval = 5 * time.Second
+
+type streamHandler struct {
+	inboxSvc     inbox.Service
+	streamSvc    stream.Service
+	hub          *stream.Hub
+	pollInterval time.Duration
+	mux          *chi.Mux
+	render       *render.Render
+	logger       zerolog.Logger
+}
+
+// NewStreamHandler returns the handler for streaming the stream items
+// through server-sent events. The streamed items are acked the same
+// way as the inbox items, the unacked items are streamed again
+// after the visibility timeout. The browsers connect with a stream
+// ticket since they can't set the api key header, see NewTicketMw.
+func NewStreamHandler(inboxSvc inbox.Service, streamSvc stream.Service,
+	hub *stream.Hub, pollInterval time.Duration, logger zerolog.Logger) http.Handler {
+	sh := &streamHandler{
+		inboxSvc:     inboxSvc,
+		streamSvc:    streamSvc,
+		hub:          hub,
+		pollInterval: pollInterval,
+		mux:          chi.NewMux(),
+		render:       render.New(),
+		logger:       logger,
+	}
+
+	// helper for adding http route
+	addRoute := func(method, pattern string, h notifihttp.Handler) {
+		sh.mux.Method(method, pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := h.ServeHTTP(w, r)
+			if err != nil {
+				inboxh.HandleError(w, err, sh.logger)
+			}
+		}))
+	}
+
+	addRoute(http.MethodGet, "/", streamItems(sh))
+	addRoute(http.MethodPost, "/ack", inboxh.AckItems(sh.inboxSvc, sh.render))
+	addRoute(http.MethodPost, "/tickets", createTicket(sh))
+
+	return sh
+}
+
+func (sh *streamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sh.mux.ServeHTTP(w, r)
+}
+
+func streamItems(sh *streamHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tk, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		opts, err := inboxh.ParseReceiveOptions(r.URL.Query())
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+		// The streams send all the pending items
+		opts.After, opts.Limit = 0, 0
+		opts.Channel = channel.Stream
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return errors.New("streaming is not supported")
+		}
+
+		// The streams outlive the write timeout of the server
+		err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return errors.Wrap(err, "set write deadline")
+		}
+
+		// Subscribe before the first receive so that no new item is missed
+		sub := sh.hub.Subscribe(tk.ID)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		// Disable the buffering of the reverse proxies
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(sh.pollInterval)
+		defer ticker.Stop()
+
+		ctx := r.Context()
+		for {
+			err = sh.sendItems(ctx, w, tk.ID, opts)
+			if err != nil {
+				// The response is already started, the client reconnects
+				sh.logger.Error().Err(err).Str("token_id", string(tk.ID)).
+					Msg("send stream items")
+				return nil
+			}
+			flusher.Flush()
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-sub.C:
+			case <-ticker.C:
+				// Keep the idle connections alive
+				_, err = io.WriteString(w, ": ping\n\n")
+				if err != nil {
+					return nil
+				}
+			}
+		}
+	})
+}
+
+// sendItems sends the pending items of the receiver as events
+func (sh *streamHandler) sendItems(ctx context.Context, w io.Writer,
+	tokenID token.ID, opts inbox.ReceiveOptions) error {
+	for {
+		items, err := sh.inboxSvc.ReceiveItems(ctx, tokenID, opts)
+		if err != nil {
+			return errors.Wrap(err, "receive items")
+		}
+
+		for _, item := range items {
+			data, err := json.Marshal(inboxh.NewItemResponse(item))
+			if err != nil {
+				return errors.Wrap(err, "json marshal item")
+			}
+
+			_, err = fmt.Fprintf(w, "id: %s\nevent: notification\ndata: %s\n\n", item.ID, data)
+			if err != nil {
+				return errors.Wrap(err, "write event")
+			}
+		}
+
+		// The received items are hidden so the next receive gets the rest
+		if len(items) < inbox.DefaultLimit {
+			return nil
+		}
+	}
+}
+
+type createTicketResponse struct {
+	Ticket    stream.TicketID `json:"ticket"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+func createTicket(sh *streamHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tk, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token not injected into context")
+		}
+
+		ticket, err := sh.streamSvc.CreateTicket(r.Context(), tk.ID)
+		if err != nil {
+			return errors.Wrap(err, "create ticket")
+		}
+
+		return sh.render.JSON(w, http.StatusOK, createTicketResponse{
+			Ticket:    ticket.ID,
+			ExpiresAt: ticket.ExpiresAt,
+		})
+	})
+}
@@ -0,0 +1,210 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/callback"
+	"github.com/stevenferrer/notifi/channel"
+	"github.com/stevenferrer/notifi/inbox"
+	"github.com/stevenferrer/notifi/postgres"
+	"github.com/stevenferrer/notifi/postgres/migration"
+	"github.com/stevenferrer/notifi/postgres/txdb"
+	"github.com/stevenferrer/notifi/stream"
+	sthandler "github.com/stevenferrer/notifi/stream/handler"
+	"github.com/stevenferrer/notifi/token"
+	tkhandler "github.com/stevenferrer/notifi/token/handler"
+)
+
+type itemEvent struct {
+	ID       inbox.ID               `json:"item_id"`
+	CBType   callback.CBType        `json:"callback_type"`
+	Payload  map[string]interface{} `json:"payload"`
+	Receives int                    `json:"receives"`
+}
+
+func TestStreamHandler(t *testing.T) {
+	db := txdb.MustOpen()
+	defer db.Close()
+
+	migration.MustMigrate(db)
+
+	tokenRepo := postgres.NewTokenRepository(db)
+	tokenSvc := token.NewTokenService(tokenRepo)
+	tokenMw := tkhandler.NewTokenMw(tokenSvc)
+
+	inboxRepo := postgres.NewInboxRepository(db)
+	inboxSvc := inbox.NewInboxService(inboxRepo)
+	hub := stream.NewHub()
+	streamCh := channel.NewStreamChannel(inboxRepo, hub)
+	streamSvc := stream.NewStreamService(postgres.NewTicketRepository(db))
+	ticketMw := sthandler.NewTicketMw(streamSvc, tokenSvc)
+
+	logger := zerolog.New(os.Stderr)
+	server := httptest.NewServer(ticketMw(tokenMw(sthandler.NewStreamHandler(
+		inboxSvc, streamSvc, hub, time.Hour, logger))))
+	defer server.Close()
+
+	ctx := context.TODO()
+
+	tk, err := tokenSvc.CreateToken(ctx)
+	require.NoError(t, err)
+
+	cb := callback.Callback{
+		ID:      callback.NewID(),
+		TokenID: tk.ID,
+		CBType:  "INVOICE",
+		Channel: channel.Stream,
+	}
+
+	send := func(deliveryID string) {
+		_, err := streamCh.Send(ctx, cb, channel.Message{
+			ID:     deliveryID,
+			CBType: cb.CBType,
+			Body:   []byte(`{"id":"` + deliveryID + `"}`),
+		})
+		require.NoError(t, err)
+	}
+
+	// stored while the receiver is not connected
+	send("1")
+	assert.False(t, hub.Connected(tk.ID))
+
+	// the stream items are not received through the inbox
+	inboxItems, err := inboxSvc.ReceiveItems(ctx, tk.ID,
+		inbox.ReceiveOptions{Channel: channel.Inbox})
+	require.NoError(t, err)
+	assert.Empty(t, inboxItems)
+
+	streamCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet,
+		server.URL+"/?visibility_timeout=60", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("X-API-KEY", string(tk.ID))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := bufio.NewScanner(resp.Body)
+	nextEvent := func() itemEvent {
+		var event itemEvent
+		for events.Scan() {
+			line := events.Text()
+			if strings.HasPrefix(line, "data: ") {
+				err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+				require.NoError(t, err)
+				return event
+			}
+		}
+
+		t.Fatalf("stream ended: %v", events.Err())
+		return event
+	}
+
+	t.Run("Stream stored items", func(t *testing.T) {
+		event := nextEvent()
+		assert.Equal(t, "1", event.Payload["id"])
+		assert.Equal(t, cb.CBType, event.CBType)
+		assert.Equal(t, 1, event.Receives)
+	})
+
+	var eventID inbox.ID
+	t.Run("Stream new items", func(t *testing.T) {
+		require.Eventually(t, func() bool {
+			return hub.Connected(tk.ID)
+		}, time.Second, 10*time.Millisecond)
+
+		send("2")
+
+		event := nextEvent()
+		assert.Equal(t, "2", event.Payload["id"])
+		eventID = event.ID
+	})
+
+	t.Run("Ack items", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/ack",
+			strings.NewReader(`{"item_ids":["`+string(eventID)+`"]}`))
+		require.NoError(t, err)
+		req.Header.Set("X-API-KEY", string(tk.ID))
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var response struct {
+			Acked int `json:"acked"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		require.NoError(t, err)
+		assert.Equal(t, 1, response.Acked)
+	})
+
+	// the browser event sources can't set headers so they use a ticket
+	t.Run("Stream with ticket", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			server.URL+"/tickets", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-API-KEY", string(tk.ID))
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var response struct {
+			Ticket string `json:"ticket"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		require.NoError(t, err)
+		require.NotEmpty(t, response.Ticket)
+
+		connect := func() *http.Response {
+			ticketCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			t.Cleanup(cancel)
+
+			req, err := http.NewRequestWithContext(ticketCtx, http.MethodGet,
+				server.URL+"/?ticket="+response.Ticket, nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept", "text/event-stream")
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			t.Cleanup(func() { resp.Body.Close() })
+			return resp
+		}
+
+		resp = connect()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		// the tickets can only be used once
+		resp = connect()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Stream without api key", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/?api_key=" + string(tk.ID))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/stevenferrer/notifi/notifihttp"
+	"github.com/stevenferrer/notifi/stream"
+	"github.com/stevenferrer/notifi/token"
+)
+
+// NewTicketMw authenticates the stream connections with the stream tickets.
+// The browser event sources can't set the api key header so they pass a
+// ticket in the query instead. The requests without a ticket are passed
+// as is to be authenticated by the token middleware.
+func NewTicketMw(streamSvc stream.Service, tokenSvc token.Service) notifihttp.StdMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ticketID := r.URL.Query().Get("ticket")
+			if ticketID == "" || r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tokenID, err := streamSvc.RedeemTicket(r.Context(), stream.TicketID(ticketID))
+			if err != nil {
+				status := http.StatusInternalServerError
+				if err == stream.ErrTicketNotFound {
+					status = http.StatusUnauthorized
+				}
+
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+
+			tk, err := tokenSvc.GetToken(r.Context(), tokenID)
+			if err != nil {
+				status := http.StatusInternalServerError
+				if err == token.ErrTokenNotFound {
+					status = http.StatusUnauthorized
+				}
+
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(notifihttp.CtxWithToken(r.Context(), tk)))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Package stream implements the real time delivery of the notifications to
+// the receivers connected through server-sent events.
+//
+// The streamed notifications are stored as the stream items of the receiver
+// first so that they're not lost if the receiver isn't connected. The hub
+// wakes up the connected streams of the receiver which then send the pending
+// stream items. The items are redelivered until they're acked, same as the
+// inbox. The browsers connect with a single-use ticket since the event
+// sources can't set the api key header.
+package stream
+
+import (
+	"sync"
+
+	"github.com/stevenferrer/notifi/token"
+)
+
+// Hub wakes up the streams of the receivers when there are new items in
+// their inbox. The hub is in memory, the streams connected to the other
+// instances only see the new items when they poll the inbox.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[token.ID]map[*Subscription]struct{}
+}
+
+// Subscription is a stream subscribed to the new items of the receiver
+type Subscription struct {
+	// C receives a signal when there are new items, the
+	// signals are coalesced while the stream is busy
+	C <-chan struct{}
+
+	c       chan struct{}
+	tokenID token.ID
+	hub     *Hub
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[token.ID]map[*Subscription]struct{}{}}
+}
+
+// Subscribe subscribes to the new items of the receiver
+func (h *Hub) Subscribe(tokenID token.ID) *Subscription {
+	c := make(chan struct{}, 1)
+	sub := &Subscription{C: c, c: c, tokenID: tokenID, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[tokenID] == nil {
+		h.subs[tokenID] = map[*Subscription]struct{}{}
+	}
+	h.subs[tokenID][sub] = struct{}{}
+
+	return sub
+}
+
+// Close unsubscribes the stream
+func (sub *Subscription) Close() {
+	h := sub.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs[sub.tokenID], sub)
+	if len(h.subs[sub.tokenID]) == 0 {
+		delete(h.subs, sub.tokenID)
+	}
+}
+
+// Publish wakes up the streams of the receiver
+func (h *Hub) Publish(tokenID token.ID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs[tokenID] {
+		select {
+		case sub.c <- struct{}{}:
+		default:
+			// the stream has a pending signal
+		}
+	}
+}
+
+// Connected reports whether the receiver has connected streams
+func (h *Hub) Connected(tokenID token.ID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subs[tokenID]) > 0
+}
@@ -0,0 +1,56 @@
+package stream_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stevenferrer/notifi/stream"
+	"github.com/stevenferrer/notifi/token"
+)
+
+func TestHub(t *testing.T) {
+	hub := stream.NewHub()
+
+	tokenID, otherTokenID := token.NewID(), token.NewID()
+	assert.False(t, hub.Connected(tokenID))
+
+	sub := hub.Subscribe(tokenID)
+	sub2 := hub.Subscribe(tokenID)
+	otherSub := hub.Subscribe(otherTokenID)
+	assert.True(t, hub.Connected(tokenID))
+
+	// the signals are coalesced
+	hub.Publish(tokenID)
+	hub.Publish(tokenID)
+
+	for _, s := range []*stream.Subscription{sub, sub2} {
+		select {
+		case <-s.C:
+		default:
+			t.Fatal("expecting a signal")
+		}
+
+		select {
+		case <-s.C:
+			t.Fatal("expecting a single signal")
+		default:
+		}
+	}
+
+	// the other receivers are not woken up
+	select {
+	case <-otherSub.C:
+		t.Fatal("expecting no signal")
+	default:
+	}
+
+	sub.Close()
+	assert.True(t, hub.Connected(tokenID))
+
+	sub2.Close()
+	assert.False(t, hub.Connected(tokenID))
+
+	// publishing without streams is a no-op
+	hub.Publish(tokenID)
+}
@@ -0,0 +1,16 @@
+package stream
+
+import (
+	"context"
+	"time"
+
+	"github.com/stevenferrer/notifi/token"
+)
+
+// TicketRepository is the stream ticket repository
+type TicketRepository interface {
+	CreateTicket(context.Context, Ticket) error
+	// RedeemTicket deletes the ticket if it's not expired at the given
+	// time and returns its token, the tickets can only be redeemed once
+	RedeemTicket(context.Context, TicketID, time.Time) (token.ID, error)
+}
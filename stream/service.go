@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stevenferrer/notifi/token"
+)
+
+// Service is the stream service
+type Service interface {
+	// CreateTicket creates a stream ticket for the token
+	CreateTicket(context.Context, token.ID) (*Ticket, error)
+	// RedeemTicket returns the token of the ticket and invalidates the ticket
+	RedeemTicket(context.Context, TicketID) (token.ID, error)
+}
+
+// StreamService implements the stream service
+type StreamService struct {
+	ticketRepo TicketRepository
+}
+
+var _ Service = (*StreamService)(nil)
+
+func NewStreamService(ticketRepo TicketRepository) *StreamService {
+	return &StreamService{ticketRepo: ticketRepo}
+}
+
+func (ss *StreamService) CreateTicket(ctx context.Context, tokenID token.ID) (*Ticket, error) {
+	ticket := Ticket{
+		ID:        NewTicketID(),
+		TokenID:   tokenID,
+		ExpiresAt: time.Now().Add(TicketTTL),
+	}
+
+	err := ss.ticketRepo.CreateTicket(ctx, ticket)
+	if err != nil {
+		return nil, errors.Wrap(err, "create ticket")
+	}
+
+	return &ticket, nil
+}
+
+func (ss *StreamService) RedeemTicket(ctx context.Context, ticketID TicketID) (token.ID, error) {
+	tokenID, err := ss.ticketRepo.RedeemTicket(ctx, ticketID, time.Now())
+	if err != nil {
+		if err == ErrTicketNotFound {
+			return "", err
+		}
+
+		return "", errors.Wrap(err, "redeem ticket")
+	}
+
+	return tokenID, nil
+}
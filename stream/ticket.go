@@ -0,0 +1,33 @@
+package stream
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stevenferrer/notifi/token"
+)
+
+// TicketID is the stream ticket ID
+type TicketID string
+
+// TicketTTL is how long the stream tickets can be used
+const TicketTTL = 30 * time.Second
+
+// Ticket authenticates a single stream connection in place of the api key.
+// It's meant for the browser event sources which can't set headers, the
+// tickets are short-lived and can only be used once.
+type Ticket struct {
+	// ID is the ticket ID, it's passed in the ticket query param
+	ID TicketID
+	// TokenID is the token that the ticket authenticates
+	TokenID token.ID
+	// ExpiresAt is when the ticket can't be used anymore
+	ExpiresAt time.Time
+}
+
+func NewTicketID() TicketID {
+	return TicketID(strings.ReplaceAll(uuid.NewString(), "-", "") +
+		strings.ReplaceAll(uuid.NewString(), "-", ""))
+}
@@ -3,5 +3,7 @@ package token
 import "github.com/pkg/errors"
 
 var (
-	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenNotFound      = errors.New("token not found")
+	ErrInvalidGracePeriod = errors.New("invalid grace period")
+	ErrGrantNotFound      = errors.New("grant not found")
 )
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pkg/errors"
@@ -40,6 +42,10 @@ func NewTokenHandler(tks token.Service, logger zerolog.Logger) http.Handler {
 
 	addRoute(http.MethodPost, "/", createToken(tkh))
 	addRoute(http.MethodGet, "/me", getToken(tkh))
+	addRoute(http.MethodPost, "/cb-key/rotate", rotateCBKey(tkh))
+	addRoute(http.MethodGet, "/grants", listGrants(tkh))
+	addRoute(http.MethodPost, "/grants", grantPublisher(tkh))
+	addRoute(http.MethodDelete, "/grants/{publisher_id}", revokePublisher(tkh))
 
 	return tkh
 }
@@ -84,3 +90,143 @@ func getToken(tkh *tokenHandler) notifihttp.Handler {
 		return tkh.render.JSON(w, http.StatusOK, tk)
 	})
 }
+
+type rotateCBKeyRequest struct {
+	// GracePeriod is the number of seconds the old keys remain valid
+	GracePeriod *int64 `json:"grace_period"`
+}
+
+type rotateCBKeyResponse struct {
+	CBKey  token.CBKey `json:"cb_key"`
+	CBKeys []token.Key `json:"cb_keys"`
+}
+
+func rotateCBKey(tkh *tokenHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tk, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token is not injected into context")
+		}
+
+		// request body is optional
+		var request rotateCBKeyRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil && err != io.EOF {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		gracePeriod := token.DefaultGracePeriod
+		if request.GracePeriod != nil {
+			gracePeriod = time.Duration(*request.GracePeriod) * time.Second
+		}
+
+		tk, err = tkh.tks.RotateCBKey(r.Context(), tk.ID, gracePeriod)
+		if err != nil {
+			if err == token.ErrInvalidGracePeriod {
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return err
+		}
+
+		cbKeys, err := tkh.tks.GetActiveCBKeys(r.Context(), tk.ID)
+		if err != nil {
+			return err
+		}
+
+		return tkh.render.JSON(w, http.StatusOK, rotateCBKeyResponse{
+			CBKey:  tk.CBKey,
+			CBKeys: cbKeys,
+		})
+	})
+}
+
+type grantResponse struct {
+	PublisherID token.ID  `json:"publisher_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newGrantResponse(grant token.Grant) grantResponse {
+	return grantResponse{
+		PublisherID: grant.PublisherID,
+		CreatedAt:   grant.CreatedAt,
+	}
+}
+
+type listGrantsResponse struct {
+	Grants []grantResponse `json:"grants"`
+}
+
+func listGrants(tkh *tokenHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tk, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token is not injected into context")
+		}
+
+		grants, err := tkh.tks.ListGrants(r.Context(), tk.ID)
+		if err != nil {
+			return err
+		}
+
+		response := listGrantsResponse{Grants: []grantResponse{}}
+		for _, grant := range grants {
+			response.Grants = append(response.Grants, newGrantResponse(grant))
+		}
+
+		return tkh.render.JSON(w, http.StatusOK, response)
+	})
+}
+
+type grantPublisherRequest struct {
+	PublisherID token.ID `json:"publisher_id"`
+}
+
+func grantPublisher(tkh *tokenHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tk, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token is not injected into context")
+		}
+
+		var request grantPublisherRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			return notifihttp.NewBadRequestError(err)
+		}
+
+		grant, err := tkh.tks.GrantPublisher(r.Context(), tk.ID, request.PublisherID)
+		if err != nil {
+			if err == token.ErrTokenNotFound {
+				return notifihttp.NewBadRequestError(err)
+			}
+
+			return err
+		}
+
+		return tkh.render.JSON(w, http.StatusOK, newGrantResponse(*grant))
+	})
+}
+
+func revokePublisher(tkh *tokenHandler) notifihttp.Handler {
+	return notifihttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tk, ok := notifihttp.TokenFromCtx(r.Context())
+		if !ok {
+			return errors.New("token is not injected into context")
+		}
+
+		publisherID := token.ID(chi.URLParam(r, "publisher_id"))
+		err := tkh.tks.RevokePublisher(r.Context(), tk.ID, publisherID)
+		if err != nil {
+			if err == token.ErrGrantNotFound {
+				return notifihttp.NewNotFoundError(err)
+			}
+
+			return err
+		}
+
+		return tkh.render.JSON(w, http.StatusOK, map[string]string{
+			"message": "revoke ok",
+		})
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -76,4 +78,83 @@ func TestTokenHandler(t *testing.T) {
 		assert.NotEmpty(t, resp.APIKey)
 		assert.NotEmpty(t, resp.CBKey)
 	})
+
+	t.Run("Rotate callback key", func(t *testing.T) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			"/cb-key/rotate", strings.NewReader(`{"grace_period":3600}`))
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", apiKey)
+
+		rr := httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp = struct {
+			CBKey  string `json:"cb_key"`
+			CBKeys []struct {
+				CBKey     string     `json:"cb_key"`
+				ExpiresAt *time.Time `json:"expires_at"`
+			} `json:"cb_keys"`
+		}{}
+		err = json.NewDecoder(rr.Body).Decode(&resp)
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, resp.CBKey)
+		// new key and the old key in grace period
+		require.Len(t, resp.CBKeys, 2)
+		assert.Equal(t, resp.CBKey, resp.CBKeys[0].CBKey)
+		assert.Nil(t, resp.CBKeys[0].ExpiresAt)
+		assert.NotNil(t, resp.CBKeys[1].ExpiresAt)
+	})
+
+	t.Run("Grants", func(t *testing.T) {
+		publisher, err := tokenSvc.CreateToken(ctx)
+		require.NoError(t, err)
+
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "/grants",
+			strings.NewReader(`{"publisher_id":"`+string(publisher.ID)+`"}`))
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", apiKey)
+
+		rr := httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		httpReq, err = http.NewRequestWithContext(ctx, http.MethodGet, "/grants", nil)
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", apiKey)
+
+		rr = httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp = struct {
+			Grants []struct {
+				PublisherID string `json:"publisher_id"`
+			} `json:"grants"`
+		}{}
+		err = json.NewDecoder(rr.Body).Decode(&resp)
+		require.NoError(t, err)
+		require.Len(t, resp.Grants, 1)
+		assert.Equal(t, string(publisher.ID), resp.Grants[0].PublisherID)
+
+		// revoke
+		httpReq, err = http.NewRequestWithContext(ctx, http.MethodDelete,
+			"/grants/"+string(publisher.ID), nil)
+		require.NoError(t, err)
+
+		httpReq.Header.Add("X-API-KEY", apiKey)
+
+		rr = httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		// already revoked
+		rr = httptest.NewRecorder()
+		authHandler.ServeHTTP(rr, httpReq)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
 }
@@ -17,6 +17,12 @@ func NewTokenMw(tokenSvc token.Service) notifihttp.StdMiddleware {
 				return
 			}
 
+			// Already authenticated e.g. by a stream ticket
+			if _, ok := notifihttp.TokenFromCtx(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			apiKey := r.Header.Get("X-API-KEY")
 			if apiKey == "" {
 				status := http.StatusUnauthorized
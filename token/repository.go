@@ -2,9 +2,20 @@ package token
 
 import (
 	"context"
+	"time"
 )
 
 type Repository interface {
 	CreateToken(context.Context, Token) error
 	GetToken(context.Context, ID) (*Token, error)
+	// RotateCBKey replaces the current callback key and expires the old keys at the given time
+	RotateCBKey(context.Context, ID, CBKey, time.Time) error
+	// GetActiveCBKeys returns the callback keys that are not yet expired, newest first
+	GetActiveCBKeys(context.Context, ID) ([]Key, error)
+	// CreateGrant allows the publisher to broadcast to the token
+	CreateGrant(context.Context, Grant) error
+	DeleteGrant(context.Context, ID, ID) error
+	ListGrants(context.Context, ID) ([]Grant, error)
+	// ListGrantors returns the tokens that allow the publisher to broadcast to them
+	ListGrantors(context.Context, ID) ([]ID, error)
 }
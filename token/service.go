@@ -3,13 +3,25 @@ package token
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// DefaultGracePeriod is the default duration that the old
+// callback key remains valid after the key is rotated
+const DefaultGracePeriod = 24 * time.Hour
+
 type Service interface {
 	CreateToken(context.Context) (*Token, error)
 	GetToken(context.Context, ID) (*Token, error)
+	RotateCBKey(context.Context, ID, time.Duration) (*Token, error)
+	GetActiveCBKeys(context.Context, ID) ([]Key, error)
+	// GrantPublisher allows the publisher to broadcast to the token
+	GrantPublisher(ctx context.Context, tokenID, publisherID ID) (*Grant, error)
+	// RevokePublisher disallows the publisher to broadcast to the token
+	RevokePublisher(ctx context.Context, tokenID, publisherID ID) error
+	ListGrants(context.Context, ID) ([]Grant, error)
 }
 
 type TokenService struct{ repo Repository }
@@ -46,3 +58,77 @@ func (tks *TokenService) GetToken(ctx context.Context, tkID ID) (*Token, error)
 
 	return tk, nil
 }
+
+// RotateCBKey generates a new callback key, the old
+// keys remain valid until the grace period has elapsed
+func (tks *TokenService) RotateCBKey(ctx context.Context, tkID ID,
+	gracePeriod time.Duration) (*Token, error) {
+	if gracePeriod < 0 {
+		return nil, ErrInvalidGracePeriod
+	}
+
+	tk, err := tks.GetToken(ctx, tkID)
+	if err != nil {
+		return nil, err
+	}
+
+	tk.CBKey = NewCBKey()
+	err = tks.repo.RotateCBKey(ctx, tk.ID, tk.CBKey, time.Now().Add(gracePeriod))
+	if err != nil {
+		return nil, errors.Wrap(err, "rotate cb key")
+	}
+
+	return tk, nil
+}
+
+func (tks *TokenService) GetActiveCBKeys(ctx context.Context, tkID ID) ([]Key, error) {
+	keys, err := tks.repo.GetActiveCBKeys(ctx, tkID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get active cb keys")
+	}
+
+	return keys, nil
+}
+
+func (tks *TokenService) GrantPublisher(ctx context.Context,
+	tkID, publisherID ID) (*Grant, error) {
+	// make sure the publisher exists
+	_, err := tks.GetToken(ctx, publisherID)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := Grant{
+		TokenID:     tkID,
+		PublisherID: publisherID,
+		CreatedAt:   time.Now(),
+	}
+	err = tks.repo.CreateGrant(ctx, grant)
+	if err != nil {
+		return nil, errors.Wrap(err, "create grant")
+	}
+
+	return &grant, nil
+}
+
+func (tks *TokenService) RevokePublisher(ctx context.Context, tkID, publisherID ID) error {
+	err := tks.repo.DeleteGrant(ctx, tkID, publisherID)
+	if err != nil {
+		if err == ErrGrantNotFound {
+			return err
+		}
+
+		return errors.Wrap(err, "delete grant")
+	}
+
+	return nil
+}
+
+func (tks *TokenService) ListGrants(ctx context.Context, tkID ID) ([]Grant, error) {
+	grants, err := tks.repo.ListGrants(ctx, tkID)
+	if err != nil {
+		return nil, errors.Wrap(err, "list grants")
+	}
+
+	return grants, nil
+}
@@ -35,4 +35,50 @@ func TestTokenService(t *testing.T) {
 	// token not found
 	_, err = tokenSvc.GetToken(ctx, token.NewID())
 	assert.ErrorIs(t, err, token.ErrTokenNotFound)
+
+	// rotate callback key
+	rotatedTk, err := tokenSvc.RotateCBKey(ctx, tk.ID, token.DefaultGracePeriod)
+	require.NoError(t, err)
+	assert.Equal(t, tk.ID, rotatedTk.ID)
+	assert.NotEqual(t, tk.CBKey, rotatedTk.CBKey)
+
+	keys, err := tokenSvc.GetActiveCBKeys(ctx, tk.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []token.CBKey{tk.CBKey, rotatedTk.CBKey}, token.CBKeys(keys))
+
+	// negative grace period
+	_, err = tokenSvc.RotateCBKey(ctx, tk.ID, -1)
+	assert.ErrorIs(t, err, token.ErrInvalidGracePeriod)
+
+	// grant a publisher
+	publisher, err := tokenSvc.CreateToken(ctx)
+	require.NoError(t, err)
+
+	grant, err := tokenSvc.GrantPublisher(ctx, tk.ID, publisher.ID)
+	require.NoError(t, err)
+	assert.Equal(t, publisher.ID, grant.PublisherID)
+
+	// granting twice is fine
+	_, err = tokenSvc.GrantPublisher(ctx, tk.ID, publisher.ID)
+	require.NoError(t, err)
+
+	grants, err := tokenSvc.ListGrants(ctx, tk.ID)
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	assert.Equal(t, publisher.ID, grants[0].PublisherID)
+
+	grantors, err := tokenRepo.ListGrantors(ctx, publisher.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []token.ID{tk.ID}, grantors)
+
+	// publisher must exist
+	_, err = tokenSvc.GrantPublisher(ctx, tk.ID, token.NewID())
+	assert.ErrorIs(t, err, token.ErrTokenNotFound)
+
+	// revoke the publisher
+	err = tokenSvc.RevokePublisher(ctx, tk.ID, publisher.ID)
+	require.NoError(t, err)
+
+	err = tokenSvc.RevokePublisher(ctx, tk.ID, publisher.ID)
+	assert.ErrorIs(t, err, token.ErrGrantNotFound)
 }
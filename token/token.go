@@ -1,5 +1,7 @@
 package token
 
+import "time"
+
 type (
 	ID    string
 	CBKey string
@@ -11,3 +13,32 @@ type Token struct {
 	// CBKey is the callback key for validating on customer-end
 	CBKey CBKey `json:"cb_key"`
 }
+
+// Key is a callback key of a token
+type Key struct {
+	// CBKey is the callback key
+	CBKey CBKey `json:"cb_key"`
+	// CreatedAt is the created timestamp
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is the expiry timestamp, nil if the key doesn't expire
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CBKeys returns the callback keys of the keys
+func CBKeys(keys []Key) []CBKey {
+	cbKeys := make([]CBKey, 0, len(keys))
+	for _, key := range keys {
+		cbKeys = append(cbKeys, key.CBKey)
+	}
+	return cbKeys
+}
+
+// Grant allows the publisher to broadcast notifications to the token
+type Grant struct {
+	// TokenID is the token that receives the notifications
+	TokenID ID
+	// PublisherID is the token allowed to broadcast to the token
+	PublisherID ID
+	// CreatedAt is the created timestamp
+	CreatedAt time.Time
+}
@@ -0,0 +1,71 @@
+// Package transform implements the payload templates of the callbacks.
+//
+// A template is a Go text/template that reshapes the notification payload
+// into the request body expected by the receiver, for example:
+//
+//	{"id": {{json .order_id}}, "total": {{json .amount}}, "source": "notifi"}
+//
+// The payload is the data of the template. The json function encodes a value
+// into json so that the strings are quoted and escaped. Static fields are
+// written as is. The rendered template must be valid json.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Template is a parsed payload template
+type Template struct {
+	text string
+	tmpl *template.Template
+}
+
+var funcs = template.FuncMap{
+	"json": toJSON,
+}
+
+// Parse parses the payload template
+func Parse(text string) (*Template, error) {
+	tmpl, err := template.New("payload").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{text: text, tmpl: tmpl}, nil
+}
+
+// String returns the template text
+func (t *Template) String() string {
+	return t.text
+}
+
+// Render renders the payload into a compact json
+func (t *Template) Render(payload map[string]interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := t.tmpl.Execute(buf, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &bytes.Buffer{}
+	err = json.Compact(out, buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "rendered template is not valid json")
+	}
+
+	return out.Bytes(), nil
+}
+
+// toJSON encodes the value into json
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,87 @@
+package transform_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/transform"
+)
+
+func TestTemplate(t *testing.T) {
+	var payload map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"order_id": "1234",
+		"amount": 1500,
+		"customer": {"name": "Jane \"JD\" Doe"},
+		"items": [{"sku": "a"}, {"sku": "b"}]
+	}`), &payload)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "reshape",
+			text: `{"id": {{json .order_id}}, "total": {{json .amount}}}`,
+			want: `{"id":"1234","total":1500}`,
+		},
+		{
+			name: "static fields",
+			text: `{"id": {{json .order_id}}, "source": "notifi", "version": 2}`,
+			want: `{"id":"1234","source":"notifi","version":2}`,
+		},
+		{
+			name: "nested and escaped",
+			text: `{"customer": {{json .customer.name}}, "raw": {{json .customer}}}`,
+			want: `{"customer":"Jane \"JD\" Doe","raw":{"name":"Jane \"JD\" Doe"}}`,
+		},
+		{
+			name: "range",
+			text: `{"skus": [{{range $i, $item := .items}}{{if $i}},{{end}}{{json $item.sku}}{{end}}]}`,
+			want: `{"skus":["a","b"]}`,
+		},
+		{
+			name: "missing field",
+			text: `{"note": {{json .note}}}`,
+			want: `{"note":null}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := transform.Parse(tc.text)
+			require.NoError(t, err)
+			assert.Equal(t, tc.text, tmpl.String())
+
+			got, err := tmpl.Render(payload)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+
+	t.Run("parse error", func(t *testing.T) {
+		_, err := transform.Parse(`{"id": {{json .order_id}`)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		tmpl, err := transform.Parse(`{"name": {{.customer.name}}}`)
+		require.NoError(t, err)
+
+		_, err = tmpl.Render(payload)
+		assert.Error(t, err)
+	})
+
+	t.Run("execute error", func(t *testing.T) {
+		tmpl, err := transform.Parse(`{"id": {{json .order_id.x}}}`)
+		require.NoError(t, err)
+
+		_, err = tmpl.Render(payload)
+		assert.Error(t, err)
+	})
+}
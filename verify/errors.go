@@ -0,0 +1,12 @@
+package verify
+
+import "errors"
+
+var (
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+	ErrStaleTimestamp   = errors.New("timestamp outside tolerance")
+	ErrMissingIdempKey  = errors.New("missing idempotent key")
+	ErrDuplicateRequest = errors.New("duplicate request")
+)
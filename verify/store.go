@@ -0,0 +1,64 @@
+package verify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps track of the idempotent keys of the processed requests
+type Store interface {
+	// AddIfAbsent marks the key as seen until the expiry and reports
+	// whether it was added. It must be atomic so that only one of the
+	// concurrent requests with the same key is processed.
+	AddIfAbsent(ctx context.Context, key string, expiresAt time.Time) (bool, error)
+	// Remove forgets the key
+	Remove(ctx context.Context, key string) error
+}
+
+// MemoryStore is an in-memory store, useful for single instance receivers and testing
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]time.Time
+	now  func() time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys: map[string]time.Time{},
+		now:  time.Now,
+	}
+}
+
+// AddIfAbsent implements Store
+func (s *MemoryStore) AddIfAbsent(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Remove expired keys so that the store doesn't grow unbounded
+	now := s.now()
+	for k, exp := range s.keys {
+		if !now.Before(exp) {
+			delete(s.keys, k)
+		}
+	}
+
+	if _, ok := s.keys[key]; ok {
+		return false, nil
+	}
+
+	s.keys[key] = expiresAt
+	return true, nil
+}
+
+// Remove implements Store
+func (s *MemoryStore) Remove(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, key)
+	return nil
+}
@@ -0,0 +1,190 @@
+// Package verify verifies the signed callback requests sent by notifi.
+//
+// Receivers can use Verify to check the signature and timestamp of a request,
+// or wrap their handler with Verifier.Middleware to also reject replayed requests.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/stevenferrer/notifi/signature"
+	"github.com/stevenferrer/notifi/token"
+)
+
+const (
+	// IdempKeyHeader is the header for the idempotent key of the request
+	IdempKeyHeader = signature.IdempKeyHeader
+
+	// DefaultTolerance is the default allowed age of the request timestamp
+	DefaultTolerance = 5 * time.Minute
+	// DefaultKeyTTL is the default duration that idempotent keys are remembered
+	DefaultKeyTTL = 24 * time.Hour
+)
+
+// Verify verifies the timestamp and signature of the request, the signature
+// covers the idempotent key. The request is valid if any of the signatures
+// matches any of the callback keys.
+func Verify(header http.Header, body []byte, tolerance time.Duration, cbKeys ...token.CBKey) error {
+	return verify(header, body, tolerance, time.Now(), cbKeys)
+}
+
+func verify(header http.Header, body []byte, tolerance time.Duration,
+	now time.Time, cbKeys []token.CBKey) error {
+	sigs := signature.Parse(header.Get(signature.SignatureHeader))
+	if len(sigs) == 0 {
+		return ErrMissingSignature
+	}
+
+	timestamp, err := strconv.ParseInt(header.Get(signature.TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	idempKey := header.Get(IdempKeyHeader)
+	for _, cbKey := range cbKeys {
+		expected := []byte(signature.Sign(cbKey, timestamp, idempKey, body))
+		for _, sig := range sigs {
+			if hmac.Equal(expected, []byte(sig)) {
+				return nil
+			}
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// Verifier verifies the requests and rejects the duplicates
+type Verifier struct {
+	cbKeys    []token.CBKey
+	tolerance time.Duration
+	keyTTL    time.Duration
+	store     Store
+	now       func() time.Time
+}
+
+// NewVerifier returns a new Verifier. Pass both the old and
+// new callback keys while the callback key is being rotated.
+func NewVerifier(cbKeys ...token.CBKey) *Verifier {
+	return &Verifier{
+		cbKeys:    cbKeys,
+		tolerance: DefaultTolerance,
+		keyTTL:    DefaultKeyTTL,
+		store:     NewMemoryStore(),
+		now:       time.Now,
+	}
+}
+
+// WithTolerance overrides the default timestamp tolerance
+func (v *Verifier) WithTolerance(tolerance time.Duration) *Verifier {
+	v.tolerance = tolerance
+	return v
+}
+
+// WithKeyTTL overrides the default idempotent key ttl
+func (v *Verifier) WithKeyTTL(keyTTL time.Duration) *Verifier {
+	v.keyTTL = keyTTL
+	return v
+}
+
+// WithStore overrides the default in-memory store
+func (v *Verifier) WithStore(store Store) *Verifier {
+	v.store = store
+	return v
+}
+
+// Verify verifies the request and claims its idempotent key so that the
+// duplicates are rejected, including the concurrent ones. Call Release
+// if the request couldn't be processed so that the sender can retry it.
+func (v *Verifier) Verify(ctx context.Context, header http.Header, body []byte) error {
+	err := verify(header, body, v.tolerance, v.now(), v.cbKeys)
+	if err != nil {
+		return err
+	}
+
+	idempKey := header.Get(IdempKeyHeader)
+	if idempKey == "" {
+		return ErrMissingIdempKey
+	}
+
+	added, err := v.store.AddIfAbsent(ctx, idempKey, v.now().Add(v.keyTTL))
+	if err != nil {
+		return err
+	}
+
+	if !added {
+		return ErrDuplicateRequest
+	}
+
+	return nil
+}
+
+// Release releases the idempotent key of the request that failed
+func (v *Verifier) Release(ctx context.Context, header http.Header) error {
+	return v.store.Remove(ctx, header.Get(IdempKeyHeader))
+}
+
+// Middleware verifies the requests before passing them to the next handler.
+// Duplicate requests are acknowledged without calling the next handler.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			status := http.StatusBadRequest
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		err = v.Verify(r.Context(), r.Header, body)
+		if err != nil {
+			var status int
+			switch err {
+			case ErrDuplicateRequest:
+				// Already processed, tell the sender to stop retrying
+				w.WriteHeader(http.StatusOK)
+				return
+			case ErrMissingIdempKey:
+				status = http.StatusBadRequest
+			case ErrMissingSignature, ErrInvalidSignature,
+				ErrInvalidTimestamp, ErrStaleTimestamp:
+				status = http.StatusUnauthorized
+			default:
+				status = http.StatusInternalServerError
+			}
+
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		// Only remember the requests that were processed successfully
+		// so that the sender can retry the failed ones
+		if sw.status < 200 || sw.status >= 300 {
+			_ = v.Release(r.Context(), r.Header)
+		}
+	})
+}
+
+// statusWriter captures the response status
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,179 @@
+package verify_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stevenferrer/notifi/signature"
+	"github.com/stevenferrer/notifi/token"
+	"github.com/stevenferrer/notifi/verify"
+)
+
+func signedHeader(now time.Time, body []byte, idempKey string, cbKeys ...token.CBKey) http.Header {
+	header := http.Header{}
+	for key, value := range signature.Headers(now, idempKey, body, cbKeys...) {
+		header.Set(key, value)
+	}
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	cbKey := token.NewCBKey()
+	body := []byte(`{"message":"hello"}`)
+	now := time.Now()
+
+	t.Run("Valid", func(t *testing.T) {
+		header := signedHeader(now, body, "1234", cbKey)
+		err := verify.Verify(header, body, verify.DefaultTolerance, cbKey)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Tampered body", func(t *testing.T) {
+		header := signedHeader(now, body, "1234", cbKey)
+		err := verify.Verify(header, []byte(`{"message":"bye"}`),
+			verify.DefaultTolerance, cbKey)
+		assert.ErrorIs(t, err, verify.ErrInvalidSignature)
+	})
+
+	t.Run("Replaced idemp key", func(t *testing.T) {
+		header := signedHeader(now, body, "1234", cbKey)
+		header.Set(verify.IdempKeyHeader, "5678")
+		err := verify.Verify(header, body, verify.DefaultTolerance, cbKey)
+		assert.ErrorIs(t, err, verify.ErrInvalidSignature)
+	})
+
+	t.Run("Wrong key", func(t *testing.T) {
+		header := signedHeader(now, body, "1234", cbKey)
+		err := verify.Verify(header, body, verify.DefaultTolerance, token.NewCBKey())
+		assert.ErrorIs(t, err, verify.ErrInvalidSignature)
+	})
+
+	t.Run("Stale timestamp", func(t *testing.T) {
+		header := signedHeader(now.Add(-time.Hour), body, "1234", cbKey)
+		err := verify.Verify(header, body, verify.DefaultTolerance, cbKey)
+		assert.ErrorIs(t, err, verify.ErrStaleTimestamp)
+	})
+
+	t.Run("Missing signature", func(t *testing.T) {
+		err := verify.Verify(http.Header{}, body, verify.DefaultTolerance, cbKey)
+		assert.ErrorIs(t, err, verify.ErrMissingSignature)
+	})
+
+	t.Run("Rotated keys", func(t *testing.T) {
+		newCBKey := token.NewCBKey()
+		header := signedHeader(now, body, "1234", newCBKey, cbKey)
+
+		// receiver that only knows the old key
+		err := verify.Verify(header, body, verify.DefaultTolerance, cbKey)
+		assert.NoError(t, err)
+
+		// receiver that only knows the new key
+		err = verify.Verify(header, body, verify.DefaultTolerance, newCBKey)
+		assert.NoError(t, err)
+	})
+}
+
+func TestVerifier(t *testing.T) {
+	cbKey := token.NewCBKey()
+	body := []byte(`{"message":"hello"}`)
+	ctx := context.TODO()
+
+	verifier := verify.NewVerifier(cbKey)
+
+	header := signedHeader(time.Now(), body, "1234", cbKey)
+	err := verifier.Verify(ctx, header, body)
+	require.NoError(t, err)
+
+	// replaying the request should fail
+	err = verifier.Verify(ctx, header, body)
+	assert.ErrorIs(t, err, verify.ErrDuplicateRequest)
+
+	// the released requests can be retried
+	err = verifier.Release(ctx, header)
+	require.NoError(t, err)
+	err = verifier.Verify(ctx, header, body)
+	assert.NoError(t, err)
+
+	// only one of the concurrent requests passes
+	header = signedHeader(time.Now(), body, "5678", cbKey)
+	var (
+		wg     sync.WaitGroup
+		passed int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if verifier.Verify(ctx, header, body) == nil {
+				atomic.AddInt32(&passed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), passed)
+
+	// missing idemp key
+	header = signedHeader(time.Now(), body, "", cbKey)
+	err = verifier.Verify(ctx, header, body)
+	assert.ErrorIs(t, err, verify.ErrMissingIdempKey)
+}
+
+func TestMiddleware(t *testing.T) {
+	cbKey := token.NewCBKey()
+	body := []byte(`{"message":"hello"}`)
+
+	calls, status := 0, http.StatusInternalServerError
+	handler := verify.NewVerifier(cbKey).Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			// body should still be readable
+			b, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, body, b)
+
+			w.WriteHeader(status)
+		}))
+
+	newRequest := func(header http.Header) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		r.Header = header
+		return r
+	}
+
+	header := signedHeader(time.Now(), body, "1234", cbKey)
+
+	// failed requests are not remembered
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(header))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, 1, calls)
+
+	status = http.StatusOK
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(header))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 2, calls)
+
+	// duplicates are acknowledged without calling the handler
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(header))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 2, calls)
+
+	// invalid signature
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(signedHeader(time.Now(), body, "5678", token.NewCBKey())))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, 2, calls)
+}